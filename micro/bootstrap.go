@@ -1,7 +1,9 @@
 package micro
 
 import (
+	"crypto/tls"
 	"fmt"
+	"github.com/spf13/viper"
 	"github.com/uber/jaeger-client-go"
 	jaegercfg "github.com/uber/jaeger-client-go/config"
 	"go-micro/config"
@@ -10,6 +12,13 @@ import (
 	"go-micro/core/log"
 	"go-micro/core/model"
 	"go-micro/rpc/client"
+	"go-micro/rpc/registry"
+	"go-micro/rpc/server"
+	"go-micro/rpc/wrapper/auth"
+	"go-micro/rpc/wrapper/metrics"
+	"go-micro/rpc/wrapper/otel"
+	"go-micro/rpc/wrapper/ratelimit"
+	"go.uber.org/zap"
 	"strconv"
 	"time"
 )
@@ -25,11 +34,17 @@ func Init(cfgPath string) {
 
 	initModel(Config.Mysql)
 
+	initRegistry(Config.Registry)
+
+	initRateLimit(Config.RpcServer.RateLimit)
+
+	initAuth(Config.RpcServer.Auth)
+
 	//loadValidator()
 
 	//initRpcClient(Config.RpcClient)
 
-	InitJaeger(Config.App.ServerName, Config.Jaeger.Address)
+	InitTracing(Config.App.ServerName, Config.Jaeger)
 
 }
 
@@ -53,6 +68,65 @@ func initModel(cfg *model.Config) {
 	DB = model.InitDb(cfg)
 }
 
+func initRegistry(cfg config.Registry) {
+	switch cfg.Name {
+	case "":
+	case "memory":
+		Registry = registry.DefaultRegistry
+	case "file":
+		r, err := registry.NewFileRegistry(cfg.Path)
+		if err != nil {
+			panic(fmt.Sprintf("Error: init file registry:%v \n", err))
+		}
+		Registry = r
+	default:
+		panic("registry unknown: " + cfg.Name + " (available registry: memory file)")
+	}
+}
+
+func initRateLimit(cfg config.RateLimit) {
+	var opts []ratelimit.Option
+	if cache.CacheManager != nil {
+		opts = append(opts, ratelimit.WithCache(cache.CacheManager.Store()))
+	}
+	l, err := ratelimit.NewLimiter(cfg, opts...)
+	if err != nil {
+		panic(fmt.Sprintf("Error: init rate limit:%v \n", err))
+	}
+	RateLimiter = l
+	OnConfigChange(func(v *viper.Viper) {
+		// 单独解析限流配置，Unmarshal到已有的Config时删除的规则不会被清掉
+		var cfg config.RateLimit
+		if err := v.UnmarshalKey("rpc_server.rate_limit", &cfg); err != nil {
+			Logs.Error("reload rate limit config", zap.Error(err))
+			return
+		}
+		// 配置有误时保留原来的规则
+		if err := RateLimiter.Update(cfg); err != nil {
+			Logs.Error("reload rate limit config", zap.Error(err))
+		}
+	})
+}
+
+func initAuth(cfg config.Auth) {
+	a, err := auth.NewAuthenticator(cfg)
+	if err != nil {
+		panic(fmt.Sprintf("Error: init auth:%v \n", err))
+	}
+	Authenticator = a
+	OnConfigChange(func(v *viper.Viper) {
+		var cfg config.Auth
+		if err := v.UnmarshalKey("rpc_server.auth", &cfg); err != nil {
+			Logs.Error("reload auth config", zap.Error(err))
+			return
+		}
+		// 配置有误时保留原来的配置
+		if err := Authenticator.Update(cfg); err != nil {
+			Logs.Error("reload auth config", zap.Error(err))
+		}
+	})
+}
+
 func InitRpcClient(cfg config.RpcClient, opts ...client.DialOption) {
 
 	//初始化rpc
@@ -63,33 +137,122 @@ func InitRpcClient(cfg config.RpcClient, opts ...client.DialOption) {
 		for k, v := range cfg.Servers {
 			debug.DD("v = %v", v)
 			opts = append(opts, client.SetServer(k, &client.Server{
-				CertFile:      v.CertFile,
-				TlsServerName: v.TlsServerName,
-				NetWork:       v.Network,
-				Address:       v.Address,
+				CertFile:       v.CertFile,
+				TlsServerName:  v.TlsServerName,
+				ClientCertFile: v.ClientCertFile,
+				ClientKeyFile:  v.ClientKeyFile,
+				NetWork:        v.Network,
+				Address:        v.Address,
+				ContentType:    v.ContentType,
 			}))
 		}
 	}
 
+	if Registry != nil {
+		opts = append(opts, client.WithRegistry(Registry))
+	}
+
 	RpcClient = client.NewClient(opts...)
+	metrics.DefaultRegistry.AddClient(RpcClient)
+
+}
+
+// NewRpcServer 根据rpc_server配置创建服务端，opts追加在配置之后
+func NewRpcServer(cfg config.RpcServer, opts ...server.ServerOption) *server.RpcServer {
+	sopts := []server.ServerOption{
+		server.SetRSAKey(cfg.CertFile, cfg.KeyFile),
+		server.WithClientCA(cfg.ClientCAFile),
+		server.WithName(cfg.Name),
+		server.WithAdvertise(cfg.Advertise),
+		server.WithHandlerTimeout(cfg.Timeout),
+		server.WithDebug(!cfg.DisableDebug),
+	}
+	if cfg.ClientAuth != "" {
+		sopts = append(sopts, server.WithClientAuth(clientAuth(cfg.ClientAuth)))
+	}
+	for _, mt := range cfg.MethodTimeouts {
+		sopts = append(sopts, server.WithMethodTimeout(mt.Method, mt.Timeout))
+	}
+	if Registry != nil {
+		sopts = append(sopts, server.WithRegistry(Registry))
+	}
+	if Logs != nil {
+		sopts = append(sopts, server.WithLogger(Logs))
+	}
+	return server.NewRpcServer(append(sopts, opts...)...)
+}
+
+func clientAuth(name string) tls.ClientAuthType {
+	switch name {
+	case "none":
+		return tls.NoClientCert
+	case "request":
+		return tls.RequestClientCert
+	case "require":
+		return tls.RequireAnyClientCert
+	case "verify_if_given":
+		return tls.VerifyClientCertIfGiven
+	case "require_and_verify":
+		return tls.RequireAndVerifyClientCert
+	}
+	panic("client auth unknown: " + name + " (available client auth: none request require verify_if_given require_and_verify)")
+}
 
+// InitTracing 根据jaeger配置初始化链路追踪，exporter为jaeger时使用OpenTracing，
+// otlp与stdout使用rpc/wrapper/otel，需要接入otel.NewCallWrapper与otel.NewHandlerWrapper
+func InitTracing(service string, cfg config.Jaeger) {
+	if service == "" {
+		service = strconv.Itoa(int(time.Now().Unix()))
+	}
+
+	switch cfg.Exporter {
+	case "", "jaeger":
+		initJaeger(service, cfg)
+	case "none":
+	case "otlp", "stdout":
+		initOtel(service, cfg)
+	default:
+		panic("tracing exporter unknown: " + cfg.Exporter + " (available exporter: jaeger otlp stdout none)")
+	}
+}
+
+func initOtel(service string, cfg config.Jaeger) {
+	sampler, err := otel.ParseSampler(cfg.Sampler, cfg.SampleRatio)
+	if err != nil {
+		panic(fmt.Sprintf("Error: init tracing:%v \n", err))
+	}
+
+	exporter := otel.NewStdoutExporter(nil)
+	if cfg.Exporter == "otlp" {
+		exporter = otel.NewOTLPExporter(cfg.Endpoint)
+	}
+	opts := []otel.Option{
+		otel.WithServiceName(service),
+		otel.WithSampler(sampler),
+		otel.WithExporter(exporter),
+	}
+	if Logs != nil {
+		opts = append(opts, otel.WithLogger(Logs))
+	}
+	Tracer = otel.NewTracer(opts...)
+	otel.SetTracer(Tracer)
 }
 
 func InitJaeger(service, address string) {
-	var err error
 	if service == "" {
 		service = strconv.Itoa(int(time.Now().Unix()))
 	}
+	initJaeger(service, config.Jaeger{Address: address})
+}
 
+func initJaeger(service string, jcfg config.Jaeger) {
+	var err error
 	cfg := jaegercfg.Configuration{
-		Sampler: &jaegercfg.SamplerConfig{
-			Type:  jaeger.SamplerTypeConst,
-			Param: 1,
-		},
+		Sampler: jaegerSampler(jcfg),
 		Reporter: &jaegercfg.ReporterConfig{
 			LogSpans: true,
 			//将span发送给jaeger-collector的服务中
-			CollectorEndpoint: address,
+			CollectorEndpoint: jcfg.Address,
 		},
 	}
 
@@ -98,3 +261,17 @@ func InitJaeger(service, address string) {
 		panic(fmt.Sprintf("Error: connect jaeger:%v \n", err))
 	}
 }
+
+// jaegerSampler jaeger客户端总是跟随上游的采样结果，parentbased_的取值与不带前缀的相同
+func jaegerSampler(cfg config.Jaeger) *jaegercfg.SamplerConfig {
+	switch cfg.Sampler {
+	case "", "always_on", "parentbased_always_on":
+		return &jaegercfg.SamplerConfig{Type: jaeger.SamplerTypeConst, Param: 1}
+	case "always_off", "parentbased_always_off":
+		return &jaegercfg.SamplerConfig{Type: jaeger.SamplerTypeConst, Param: 0}
+	case "traceidratio", "parentbased_traceidratio":
+		return &jaegercfg.SamplerConfig{Type: jaeger.SamplerTypeProbabilistic, Param: cfg.SampleRatio}
+	}
+	panic("sampler unknown: " + cfg.Sampler + " (available sampler: always_on always_off traceidratio " +
+		"parentbased_always_on parentbased_always_off parentbased_traceidratio)")
+}
@@ -0,0 +1,403 @@
+// micro 调用任意已注册服务的命令行工具
+//
+//	micro call [flags] <service> <Service.Method> '<json>'
+//	micro list [flags] <service> [Service[.Method]]
+//
+// 服务地址读取配置文件中的rpc_client.servers，也可以通过-address直接指定
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go-micro/config"
+	"go-micro/core/debug"
+	"go-micro/rpc/client"
+	"go-micro/rpc/codec"
+	"go-micro/rpc/registry"
+	"go-micro/rpc/server"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const usage = `usage:
+  micro call [flags] <service> <Service.Method> '<json>'
+  micro list [flags] <service> [Service[.Method]]
+
+run "micro <command> -h" for the flags of a command
+`
+
+// headers 可重复的-H参数
+type headers []string
+
+func (h *headers) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headers) Set(v string) error {
+	kv := strings.SplitN(v, ":", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return fmt.Errorf("header %q must be in the form Key: Value", v)
+	}
+	*h = append(*h, v)
+	return nil
+}
+
+// header 转换为请求头，同名的header保留多个值
+func (h headers) header() http.Header {
+	hdr := http.Header{}
+	for _, v := range h {
+		kv := strings.SplitN(v, ":", 2)
+		hdr.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+	return hdr
+}
+
+type options struct {
+	config        string
+	address       string
+	network       string
+	certFile      string
+	tlsServerName string
+	contentType   string
+	timeout       time.Duration
+	retries       int
+	idempotent    bool
+	headers       headers
+	debug         bool
+
+	// 双向认证时客户端的证书与私钥
+	clientCertFile string
+	clientKeyFile  string
+}
+
+func newFlagSet(name string, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&o.config, "config", "conf.yml", "config file, servers are read from rpc_client.servers")
+	fs.StringVar(&o.address, "address", "", "server address, overrides the config")
+	fs.StringVar(&o.network, "network", "", "network of the server, default tcp")
+	fs.StringVar(&o.certFile, "cert_file", "", "CA certificate to verify the server with")
+	fs.StringVar(&o.tlsServerName, "tls_server_name", "", "server name in the certificate")
+	fs.StringVar(&o.clientCertFile, "client_cert_file", "", "client certificate for mutual TLS, requires -client_key_file")
+	fs.StringVar(&o.clientKeyFile, "client_key_file", "", "private key of -client_cert_file")
+	fs.StringVar(&o.contentType, "content_type", "", "application/json | application/msgpack")
+	fs.DurationVar(&o.timeout, "timeout", client.DefaultRequestTimeout, "request timeout")
+	// 命令行调用的方法不一定幂等，默认不重试
+	fs.IntVar(&o.retries, "retries", 1, "number of attempts, a failed call is retried only if it was not sent or -idempotent is set")
+	fs.BoolVar(&o.idempotent, "idempotent", false, "the method is idempotent and can be retried after it was sent")
+	fs.Var(&o.headers, "H", "request header \"Key: Value\", can be repeated")
+	fs.BoolVar(&o.debug, "debug", false, "print the debug log of the client")
+	return fs
+}
+
+func parse(fs *flag.FlagSet, args []string, o *options) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// 调试日志与输出都写到stdout，默认关闭
+	if !o.debug {
+		debug.SetMode(debug.ReleaseMode)
+	}
+	return o.validate()
+}
+
+func (o *options) validate() error {
+	if o.retries < 1 {
+		return fmt.Errorf("-retries must be at least 1")
+	}
+	if o.timeout <= 0 {
+		return fmt.Errorf("-timeout must be positive")
+	}
+	if (o.clientCertFile == "") != (o.clientKeyFile == "") {
+		return fmt.Errorf("-client_cert_file and -client_key_file must be set together")
+	}
+	switch o.contentType {
+	case "", codec.ContentTypeJSON, codec.ContentTypeMsgpack:
+	default:
+		return fmt.Errorf("-content_type %q is not supported, use %s or %s", o.contentType, codec.ContentTypeJSON, codec.ContentTypeMsgpack)
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "call":
+		err = call(os.Args[2:])
+	case "list":
+		err = list(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func call(args []string) error {
+	var o options
+	fs := newFlagSet("call", &o)
+	if err := parse(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 || fs.NArg() > 3 {
+		return fmt.Errorf("usage: micro call [flags] <service> <Service.Method> '<json>'")
+	}
+	service, method, body := fs.Arg(0), fs.Arg(1), "{}"
+	if fs.NArg() == 3 {
+		body = fs.Arg(2)
+	}
+
+	req, err := decodeJSON(body)
+	if err != nil {
+		return fmt.Errorf("invalid request json: %v", err)
+	}
+
+	c, err := newClient(service, &o)
+	if err != nil {
+		return err
+	}
+
+	var rsp interface{}
+	if err := invoke(c, service, method, req, &rsp, &o); err != nil {
+		return err
+	}
+	return printJSON(rsp)
+}
+
+// list 通过服务端的Debug服务列出服务与方法，指定服务名时输出方法的参数结构
+func list(args []string) error {
+	var o options
+	fs := newFlagSet("list", &o)
+	if err := parse(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return fmt.Errorf("usage: micro list [flags] <service> [Service[.Method]]")
+	}
+	service := fs.Arg(0)
+
+	c, err := newClient(service, &o)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 1 {
+		var rsp server.ServicesResponse
+		if err := invoke(c, service, server.DebugServiceName+".Services", &server.ServicesRequest{}, &rsp, &o); err != nil {
+			return introspectionError(err)
+		}
+		for _, s := range rsp.Services {
+			for _, m := range s.Methods {
+				kind := ""
+				if m.Stream {
+					kind = " (stream)"
+				}
+				fmt.Printf("%s.%s%s\tcalls=%d\n", s.Name, m.Name, kind, m.Calls)
+			}
+		}
+		return nil
+	}
+
+	req := &server.DescribeRequest{Service: fs.Arg(1)}
+	if dot := strings.LastIndex(req.Service, "."); dot >= 0 {
+		req.Service, req.Method = req.Service[:dot], req.Service[dot+1:]
+	}
+	var rsp server.DescribeResponse
+	if err := invoke(c, service, server.DebugServiceName+".Describe", req, &rsp, &o); err != nil {
+		return introspectionError(err)
+	}
+	return printJSON(rsp.Service)
+}
+
+func introspectionError(err error) error {
+	if strings.Contains(err.Error(), "can't find service "+server.DebugServiceName) {
+		return fmt.Errorf("the server does not expose introspection, the Debug service is disabled by rpc_server.disable_debug or server.WithDebug(false): %v", err)
+	}
+	return err
+}
+
+func invoke(c client.RpcClient, service, method string, req, rsp interface{}, o *options) error {
+	r := c.NewRequest(service, method, req)
+	for k, vs := range o.headers.header() {
+		for _, v := range vs {
+			r.Header().Add(k, v)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+	return c.Call(ctx, r, rsp, o.callOptions()...)
+}
+
+func (o *options) callOptions() []client.CallOption {
+	opts := []client.CallOption{
+		client.WithRequestTimeout(o.timeout),
+		client.WithRetries(o.retries),
+	}
+	if o.idempotent {
+		opts = append(opts, client.WithIdempotent(true))
+	}
+	if o.address != "" {
+		opts = append(opts, client.WithAddress(o.address))
+	}
+	return opts
+}
+
+// newClient 按配置文件创建客户端，命令行参数覆盖配置中对应服务的设置
+func newClient(service string, o *options) (client.RpcClient, error) {
+	cfg, err := loadConfig(o.config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := cfg.RpcClient.Servers[service]
+	if o.address != "" {
+		s.Address = o.address
+	}
+	if o.network != "" {
+		s.Network = o.network
+	}
+	if o.certFile != "" {
+		s.CertFile = o.certFile
+	}
+	if o.tlsServerName != "" {
+		s.TlsServerName = o.tlsServerName
+	}
+	if o.clientCertFile != "" {
+		s.ClientCertFile, s.ClientKeyFile = o.clientCertFile, o.clientKeyFile
+	}
+	if o.contentType != "" {
+		s.ContentType = o.contentType
+	}
+	if s.ContentType == codec.ContentTypeProtobuf {
+		return nil, fmt.Errorf("%s needs the generated message types and is not supported", codec.ContentTypeProtobuf)
+	}
+
+	var opts []client.DialOption
+	for name, sc := range cfg.RpcClient.Servers {
+		if name == service {
+			continue
+		}
+		opts = append(opts, client.SetServer(name, newServer(sc)))
+	}
+	opts = append(opts, client.SetServer(service, newServer(s)))
+
+	if cfg.Registry.Name == "file" {
+		r, err := registry.NewFileRegistry(cfg.Registry.Path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithRegistry(r))
+	}
+
+	if s.Address == "" && cfg.Registry.Name != "file" {
+		return nil, fmt.Errorf("no address for service %s, set rpc_client.servers.%s in %s or pass -address", service, service, o.config)
+	}
+	return client.NewClient(opts...), nil
+}
+
+func newServer(s config.Server) *client.Server {
+	if s.Network == "" {
+		s.Network = "tcp"
+	}
+	return &client.Server{
+		CertFile:       s.CertFile,
+		TlsServerName:  s.TlsServerName,
+		ClientCertFile: s.ClientCertFile,
+		ClientKeyFile:  s.ClientKeyFile,
+		NetWork:        s.Network,
+		Address:        s.Address,
+		ContentType:    s.ContentType,
+	}
+}
+
+// loadConfig 读取配置文件，配置文件不存在时返回空配置
+func loadConfig(path string) (*config.Config, error) {
+	cfg := &config.Config{}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return cfg, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read config %s: %v", path, err)
+	}
+	if err := v.UnmarshalKey("rpc_client", &cfg.RpcClient); err != nil {
+		return nil, fmt.Errorf("parse config %s: %v", path, err)
+	}
+	if err := v.UnmarshalKey("registry", &cfg.Registry); err != nil {
+		return nil, fmt.Errorf("parse config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// decodeJSON 解析请求参数，整数保持为int64，避免msgpack中被编码为浮点数
+func decodeJSON(s string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the json value")
+	}
+	return normalize(v), nil
+}
+
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+	case map[interface{}]interface{}:
+		// msgpack解析出的map，转换后才能输出为json
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalize(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalize(e)
+		}
+	}
+	return v
+}
+
+func printJSON(v interface{}) error {
+	b, err := json.Marshal(normalize(v))
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	json.Indent(&out, b, "", "  ")
+	fmt.Println(out.String())
+	return nil
+}
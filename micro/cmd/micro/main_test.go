@@ -0,0 +1,159 @@
+package main
+
+import (
+	"go-micro/config"
+	"go-micro/rpc/client"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		ok    bool
+	}{
+		{"X-Token: abc", true},
+		{"X-Empty:", true},
+		{"X-Url: http://host:8080", true},
+		{"X-Token", false},
+		{": abc", false},
+	} {
+		var h headers
+		if err := h.Set(tc.value); (err == nil) != tc.ok {
+			t.Errorf("Set(%q) = %v, want ok %v", tc.value, err, tc.ok)
+		}
+	}
+
+	h := headers{"X-Token: abc", "x-tag: a", "X-Tag:b", "X-Url: http://host:8080"}
+	want := http.Header{
+		"X-Token": {"abc"},
+		"X-Tag":   {"a", "b"},
+		"X-Url":   {"http://host:8080"},
+	}
+	if got := h.header(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("header() = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want interface{}
+		err  bool
+	}{
+		{in: `{}`, want: map[string]interface{}{}},
+		{in: `{"id": 1, "price": 1.5}`, want: map[string]interface{}{"id": int64(1), "price": 1.5}},
+		{in: `{"ids": [1, 2], "user": {"age": 30}}`, want: map[string]interface{}{
+			"ids":  []interface{}{int64(1), int64(2)},
+			"user": map[string]interface{}{"age": int64(30)},
+		}},
+		{in: `9007199254740993`, want: int64(9007199254740993)},
+		{in: `"text"`, want: "text"},
+		{in: `{"id": 1} `, want: map[string]interface{}{"id": int64(1)}},
+		{in: `{"id": 1`, err: true},
+		{in: `{"id": 1} {}`, err: true},
+		{in: `{} x`, err: true},
+	} {
+		got, err := decodeJSON(tc.in)
+		if (err != nil) != tc.err {
+			t.Errorf("decodeJSON(%s) error = %v, want error %v", tc.in, err, tc.err)
+			continue
+		}
+		if !tc.err && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("decodeJSON(%s) = %#v, want %#v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeMsgpackMap(t *testing.T) {
+	in := map[interface{}]interface{}{"a": []interface{}{map[interface{}]interface{}{1: "x"}}}
+	want := map[string]interface{}{"a": []interface{}{map[string]interface{}{"1": "x"}}}
+	if got := normalize(in); !reflect.DeepEqual(got, want) {
+		t.Fatalf("normalize() = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		err  string
+	}{
+		{args: []string{"pay", "Pay.Create"}},
+		{args: []string{"-retries", "3", "-timeout", "1s", "-content_type", "application/msgpack", "pay", "Pay.Create"}},
+		{args: []string{"-retries", "0", "pay"}, err: "-retries"},
+		{args: []string{"-timeout", "0s", "pay"}, err: "-timeout"},
+		{args: []string{"-content_type", "application/protobuf", "pay"}, err: "-content_type"},
+		{args: []string{"-client_cert_file", "client.pem", "-client_key_file", "client.key", "pay"}},
+		{args: []string{"-client_cert_file", "client.pem", "pay"}, err: "-client_key_file"},
+	} {
+		var o options
+		err := parse(newFlagSet("call", &o), tc.args, &o)
+		if tc.err == "" && err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%v: got %v, want an error about %s", tc.args, err, tc.err)
+		}
+	}
+
+	// 默认只调用一次，非幂等的方法不会被重复执行
+	var o options
+	if err := parse(newFlagSet("call", &o), []string{"pay", "Pay.Create"}, &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.retries != 1 || o.timeout <= 0 || o.timeout > time.Minute || o.idempotent {
+		t.Fatalf("defaults: retries=%d timeout=%v idempotent=%v", o.retries, o.timeout, o.idempotent)
+	}
+	if idempotent(o.callOptions()) != nil {
+		t.Fatal("the call is marked idempotent by default")
+	}
+
+	// -idempotent允许发送后失败的调用重试
+	o = options{}
+	if err := parse(newFlagSet("call", &o), []string{"-retries", "3", "-idempotent", "pay", "Pay.Get"}, &o); err != nil {
+		t.Fatal(err)
+	}
+	if v := idempotent(o.callOptions()); v == nil || !*v {
+		t.Fatalf("idempotent = %v, want true", v)
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	got := newServer(config.Server{
+		CertFile:       "ca.pem",
+		TlsServerName:  "example.com",
+		ClientCertFile: "client.pem",
+		ClientKeyFile:  "client.key",
+		Address:        "127.0.0.1:8080",
+		ContentType:    "application/msgpack",
+	})
+	want := &client.Server{
+		CertFile:       "ca.pem",
+		TlsServerName:  "example.com",
+		ClientCertFile: "client.pem",
+		ClientKeyFile:  "client.key",
+		NetWork:        "tcp",
+		Address:        "127.0.0.1:8080",
+		ContentType:    "application/msgpack",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+// idempotent 调用选项中的幂等标记，CallOptions不导出该字段
+func idempotent(opts []client.CallOption) *bool {
+	var o client.CallOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	v := reflect.ValueOf(o).FieldByName("idempotent")
+	if v.IsNil() {
+		return nil
+	}
+	b := v.Elem().Bool()
+	return &b
+}
@@ -5,8 +5,21 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 	"go-micro/config"
+	"sync"
 )
 
+var (
+	hookLock    sync.Mutex
+	configHooks []func(v *viper.Viper)
+)
+
+// OnConfigChange 注册配置文件变化时执行的方法，执行时新的配置已经解析到Config
+func OnConfigChange(fn func(v *viper.Viper)) {
+	hookLock.Lock()
+	configHooks = append(configHooks, fn)
+	hookLock.Unlock()
+}
+
 func initViper(config *config.Config, configPath string) *viper.Viper {
 	// 创建 viper 配置文件的处理器
 	v := viper.New() // 可以自动检测配置文件的变化而更新配置信息
@@ -30,6 +43,13 @@ func initViper(config *config.Config, configPath string) *viper.Viper {
 	v.OnConfigChange(func(e fsnotify.Event) {
 		fmt.Println("Config file changed:", e.Name)
 		cfg(v)
+
+		hookLock.Lock()
+		hooks := configHooks
+		hookLock.Unlock()
+		for _, fn := range hooks {
+			fn(v)
+		}
 	})
 
 	cfg(v)
@@ -14,6 +14,7 @@ type Config struct {
 	Pay
 
 	Jaeger
+	Registry  `mapstructure:"registry"`
 	RpcClient `mapstructure:"rpc_client"`
 	RpcServer `mapstructure:"rpc_server"`
 
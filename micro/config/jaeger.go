@@ -2,4 +2,13 @@ package config
 
 type Jaeger struct {
 	Address string
+	// jaeger | otlp | stdout | none，默认jaeger，otlp与stdout使用rpc/wrapper/otel
+	Exporter string `mapstructure:"exporter"`
+	// otlp/http的地址，默认http://127.0.0.1:4318/v1/traces
+	Endpoint string `mapstructure:"endpoint"`
+	// always_on | always_off | traceidratio | parentbased_always_on | parentbased_always_off | parentbased_traceidratio，
+	// 默认parentbased_always_on
+	Sampler string `mapstructure:"sampler"`
+	// traceidratio的采样比例，0到1
+	SampleRatio float64 `mapstructure:"sample_ratio"`
 }
@@ -0,0 +1,8 @@
+package config
+
+type Registry struct {
+	// memory | file
+	Name string `mapstructure:"name"`
+	// file注册中心的目录
+	Path string `mapstructure:"path"`
+}
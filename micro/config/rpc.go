@@ -1,8 +1,96 @@
 package config
 
+import "time"
+
 type RpcServer struct {
 	CertFile string `mapstructure:"cert_file"`
 	KeyFile  string `mapstructure:"key_file"`
+	// 验证客户端证书的CA，设置后开启双向认证
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// none | request | require | verify_if_given | require_and_verify，设置client_ca_file时默认require_and_verify
+	ClientAuth string `mapstructure:"client_auth"`
+	// 注册到注册中心的服务名
+	Name string `mapstructure:"name"`
+	// 注册到注册中心的地址，为空时使用监听地址
+	Advertise string `mapstructure:"advertise"`
+	// 服务端限流
+	RateLimit RateLimit `mapstructure:"rate_limit"`
+	// 服务端认证与鉴权
+	Auth Auth `mapstructure:"auth"`
+	// handler的默认超时时间，如3s，为0时只受客户端的超时限制
+	Timeout time.Duration `mapstructure:"timeout"`
+	// 单个方法的超时时间，优先于timeout
+	MethodTimeouts []MethodTimeout `mapstructure:"method_timeouts"`
+	// 不注册内置的Debug服务，Debug服务供micro list/describe使用，默认注册，
+	// 开启认证时通过auth.rules中的Debug.*规则限制访问
+	DisableDebug bool `mapstructure:"disable_debug"`
+}
+
+type Auth struct {
+	JWT     JWT      `mapstructure:"jwt"`
+	APIKeys []APIKey `mapstructure:"api_keys"`
+	// 按方法的鉴权规则，没有匹配规则的方法只要求通过认证
+	Rules []AuthRule `mapstructure:"rules"`
+}
+
+type JWT struct {
+	// HS256 | RS256
+	Algorithm string `mapstructure:"algorithm"`
+	// HS256的密钥
+	Secret string `mapstructure:"secret"`
+	// RS256的公钥文件，PEM格式
+	PublicKeyFile string `mapstructure:"public_key_file"`
+	// 不为空时校验iss与aud
+	Issuer   string `mapstructure:"issuer"`
+	Audience string `mapstructure:"audience"`
+}
+
+// APIKey 静态的api key，通过X-Api-Key请求头传递
+type APIKey struct {
+	Key     string   `mapstructure:"key"`
+	Subject string   `mapstructure:"subject"`
+	Roles   []string `mapstructure:"roles"`
+	Scopes  []string `mapstructure:"scopes"`
+}
+
+type AuthRule struct {
+	// Service.Method | Service.* | *
+	Method string `mapstructure:"method"`
+	// 不需要认证
+	Public bool `mapstructure:"public"`
+	// 需要拥有其中任意一个角色
+	Roles []string `mapstructure:"roles"`
+	// 需要拥有全部的scope
+	Scopes []string `mapstructure:"scopes"`
+}
+
+type MethodTimeout struct {
+	// Service.Method
+	Method  string        `mapstructure:"method"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type RateLimit struct {
+	Rules []RateLimitRule `mapstructure:"rules"`
+}
+
+// RateLimitRule 一条限流规则，一个请求需要通过所有匹配的规则
+type RateLimitRule struct {
+	// Service.Method | Service.* ，为空时匹配所有方法
+	Method string `mapstructure:"method"`
+	// global | method | header，默认global
+	Key string `mapstructure:"key"`
+	// key为header时按该header的值分别限流，如调用方服务名、用户id
+	Header string `mapstructure:"header"`
+	// token_bucket | sliding_window，默认token_bucket
+	Algorithm string `mapstructure:"algorithm"`
+	// 每window时长允许的请求数，不大于0时不限流
+	Rate   int           `mapstructure:"rate"`
+	Window time.Duration `mapstructure:"window"`
+	// 令牌桶的容量，默认与rate相同
+	Burst int `mapstructure:"burst"`
+	// 通过redis等共享缓存计数，多个副本共享限额，总是使用滑动窗口；缓存只在进程内有效时规则被拒绝
+	Distributed bool `mapstructure:"distributed"`
 }
 
 type RpcClient struct {
@@ -12,6 +100,11 @@ type RpcClient struct {
 type Server struct {
 	CertFile      string `mapstructure:"cert_file"`
 	TlsServerName string `mapstructure:"tls_server_name"`
-	Network       string `mapstructure:"network"`
-	Address       string `mapstructure:"address"`
+	// 双向认证时客户端的证书与私钥
+	ClientCertFile string `mapstructure:"client_cert_file"`
+	ClientKeyFile  string `mapstructure:"client_key_file"`
+	Network        string `mapstructure:"network"`
+	Address        string `mapstructure:"address"`
+	// application/json | application/msgpack | application/protobuf
+	ContentType string `mapstructure:"content_type"`
 }
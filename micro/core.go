@@ -5,6 +5,10 @@ import (
 	"github.com/spf13/viper"
 	"go-micro/config"
 	"go-micro/rpc/client"
+	"go-micro/rpc/registry"
+	"go-micro/rpc/wrapper/auth"
+	"go-micro/rpc/wrapper/otel"
+	"go-micro/rpc/wrapper/ratelimit"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"io"
@@ -19,12 +23,31 @@ var (
 	DB     *gorm.DB
 
 	Jaefer io.Closer
+	// jaeger.exporter为otlp或stdout时的Tracer
+	Tracer *otel.Tracer
 
 	RpcClient client.RpcClient
+	Registry  registry.Registry
+
+	// 服务端限流，规则来自rpc_server.rate_limit，配置文件变化时自动更新
+	// 使用server.WithHandlerWrap(ratelimit.NewHandlerWrapper(RateLimiter))接入
+	RateLimiter *ratelimit.Limiter
+
+	// 服务端认证与鉴权，规则来自rpc_server.auth，配置文件变化时自动更新
+	// 使用server.WithHandlerWrap(auth.NewHandlerWrapper(Authenticator))接入
+	Authenticator *auth.Authenticator
 )
 
 var CaptchaStore = base64Captcha.DefaultMemStore
 
 func Close() {
-	Jaefer.Close()
+	if Jaefer != nil {
+		Jaefer.Close()
+	}
+	if Tracer != nil {
+		Tracer.Close()
+	}
+	if RpcClient != nil {
+		RpcClient.Close()
+	}
 }
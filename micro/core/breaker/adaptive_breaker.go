@@ -0,0 +1,108 @@
+package breaker
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// adaptiveBreaker Google SRE的客户端自适应限流，窗口内请求数为requests，成功数为accepts，
+// 以 max(0, (requests - k*accepts) / (requests + 1)) 的概率在本地拒绝请求。
+// 下游恢复后成功数增加，拒绝的概率随之下降，不需要半开放状态。
+// 有请求被拒绝时State返回StateHalfOpen，否则返回StateClosed
+type adaptiveBreaker struct {
+	name string
+	opt  *option
+
+	mutex  sync.Mutex
+	state  State
+	window *rollingWindow
+}
+
+func newAdaptiveBreaker(opt *option) *adaptiveBreaker {
+	return &adaptiveBreaker{
+		name:   opt.name,
+		opt:    opt,
+		state:  StateClosed,
+		window: newRollingWindow(opt.window, opt.buckets, opt.now()),
+	}
+}
+
+func (b *adaptiveBreaker) Name() string {
+	return b.name
+}
+
+func (b *adaptiveBreaker) Counts() Counts {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.window.counts(b.opt.now())
+}
+
+func (b *adaptiveBreaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.update(b.dropRatio())
+	return b.state
+}
+
+func (b *adaptiveBreaker) Do(req func() error) error {
+	return doWithAdmission(b, req, nil, defaultAcceptable)
+}
+
+func (b *adaptiveBreaker) DoWithAcceptable(req func() error, acceptable Acceptable) error {
+	return doWithAdmission(b, req, nil, acceptable)
+}
+
+func (b *adaptiveBreaker) DoWithFallback(req func() error, fallback func(err error) error) error {
+	return doWithAdmission(b, req, fallback, defaultAcceptable)
+}
+
+func (b *adaptiveBreaker) DoWithFallbackAcceptable(req func() error, fallback func(err error) error, acceptable Acceptable) error {
+	return doWithAdmission(b, req, fallback, acceptable)
+}
+
+// 拒绝请求的概率
+func (b *adaptiveBreaker) dropRatio() float64 {
+	c := b.window.counts(b.opt.now())
+	if c.Request < b.opt.minRequests {
+		return 0
+	}
+	requests, accepts := float64(c.Request), float64(c.TotaolSuccess)
+	return math.Max(0, (requests-b.opt.k*accepts)/(requests+1))
+}
+
+func (b *adaptiveBreaker) before() (uint64, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ratio := b.dropRatio()
+	b.update(ratio)
+	if ratio > 0 && rand.Float64() < ratio {
+		// 被拒绝的请求也计入请求数
+		b.window.add(b.opt.now(), false)
+		return 0, ErrOpenState
+	}
+	return 0, nil
+}
+
+func (b *adaptiveBreaker) after(_ uint64, success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.window.add(b.opt.now(), success)
+}
+
+func (b *adaptiveBreaker) update(ratio float64) {
+	state := StateClosed
+	if ratio > 0 {
+		state = StateHalfOpen
+	}
+	if b.state == state {
+		return
+	}
+
+	prev := b.state
+	b.state = state
+	if b.opt.onStateChange != nil {
+		b.opt.onStateChange(b.name, prev, state)
+	}
+}
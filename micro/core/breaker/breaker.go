@@ -19,3 +19,31 @@ type (
 		DoWithFallbackAcceptable(req func() error, fallback func(err error) error, acceptable Acceptable) error
 	}
 )
+
+// admission 熔断器的准入与结果统计，before返回的generation在状态变化后失效，
+// 状态变化之前放行的请求结果不再计入新的状态
+type admission interface {
+	before() (generation uint64, err error)
+	after(generation uint64, success bool)
+}
+
+func doWithAdmission(a admission, req func() error, fallback func(err error) error, acceptable Acceptable) error {
+	generation, err := a.before()
+	if err != nil {
+		if fallback != nil {
+			return fallback(err)
+		}
+		return err
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			a.after(generation, false)
+			panic(e)
+		}
+	}()
+
+	err = req()
+	a.after(generation, acceptable(err))
+	return err
+}
@@ -8,8 +8,11 @@ var (
 	options  = make(map[string][]Option)
 )
 
+// Opt 设置name对应熔断器的参数，需要在第一次使用该熔断器之前调用
 func Opt(name string, opts ...Option) {
+	lock.Lock()
 	options[name] = opts
+	lock.Unlock()
 }
 
 // Do calls Breaker.Do on the Breaker with given name.
@@ -54,16 +57,8 @@ func GetBreaker(name string) Breaker {
 	lock.Lock()
 	b, ok = breakers[name]
 	if !ok {
-
-		opts, ok := options[name]
-		if !ok {
-			opts = []Option{WithName(name)}
-		} else {
-			opts = append(opts, WithName(name))
-		}
-
+		opts := append(append([]Option{}, options[name]...), WithName(name))
 		b = NewBreaker(opts...)
-
 		breakers[name] = b
 	}
 	lock.Unlock()
@@ -71,6 +66,17 @@ func GetBreaker(name string) Breaker {
 	return b
 }
 
+// Range 遍历已经创建的熔断器
+func Range(fn func(b Breaker) bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	for _, b := range breakers {
+		if !fn(b) {
+			return
+		}
+	}
+}
+
 // NoBreakerFor disables the circuit breaker for the given name.
 //func NoBreakerFor(name string) {
 //	lock.Lock()
@@ -11,42 +11,55 @@ var (
 	ErrTooManyRequest = errors.New("太多请求量")
 )
 
+// CircuitBreaker 连续失败熔断器，所有状态与计数都在mutex保护下读写。
+// 每次状态变化generation加1，状态变化之前放行的请求结果不再计入新的状态，
+// 半开放状态最多放行maxRequests个请求，连续成功maxRequests次后恢复
 type CircuitBreaker struct {
 	name string
 
 	opt *option
 
-	////最大的请求次数
-	//maxRequests uint32
-	//
-	////设置熔断超时时限
-	//timeout time.Duration
-	//
-	////自定义熔断验证方法，判断是否开启熔断
-	//readyToTrip func(counts Counts) bool
-	//
-	////在熔断状态发生改变时
-	//onStateChange func(name string, from State, to State)
-
 	mutex sync.Mutex
 
 	//状态
 	state State
 
-	//同级熔断器次数
+	//状态的版本，每次状态变化加1
+	generation uint64
+
+	//当前状态下的统计次数
 	counts Counts
 
 	//记录熔断时限
 	expiry time.Time
 }
 
-func NewBreaker(opts ...Option) *CircuitBreaker {
-	cb := new(CircuitBreaker)
+// NewBreaker 按WithStrategy选择的策略创建熔断器，默认为连续失败熔断的CircuitBreaker
+func NewBreaker(opts ...Option) Breaker {
+	opt := NewOption()
+	for _, o := range opts {
+		o(opt)
+	}
+
+	switch opt.strategy {
+	case StrategyRolling:
+		return newRollingBreaker(opt)
+	case StrategyAdaptive:
+		return newAdaptiveBreaker(opt)
+	}
+	return newCircuitBreaker(opt)
+}
+
+func NewCircuitBreaker(opts ...Option) *CircuitBreaker {
 	opt := NewOption()
 	for _, o := range opts {
 		o(opt)
 	}
+	return newCircuitBreaker(opt)
+}
 
+func newCircuitBreaker(opt *option) *CircuitBreaker {
+	cb := new(CircuitBreaker)
 	cb.name = opt.name
 	cb.state = StateClosed
 	cb.opt = opt
@@ -66,157 +79,125 @@ func (cb *CircuitBreaker) Counts() Counts {
 
 func (cb *CircuitBreaker) State() State {
 	cb.mutex.Lock()
-	cb.mutex.Unlock()
-	return cb.currentState()
+	defer cb.mutex.Unlock()
+	return cb.currentState(cb.opt.now())
 }
 
-/*
-DoWithAcceptable(req func() error, acceptable Acceptable) error
-
-		DoWithFallback(req func() error, fallback func(err error) error) error
-
-		DoWithFallbackAcceptable(req func() error, fallback func(err error) error, acceptable Acceptable) error
-*/
-
 func (cb *CircuitBreaker) Do(req func() error) error {
-	return cb.do(req, nil, defaultAcceptable)
+	return doWithAdmission(cb, req, nil, defaultAcceptable)
 }
 
 func (cb *CircuitBreaker) DoWithAcceptable(req func() error, acceptable Acceptable) error {
-	return cb.do(req, nil, acceptable)
+	return doWithAdmission(cb, req, nil, acceptable)
 }
 
 func (cb *CircuitBreaker) DoWithFallback(req func() error, fallback func(err error) error) error {
-	return cb.do(req, fallback, defaultAcceptable)
+	return doWithAdmission(cb, req, fallback, defaultAcceptable)
 }
 
 func (cb *CircuitBreaker) DoWithFallbackAcceptable(req func() error, fallback func(err error) error, acceptable Acceptable) error {
-	return cb.do(req, fallback, acceptable)
+	return doWithAdmission(cb, req, fallback, acceptable)
 }
 
-// 熔断器执行请求
-// req		：正常执行的方法
-// fallback	：熔断后执行的方法
-// acceptable：则是判断正常执行方法之后的异常是否可以通过，否则失败
-func (cb *CircuitBreaker) do(req func() error, fallback func(err error) error, acceptable func(err error) bool) error {
-
-	//读取当前的熔断状态，并判断是否处理方法
-	if err := cb.accept(); err != nil {
+// 判断当前的熔断器是否接受处理方法，返回放行时的generation
+func (cb *CircuitBreaker) before() (uint64, error) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
 
-		//当处于熔断状态就执行降级方法
-		if fallback != nil {
-			return fallback(err)
+	//根据熔断状态判断
+	switch cb.currentState(cb.opt.now()) {
+	case StateOpen:
+		return 0, ErrOpenState
+	case StateHalfOpen:
+		if cb.counts.Request >= cb.opt.maxRequests {
+			return 0, ErrTooManyRequest
 		}
-
-		return err
 	}
 
-	defer func() {
-		if e := recover(); e != nil {
-			cb.failure()
-			panic(e)
-		}
-	}()
+	cb.counts.request()
+	return cb.generation, nil
+}
 
-	//执行实际方法
-	err := req()
-	//判断异常是否为调度失败
-	if acceptable(err) {
-		cb.success()
-	} else {
-		cb.failure()
-	}
+// 统计请求结果，状态已经变化时丢弃
+func (cb *CircuitBreaker) after(generation uint64, success bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
 
-	return err
+	now := cb.opt.now()
+	state := cb.currentState(now)
+	if generation != cb.generation {
+		return
+	}
 
+	if success {
+		cb.success(state, now)
+	} else {
+		cb.failure(state, now)
+	}
 }
 
-func (cb *CircuitBreaker) success() {
-	switch cb.state {
+func (cb *CircuitBreaker) success(state State, now time.Time) {
+	switch state {
 	case StateClosed:
 		//统计成功的次数
 		cb.counts.success()
 
 	case StateHalfOpen:
-		//半开放的状态下失败，直接转化为开放状态
+		//半开放的状态下连续成功，恢复为关闭状态
 		cb.counts.success()
 		if cb.counts.ConsecutiveSuccess >= cb.opt.maxRequests {
-			cb.setState(StateClosed)
+			cb.setState(StateClosed, now)
 		}
 	}
 }
 
-func (cb *CircuitBreaker) failure() {
-	switch cb.state {
+func (cb *CircuitBreaker) failure(state State, now time.Time) {
+	switch state {
 	case StateClosed:
 		//统计失败的次数
 		cb.counts.failure()
 
 		if cb.opt.readyToTrip(cb.counts) {
-			cb.setState(StateOpen)
+			cb.setState(StateOpen, now)
 		}
 	case StateHalfOpen:
 		//半开放的状态下失败，直接转化为开放状态
-		cb.setState(StateOpen)
+		cb.setState(StateOpen, now)
 	}
 }
 
-// 判断当前的熔断器是否接受处理方法
-func (cb *CircuitBreaker) accept() error {
-
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
-
-	state := cb.currentState()
-
-	//根据熔断状态判断
-	if state == StateOpen {
-		return ErrOpenState
-	} else if state == StateHalfOpen && cb.counts.Request >= cb.opt.maxRequests {
-		return ErrTooManyRequest
-	}
-
-	cb.counts.request()
-	return nil
-}
-
-// 获取当前是否熔断
-func (cb *CircuitBreaker) currentState() State {
-	now := time.Now()
-	switch cb.state {
-	case StateClosed:
-	case StateOpen:
-		//如果熔断超过时限，开始半开放状态
-		if cb.expiry.Before(now) {
-			cb.setState(StateHalfOpen)
-		}
+// 获取当前是否熔断，调用方需要持有mutex
+func (cb *CircuitBreaker) currentState(now time.Time) State {
+	//如果熔断超过时限，开始半开放状态
+	if cb.state == StateOpen && !cb.expiry.After(now) {
+		cb.setState(StateHalfOpen, now)
 	}
 	return cb.state
 }
 
-// 设置熔断
-func (cb *CircuitBreaker) setState(state State) {
+// 设置熔断，调用方需要持有mutex，onStateChange中不能再调用该熔断器
+func (cb *CircuitBreaker) setState(state State, now time.Time) {
 	if cb.state == state {
 		return
 	}
 
 	prev := cb.state
 	cb.state = state
-	cb.toNewExpiry(time.Now())
+	cb.toNewGeneration(now)
 
 	if cb.opt.onStateChange != nil {
 		cb.opt.onStateChange(cb.name, prev, cb.state)
 	}
 }
 
-func (cb *CircuitBreaker) toNewExpiry(now time.Time) {
+func (cb *CircuitBreaker) toNewGeneration(now time.Time) {
+	cb.generation++
 	//重置，计数
 	cb.counts.clear()
 
 	var zero time.Time
 
 	switch cb.state {
-	case StateClosed:
 	case StateOpen:
 		cb.expiry = now.Add(cb.opt.timeout)
 	default:
@@ -0,0 +1,185 @@
+package breaker
+
+import (
+	"go-micro/internal/fakeclock"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTrips(t *testing.T) {
+	clock := fakeclock.New()
+	cb := NewCircuitBreaker(withClock(clock), WithTimeout(time.Second))
+
+	// defaultReadyToTrip 连续失败6次后熔断
+	for i := 0; i < 6; i++ {
+		if err := cb.Do(result(true)); err != errTestDown {
+			t.Fatalf("call %d got %v", i, err)
+		}
+	}
+	if s := cb.State(); s != StateOpen {
+		t.Fatalf("state = %v, want open", s)
+	}
+	if err := cb.Do(result(false)); err != ErrOpenState {
+		t.Fatalf("got %v, want %v", err, ErrOpenState)
+	}
+
+	clock.Add(time.Second)
+	if s := cb.State(); s != StateHalfOpen {
+		t.Fatalf("state = %v after timeout, want half-open", s)
+	}
+	if err := cb.Do(result(false)); err != nil {
+		t.Fatal(err)
+	}
+	if s := cb.State(); s != StateClosed {
+		t.Fatalf("state = %v after a successful probe, want closed", s)
+	}
+}
+
+func TestCircuitBreakerFallback(t *testing.T) {
+	cb := NewCircuitBreaker(WithReadyToTrip(func(c Counts) bool { return c.ConsecutiveFailure >= 1 }))
+	cb.Do(result(true))
+
+	var got error
+	err := cb.DoWithFallback(result(false), func(err error) error {
+		got = err
+		return nil
+	})
+	if err != nil || got != ErrOpenState {
+		t.Fatalf("fallback got %v and returned %v", got, err)
+	}
+}
+
+// 熔断之前放行的请求在熔断后返回，结果不能影响新的状态
+func TestCircuitBreakerDiscardsStaleResults(t *testing.T) {
+	clock := fakeclock.New()
+	cb := NewCircuitBreaker(withClock(clock), WithTimeout(time.Second), WithMaxRequest(1),
+		WithReadyToTrip(func(c Counts) bool { return c.ConsecutiveFailure >= 1 }))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- cb.Do(func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	// 慢请求执行期间熔断并进入半开放
+	cb.Do(result(true))
+	clock.Add(time.Second)
+	if s := cb.State(); s != StateHalfOpen {
+		t.Fatalf("state = %v, want half-open", s)
+	}
+
+	close(release)
+	<-done
+	// 旧请求的成功不能关闭熔断器，也不能占用半开放的探测名额
+	if s := cb.State(); s != StateHalfOpen {
+		t.Fatalf("stale result changed the state to %v", s)
+	}
+	if c := cb.Counts(); c.Request != 0 || c.TotaolSuccess != 0 {
+		t.Fatalf("stale result was counted: %+v", c)
+	}
+	if err := cb.Do(result(false)); err != nil {
+		t.Fatalf("probe got %v", err)
+	}
+	if s := cb.State(); s != StateClosed {
+		t.Fatalf("state = %v after the probe, want closed", s)
+	}
+}
+
+// 半开放状态下并发的请求最多放行maxRequests个
+func TestCircuitBreakerHalfOpenConcurrent(t *testing.T) {
+	clock := fakeclock.New()
+	const maxRequests = 3
+	cb := NewCircuitBreaker(withClock(clock), WithTimeout(time.Second), WithMaxRequest(maxRequests),
+		WithReadyToTrip(func(c Counts) bool { return c.ConsecutiveFailure >= 1 }))
+	cb.Do(result(true))
+	clock.Add(time.Second)
+
+	var admitted, rejected int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := cb.Do(func() error {
+				atomic.AddInt32(&admitted, 1)
+				<-release
+				return nil
+			})
+			if err == ErrTooManyRequest {
+				atomic.AddInt32(&rejected, 1)
+			}
+		}()
+	}
+
+	// 被拒绝的请求立即返回，放行的请求阻塞到release
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&rejected) < 50-maxRequests && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if admitted != maxRequests || rejected != 50-maxRequests {
+		t.Fatalf("admitted %d, rejected %d, want %d admitted", admitted, rejected, maxRequests)
+	}
+	if s := cb.State(); s != StateClosed {
+		t.Fatalf("state = %v after %d successful probes, want closed", s, maxRequests)
+	}
+}
+
+// 并发调用在race detector下运行，状态变化的回调必须成对且顺序合法
+func TestCircuitBreakerConcurrentDo(t *testing.T) {
+	var mu sync.Mutex
+	var transitions [][2]State
+	cb := NewCircuitBreaker(
+		WithTimeout(time.Millisecond),
+		WithMaxRequest(2),
+		WithOnStateChange(func(name string, from, to State) {
+			mu.Lock()
+			transitions = append(transitions, [2]State{from, to})
+			mu.Unlock()
+		}),
+	)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				cb.Do(result((g+i)%10 != 0))
+				cb.State()
+				cb.Counts()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	prev := StateClosed
+	for _, tr := range transitions {
+		if tr[0] != prev {
+			t.Fatalf("transition %v -> %v does not start from the previous state %v", tr[0], tr[1], prev)
+		}
+		switch {
+		case tr[0] == StateClosed && tr[1] == StateOpen:
+		case tr[0] == StateOpen && tr[1] == StateHalfOpen:
+		case tr[0] == StateHalfOpen && (tr[1] == StateOpen || tr[1] == StateClosed):
+		default:
+			t.Fatalf("invalid transition %v -> %v", tr[0], tr[1])
+		}
+		prev = tr[1]
+	}
+	if len(transitions) == 0 {
+		t.Fatal("the breaker never tripped")
+	}
+}
@@ -5,6 +5,28 @@ import "time"
 var (
 	DefaultTimeout           = time.Duration(60) * time.Second
 	DefaultMaxRequest uint32 = 1
+
+	//滑动窗口的时长与分桶数
+	DefaultWindow        = 10 * time.Second
+	DefaultWindowBuckets = 10
+	//滑动窗口内触发熔断的错误率
+	DefaultErrorRatio = 0.5
+	//滑动窗口内的请求数达到该值才会计算错误率
+	DefaultMinRequests uint32 = 20
+	//自适应熔断的倍数，越小越容易拒绝请求
+	DefaultK = 1.5
+)
+
+// Strategy 熔断策略
+type Strategy int
+
+const (
+	// 连续失败达到readyToTrip的条件后熔断
+	StrategyConsecutive Strategy = iota
+	// 滑动窗口内的错误率达到阈值后熔断
+	StrategyRolling
+	// Google SRE的客户端自适应限流，按成功率以一定概率拒绝请求
+	StrategyAdaptive
 )
 
 func defaultReadyToTrip(counts Counts) bool {
@@ -29,6 +51,25 @@ type option struct {
 
 	//在熔断状态发生改变时
 	onStateChange func(name string, from State, to State)
+
+	//熔断策略
+	strategy Strategy
+
+	//滑动窗口的时长与分桶数
+	window  time.Duration
+	buckets int
+
+	//滑动窗口内触发熔断的错误率
+	errorRatio float64
+
+	//滑动窗口内的最小请求数
+	minRequests uint32
+
+	//自适应熔断的倍数
+	k float64
+
+	//当前时间，测试时替换
+	now func() time.Time
 }
 
 type Option func(opt *option)
@@ -40,6 +81,13 @@ func NewOption() *option {
 		timeout:       DefaultTimeout,
 		readyToTrip:   defaultReadyToTrip,
 		onStateChange: nil,
+		strategy:      StrategyConsecutive,
+		window:        DefaultWindow,
+		buckets:       DefaultWindowBuckets,
+		errorRatio:    DefaultErrorRatio,
+		minRequests:   DefaultMinRequests,
+		k:             DefaultK,
+		now:           time.Now,
 	}
 }
 
@@ -72,3 +120,38 @@ func WithOnStateChange(onStateChange func(name string, from State, to State)) Op
 		opt.onStateChange = onStateChange
 	}
 }
+
+func WithStrategy(strategy Strategy) Option {
+	return func(opt *option) {
+		opt.strategy = strategy
+	}
+}
+
+// 滑动窗口的时长与分桶数，StrategyRolling与StrategyAdaptive使用
+func WithWindow(window time.Duration, buckets int) Option {
+	return func(opt *option) {
+		opt.window = window
+		opt.buckets = buckets
+	}
+}
+
+// 滑动窗口内触发熔断的错误率，取值0~1
+func WithErrorRatio(ratio float64) Option {
+	return func(opt *option) {
+		opt.errorRatio = ratio
+	}
+}
+
+// 滑动窗口内的请求数达到该值后才会熔断
+func WithMinRequests(n uint32) Option {
+	return func(opt *option) {
+		opt.minRequests = n
+	}
+}
+
+// 自适应熔断的倍数，请求数超过成功数的k倍后开始按比例拒绝请求
+func WithK(k float64) Option {
+	return func(opt *option) {
+		opt.k = k
+	}
+}
@@ -2,6 +2,7 @@ package breaker
 
 import (
 	"fmt"
+	"time"
 )
 
 type State int
@@ -64,3 +65,80 @@ func (c *Counts) clear() {
 	c.ConsecutiveSuccess = 0
 	c.ConsecutiveFailure = 0
 }
+
+// rollingWindow 按时间分桶的滑动窗口，统计最近一段时间的成功与失败次数，
+// 不是并发安全的，由熔断器的锁保护
+type rollingWindow struct {
+	interval time.Duration
+	buckets  []bucket
+	// 当前桶的下标与开始时间
+	offset int
+	start  time.Time
+}
+
+type bucket struct {
+	success uint32
+	failure uint32
+}
+
+func newRollingWindow(window time.Duration, size int, now time.Time) *rollingWindow {
+	if size < 1 {
+		size = 1
+	}
+	interval := window / time.Duration(size)
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	return &rollingWindow{
+		interval: interval,
+		buckets:  make([]bucket, size),
+		start:    now,
+	}
+}
+
+func (w *rollingWindow) add(now time.Time, success bool) {
+	w.advance(now)
+	if success {
+		w.buckets[w.offset].success++
+	} else {
+		w.buckets[w.offset].failure++
+	}
+}
+
+// counts 窗口内的请求数、成功数与失败数
+func (w *rollingWindow) counts(now time.Time) Counts {
+	w.advance(now)
+	var c Counts
+	for _, b := range w.buckets {
+		c.TotaolSuccess += b.success
+		c.TotalFailures += b.failure
+	}
+	c.Request = c.TotaolSuccess + c.TotalFailures
+	return c
+}
+
+func (w *rollingWindow) reset(now time.Time) {
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+	w.offset = 0
+	w.start = now
+}
+
+// 移动到now所在的桶，清空期间过期的桶
+func (w *rollingWindow) advance(now time.Time) {
+	elapsed := int(now.Sub(w.start) / w.interval)
+	if elapsed <= 0 {
+		return
+	}
+
+	n := elapsed
+	if n > len(w.buckets) {
+		n = len(w.buckets)
+	}
+	for i := 1; i <= n; i++ {
+		w.buckets[(w.offset+i)%len(w.buckets)] = bucket{}
+	}
+	w.offset = (w.offset + n) % len(w.buckets)
+	w.start = w.start.Add(time.Duration(elapsed) * w.interval)
+}
@@ -0,0 +1,143 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// rollingBreaker 滑动窗口熔断器，窗口内的请求数达到minRequests且错误率达到errorRatio时熔断，
+// 熔断timeout后进入半开放状态，放行maxRequests个请求，全部成功后恢复
+type rollingBreaker struct {
+	name string
+	opt  *option
+
+	mutex      sync.Mutex
+	state      State
+	generation uint64
+	window     *rollingWindow
+	expiry     time.Time
+
+	//半开放状态下放行与成功的请求数
+	probes    uint32
+	successes uint32
+}
+
+func newRollingBreaker(opt *option) *rollingBreaker {
+	return &rollingBreaker{
+		name:   opt.name,
+		opt:    opt,
+		state:  StateClosed,
+		window: newRollingWindow(opt.window, opt.buckets, opt.now()),
+	}
+}
+
+func (b *rollingBreaker) Name() string {
+	return b.name
+}
+
+func (b *rollingBreaker) Counts() Counts {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.window.counts(b.opt.now())
+}
+
+func (b *rollingBreaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.currentState(b.opt.now())
+}
+
+func (b *rollingBreaker) Do(req func() error) error {
+	return doWithAdmission(b, req, nil, defaultAcceptable)
+}
+
+func (b *rollingBreaker) DoWithAcceptable(req func() error, acceptable Acceptable) error {
+	return doWithAdmission(b, req, nil, acceptable)
+}
+
+func (b *rollingBreaker) DoWithFallback(req func() error, fallback func(err error) error) error {
+	return doWithAdmission(b, req, fallback, defaultAcceptable)
+}
+
+func (b *rollingBreaker) DoWithFallbackAcceptable(req func() error, fallback func(err error) error, acceptable Acceptable) error {
+	return doWithAdmission(b, req, fallback, acceptable)
+}
+
+func (b *rollingBreaker) before() (uint64, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.currentState(b.opt.now()) {
+	case StateOpen:
+		return 0, ErrOpenState
+	case StateHalfOpen:
+		if b.probes >= b.opt.maxRequests {
+			return 0, ErrTooManyRequest
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+func (b *rollingBreaker) after(generation uint64, success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.opt.now()
+	state := b.currentState(now)
+	if generation != b.generation {
+		return
+	}
+
+	switch state {
+	case StateClosed:
+		b.window.add(now, success)
+		if b.tripped(b.window.counts(now)) {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if !success {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.opt.maxRequests {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+func (b *rollingBreaker) tripped(c Counts) bool {
+	if c.Request == 0 || c.Request < b.opt.minRequests {
+		return false
+	}
+	return float64(c.TotalFailures)/float64(c.Request) >= b.opt.errorRatio
+}
+
+func (b *rollingBreaker) currentState(now time.Time) State {
+	if b.state == StateOpen && !b.expiry.After(now) {
+		b.setState(StateHalfOpen, now)
+	}
+	return b.state
+}
+
+func (b *rollingBreaker) setState(state State, now time.Time) {
+	if b.state == state {
+		return
+	}
+
+	prev := b.state
+	b.state = state
+	b.generation++
+	b.probes, b.successes = 0, 0
+	switch state {
+	case StateClosed:
+		b.window.reset(now)
+	case StateOpen:
+		b.expiry = now.Add(b.opt.timeout)
+	}
+
+	if b.opt.onStateChange != nil {
+		b.opt.onStateChange(b.name, prev, state)
+	}
+}
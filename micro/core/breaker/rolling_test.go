@@ -0,0 +1,219 @@
+package breaker
+
+import (
+	"errors"
+	"go-micro/internal/fakeclock"
+	"testing"
+	"time"
+)
+
+var errTestDown = errors.New("下游异常")
+
+func withClock(c *fakeclock.Clock) Option {
+	return func(opt *option) {
+		opt.now = c.Now
+	}
+}
+
+func result(fail bool) func() error {
+	return func() error {
+		if fail {
+			return errTestDown
+		}
+		return nil
+	}
+}
+
+func TestRollingWindow(t *testing.T) {
+	clock := fakeclock.New()
+	w := newRollingWindow(10*time.Second, 10, clock.Now())
+
+	w.add(clock.Now(), true)
+	w.add(clock.Now(), false)
+	clock.Add(5 * time.Second)
+	w.add(clock.Now(), false)
+
+	if c := w.counts(clock.Now()); c.Request != 3 || c.TotaolSuccess != 1 || c.TotalFailures != 2 {
+		t.Fatalf("counts = %+v", c)
+	}
+
+	// 第一个桶移出窗口
+	clock.Add(5 * time.Second)
+	if c := w.counts(clock.Now()); c.Request != 1 || c.TotalFailures != 1 {
+		t.Fatalf("counts after 10s = %+v", c)
+	}
+
+	// 超过整个窗口后全部清空
+	clock.Add(time.Minute)
+	if c := w.counts(clock.Now()); c.Request != 0 {
+		t.Fatalf("counts after a minute = %+v", c)
+	}
+	w.add(clock.Now(), true)
+	if c := w.counts(clock.Now()); c.Request != 1 || c.TotaolSuccess != 1 {
+		t.Fatalf("counts after reuse = %+v", c)
+	}
+}
+
+func TestRollingBreakerMinRequests(t *testing.T) {
+	clock := fakeclock.New()
+	b := NewBreaker(WithStrategy(StrategyRolling), withClock(clock), WithMinRequests(10), WithErrorRatio(0.5))
+
+	// 请求量不足时即使全部失败也不熔断
+	for i := 0; i < 9; i++ {
+		b.Do(result(true))
+	}
+	if s := b.State(); s != StateClosed {
+		t.Fatalf("state = %v with too few requests, want closed", s)
+	}
+
+	b.Do(result(true))
+	if s := b.State(); s != StateOpen {
+		t.Fatalf("state = %v, want open", s)
+	}
+	if err := b.Do(result(false)); err != ErrOpenState {
+		t.Fatalf("got %v, want %v", err, ErrOpenState)
+	}
+}
+
+func TestRollingBreakerErrorRatio(t *testing.T) {
+	clock := fakeclock.New()
+	var changes []State
+	b := NewBreaker(
+		WithStrategy(StrategyRolling),
+		withClock(clock),
+		WithWindow(10*time.Second, 10),
+		WithMinRequests(10),
+		WithErrorRatio(0.5),
+		WithTimeout(5*time.Second),
+		WithMaxRequest(2),
+		WithOnStateChange(func(name string, from, to State) {
+			changes = append(changes, to)
+		}),
+	)
+
+	// 错误率40%，不熔断
+	for i := 0; i < 10; i++ {
+		b.Do(result(i%5 < 2))
+	}
+	if s := b.State(); s != StateClosed {
+		t.Fatalf("state = %v at 40%% errors, want closed", s)
+	}
+
+	// 旧的请求移出窗口后，最近的错误率超过50%
+	clock.Add(11 * time.Second)
+	for i := 0; i < 10; i++ {
+		b.Do(result(i%5 < 3))
+	}
+	if s := b.State(); s != StateOpen {
+		t.Fatalf("state = %v at 60%% errors, want open", s)
+	}
+
+	// 超时后半开放，最多放行maxRequests个请求
+	clock.Add(5 * time.Second)
+	if s := b.State(); s != StateHalfOpen {
+		t.Fatalf("state = %v after timeout, want half-open", s)
+	}
+	if err := b.Do(result(false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Do(result(false)); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.State(); s != StateClosed {
+		t.Fatalf("state = %v after successful probes, want closed", s)
+	}
+	if c := b.Counts(); c.Request != 0 {
+		t.Fatalf("counts not reset after closing: %+v", c)
+	}
+
+	want := []State{StateOpen, StateHalfOpen, StateClosed}
+	if len(changes) != len(want) {
+		t.Fatalf("state changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("state changes = %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestRollingBreakerHalfOpen(t *testing.T) {
+	clock := fakeclock.New()
+	b := NewBreaker(WithStrategy(StrategyRolling), withClock(clock), WithMinRequests(1), WithTimeout(time.Second))
+
+	b.Do(result(true))
+	clock.Add(time.Second)
+
+	// 半开放时只放行一个请求，探测期间的其他请求被拒绝
+	started, probe := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Do(func() error {
+			close(started)
+			<-probe
+			return errTestDown
+		})
+	}()
+	<-started
+	if err := b.Do(result(false)); err != ErrTooManyRequest {
+		t.Fatalf("got %v during the probe, want %v", err, ErrTooManyRequest)
+	}
+	close(probe)
+	if err := <-done; err != errTestDown {
+		t.Fatalf("probe got %v", err)
+	}
+
+	// 探测失败重新熔断
+	if s := b.State(); s != StateOpen {
+		t.Fatalf("state = %v after failed probe, want open", s)
+	}
+}
+
+func TestAdaptiveBreaker(t *testing.T) {
+	clock := fakeclock.New()
+	b := NewBreaker(WithStrategy(StrategyAdaptive), withClock(clock), WithMinRequests(10), WithK(1.5))
+
+	for i := 0; i < 100; i++ {
+		if err := b.Do(result(false)); err != nil {
+			t.Fatalf("healthy requests rejected: %v", err)
+		}
+	}
+	if s := b.State(); s != StateClosed {
+		t.Fatalf("state = %v, want closed", s)
+	}
+
+	// 下游全部失败后，按比例在本地拒绝请求
+	rejected := 0
+	for i := 0; i < 1000; i++ {
+		if err := b.Do(result(true)); err == ErrOpenState {
+			rejected++
+		}
+	}
+	if rejected < 500 {
+		t.Fatalf("rejected %d of 1000 requests to a failing downstream", rejected)
+	}
+	if s := b.State(); s != StateHalfOpen {
+		t.Fatalf("state = %v while throttling, want half-open", s)
+	}
+
+	// 窗口过期后恢复
+	clock.Add(DefaultWindow)
+	if err := b.Do(result(false)); err != nil {
+		t.Fatalf("request after the window got %v", err)
+	}
+	if s := b.State(); s != StateClosed {
+		t.Fatalf("state = %v after recovery, want closed", s)
+	}
+}
+
+func TestNewBreakerStrategy(t *testing.T) {
+	if _, ok := NewBreaker().(*CircuitBreaker); !ok {
+		t.Fatal("default strategy is not the consecutive CircuitBreaker")
+	}
+	if _, ok := NewBreaker(WithStrategy(StrategyRolling)).(*rollingBreaker); !ok {
+		t.Fatal("StrategyRolling did not create a rolling breaker")
+	}
+	if _, ok := NewBreaker(WithStrategy(StrategyAdaptive)).(*adaptiveBreaker); !ok {
+		t.Fatal("StrategyAdaptive did not create an adaptive breaker")
+	}
+}
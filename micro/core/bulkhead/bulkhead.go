@@ -0,0 +1,123 @@
+// Package bulkhead 舱壁隔离，限制每个依赖同时执行的请求数与排队数，
+// 避免一个慢的下游占满所有的协程
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrFull         = errors.New("舱壁已满")
+	ErrQueueTimeout = errors.New("排队超时")
+)
+
+type Bulkhead interface {
+	Name() string
+
+	// Acquire 获取执行许可，并发已满时排队等待，成功后必须调用release
+	Acquire(ctx context.Context) (release func(), err error)
+
+	// Do 获取许可后执行req
+	Do(ctx context.Context, req func() error) error
+
+	Stats() Stats
+}
+
+// Stats 当前执行与排队的请求数
+type Stats struct {
+	Active  int
+	Waiting int
+}
+
+type semaphore struct {
+	name string
+	opt  *option
+	sem  chan struct{}
+
+	mu      sync.Mutex // protects waiting
+	waiting int
+}
+
+func NewBulkhead(opts ...Option) Bulkhead {
+	opt := NewOption()
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.maxConcurrent < 1 {
+		opt.maxConcurrent = 1
+	}
+
+	return &semaphore{
+		name: opt.name,
+		opt:  opt,
+		sem:  make(chan struct{}, opt.maxConcurrent),
+	}
+}
+
+func (s *semaphore) Name() string {
+	return s.name
+}
+
+func (s *semaphore) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case s.sem <- struct{}{}:
+		return s.release, nil
+	default:
+	}
+
+	//并发已满，排队等待
+	s.mu.Lock()
+	if s.waiting >= s.opt.maxQueue {
+		s.mu.Unlock()
+		return nil, ErrFull
+	}
+	s.waiting++
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.waiting--
+		s.mu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if s.opt.queueTimeout > 0 {
+		t := time.NewTimer(s.opt.queueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case s.sem <- struct{}{}:
+		return s.release, nil
+	case <-timeout:
+		return nil, ErrQueueTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *semaphore) release() {
+	<-s.sem
+}
+
+func (s *semaphore) Do(ctx context.Context, req func() error) error {
+	release, err := s.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return req()
+}
+
+func (s *semaphore) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		Active:  len(s.sem),
+		Waiting: s.waiting,
+	}
+}
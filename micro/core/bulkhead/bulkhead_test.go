@@ -0,0 +1,149 @@
+package bulkhead
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hold 占用n个许可，返回释放全部许可的方法
+func hold(t *testing.T, b Bulkhead, n int) func() {
+	var releases []func()
+	for i := 0; i < n; i++ {
+		release, err := b.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+	return func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+}
+
+func TestBulkheadRejectsWhenFull(t *testing.T) {
+	b := NewBulkhead(WithMaxConcurrent(2))
+	release := hold(t, b, 2)
+
+	if _, err := b.Acquire(context.Background()); err != ErrFull {
+		t.Fatalf("got %v, want %v", err, ErrFull)
+	}
+	if s := b.Stats(); s.Active != 2 || s.Waiting != 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+
+	release()
+	if err := b.Do(context.Background(), func() error { return nil }); err != nil {
+		t.Fatalf("after release got %v", err)
+	}
+	if s := b.Stats(); s.Active != 0 {
+		t.Fatalf("stats after Do = %+v", s)
+	}
+}
+
+func TestBulkheadQueue(t *testing.T) {
+	b := NewBulkhead(WithMaxConcurrent(1), WithMaxQueue(1))
+	release := hold(t, b, 1)
+
+	queued := make(chan error)
+	go func() {
+		queued <- b.Do(context.Background(), func() error { return nil })
+	}()
+	for b.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 队列已满
+	if _, err := b.Acquire(context.Background()); err != ErrFull {
+		t.Fatalf("got %v with a full queue, want %v", err, ErrFull)
+	}
+
+	release()
+	if err := <-queued; err != nil {
+		t.Fatalf("queued request got %v", err)
+	}
+	if s := b.Stats(); s.Active != 0 || s.Waiting != 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestBulkheadQueueTimeout(t *testing.T) {
+	b := NewBulkhead(WithMaxConcurrent(1), WithMaxQueue(1), WithQueueTimeout(20*time.Millisecond))
+	defer hold(t, b, 1)()
+
+	if _, err := b.Acquire(context.Background()); err != ErrQueueTimeout {
+		t.Fatalf("got %v, want %v", err, ErrQueueTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := b.Acquire(ctx); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	if s := b.Stats(); s.Waiting != 0 {
+		t.Fatalf("waiting = %d after the timeouts", s.Waiting)
+	}
+}
+
+func TestBulkheadConcurrency(t *testing.T) {
+	const max = 4
+	b := NewBulkhead(WithMaxConcurrent(max), WithMaxQueue(100))
+
+	var active, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := b.Do(context.Background(), func() error {
+				n := atomic.AddInt32(&active, 1)
+				for {
+					p := atomic.LoadInt32(&peak)
+					if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&active, -1)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak > max {
+		t.Fatalf("peak concurrency %d exceeds %d", peak, max)
+	}
+}
+
+func TestGetBulkhead(t *testing.T) {
+	Opt("test.small", WithMaxConcurrent(1))
+
+	b := GetBulkhead("test.small")
+	if b != GetBulkhead("test.small") {
+		t.Fatal("GetBulkhead did not reuse the bulkhead")
+	}
+	if b.Name() != "test.small" {
+		t.Fatalf("name = %q", b.Name())
+	}
+	defer hold(t, b, 1)()
+	if err := Do(context.Background(), "test.small", func() error { return nil }); err != ErrFull {
+		t.Fatalf("got %v, want the configured limit of 1", err)
+	}
+
+	found := false
+	Range(func(b Bulkhead) bool {
+		found = found || b.Name() == "test.small"
+		return true
+	})
+	if !found {
+		t.Fatal("Range did not visit the bulkhead")
+	}
+}
@@ -0,0 +1,56 @@
+package bulkhead
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	lock      sync.RWMutex
+	bulkheads = make(map[string]Bulkhead)
+	options   = make(map[string][]Option)
+)
+
+// Opt 设置name对应舱壁的参数，需要在第一次使用该舱壁之前调用
+func Opt(name string, opts ...Option) {
+	lock.Lock()
+	options[name] = opts
+	lock.Unlock()
+}
+
+// Do calls Bulkhead.Do on the Bulkhead with given name.
+func Do(ctx context.Context, name string, req func() error) error {
+	return GetBulkhead(name).Do(ctx, req)
+}
+
+// GetBulkhead returns the Bulkhead with the given name.
+func GetBulkhead(name string) Bulkhead {
+	lock.RLock()
+	b, ok := bulkheads[name]
+	lock.RUnlock()
+	if ok {
+		return b
+	}
+
+	lock.Lock()
+	b, ok = bulkheads[name]
+	if !ok {
+		opts := append(append([]Option{}, options[name]...), WithName(name))
+		b = NewBulkhead(opts...)
+		bulkheads[name] = b
+	}
+	lock.Unlock()
+
+	return b
+}
+
+// Range 遍历已经创建的舱壁
+func Range(fn func(b Bulkhead) bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	for _, b := range bulkheads {
+		if !fn(b) {
+			return
+		}
+	}
+}
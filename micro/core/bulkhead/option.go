@@ -0,0 +1,56 @@
+package bulkhead
+
+import "time"
+
+var (
+	DefaultMaxConcurrent = 64
+	DefaultMaxQueue      = 0
+	DefaultQueueTimeout  = time.Duration(0)
+)
+
+type option struct {
+	name string
+
+	//最多同时执行的请求数
+	maxConcurrent int
+
+	//最多排队的请求数，0表示并发已满时直接拒绝
+	maxQueue int
+
+	//排队的超时时间，0表示只受ctx限制
+	queueTimeout time.Duration
+}
+
+type Option func(opt *option)
+
+func NewOption() *option {
+	return &option{
+		maxConcurrent: DefaultMaxConcurrent,
+		maxQueue:      DefaultMaxQueue,
+		queueTimeout:  DefaultQueueTimeout,
+	}
+}
+
+func WithName(name string) Option {
+	return func(opt *option) {
+		opt.name = name
+	}
+}
+
+func WithMaxConcurrent(n int) Option {
+	return func(opt *option) {
+		opt.maxConcurrent = n
+	}
+}
+
+func WithMaxQueue(n int) Option {
+	return func(opt *option) {
+		opt.maxQueue = n
+	}
+}
+
+func WithQueueTimeout(timeout time.Duration) Option {
+	return func(opt *option) {
+		opt.queueTimeout = timeout
+	}
+}
@@ -13,6 +13,20 @@ type CacheInterface interface {
 	Set(ctx context.Context, key, object interface{}, options *store.Options) error
 	Delete(ctx context.Context, key interface{}) error
 	Clear(ctx context.Context) error
+	// Incr 将key的值原子地加上delta并返回结果，值以十进制字符串保存；
+	// key不存在时从0开始并设置过期时间expiration，已存在的key保留原来的过期时间
+	Incr(ctx context.Context, key interface{}, delta int64, expiration time.Duration) (int64, error)
+}
+
+// Shared 缓存是否在多个进程之间共享，如redis；没有实现该接口的缓存按进程内缓存处理
+type Shared interface {
+	Shared() bool
+}
+
+// IsShared 缓存的数据是否在多个进程之间共享
+func IsShared(c CacheInterface) bool {
+	s, ok := c.(Shared)
+	return ok && s.Shared()
 }
 
 // 这是为自己项目的缓存而设计的；
@@ -53,6 +67,15 @@ func (c *Cache) Clear() error {
 	return c.cache.Clear(c.ctx)
 }
 
+func (c *Cache) Incr(key interface{}, delta int64, expiration time.Duration) (int64, error) {
+	return c.cache.Incr(c.ctx, key, delta, expiration)
+}
+
+// Store 返回底层的缓存，供需要context或直接依赖CacheInterface的组件使用
+func (c *Cache) Store() CacheInterface {
+	return c.cache
+}
+
 func marshal(v interface{}) (msg []byte) {
 	switch data := v.(type) {
 	case string:
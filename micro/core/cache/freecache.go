@@ -2,18 +2,27 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/coocood/freecache"
 	"github.com/eko/gocache/v2/cache"
 	"github.com/eko/gocache/v2/store"
+	"strconv"
+	"sync"
 	"time"
 )
 
 type FreeCache struct {
 	cacheManger *cache.Cache
+
+	// Incr需要直接读写freecache以保留过期时间
+	client *freecache.Cache
+	incrMu sync.Mutex
 }
 
 func NewFreeCache(cfg *Config) *FreeCache {
-	freecacheStore := store.NewFreecache(freecache.NewCache(1000), &store.Options{
+	client := freecache.NewCache(1000)
+	freecacheStore := store.NewFreecache(client, &store.Options{
 		Expiration: time.Duration(cfg.FreeCache.Expiration),
 	})
 
@@ -21,9 +30,15 @@ func NewFreeCache(cfg *Config) *FreeCache {
 
 	return &FreeCache{
 		cacheManger: cacheManager,
+		client:      client,
 	}
 }
 
+// Shared freecache只在当前进程内有效
+func (cache *FreeCache) Shared() bool {
+	return false
+}
+
 func (cache *FreeCache) Get(ctx context.Context, key interface{}) (interface{}, error) {
 	return cache.cacheManger.Get(ctx, key)
 }
@@ -39,3 +54,40 @@ func (cache *FreeCache) Delete(ctx context.Context, key interface{}) error {
 func (cache *FreeCache) Clear(ctx context.Context) error {
 	return cache.cacheManger.Clear(ctx)
 }
+
+// Incr 只在当前进程内是原子的，多个副本之间共享计数需要使用集中式的缓存
+func (cache *FreeCache) Incr(ctx context.Context, key interface{}, delta int64, expiration time.Duration) (int64, error) {
+	k, ok := key.(string)
+	if !ok {
+		return 0, errors.New("key type not supported by Freecache store")
+	}
+
+	cache.incrMu.Lock()
+	defer cache.incrMu.Unlock()
+
+	var n int64
+	expireSeconds := int(expiration / time.Second)
+	value, expireAt, err := cache.client.GetWithExpiration([]byte(k))
+	switch err {
+	case nil:
+		if n, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return 0, fmt.Errorf("incr %s: value is not an integer", k)
+		}
+		expireSeconds = 0
+		if expireAt > 0 {
+			// 保留原来的过期时间
+			if expireSeconds = int(int64(expireAt) - time.Now().Unix()); expireSeconds <= 0 {
+				expireSeconds = 1
+			}
+		}
+	case freecache.ErrNotFound:
+	default:
+		return 0, err
+	}
+
+	n += delta
+	if err := cache.client.Set([]byte(k), []byte(strconv.FormatInt(n, 10)), expireSeconds); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFreeCacheIncr(t *testing.T) {
+	c := NewFreeCache(&Config{})
+	ctx := context.Background()
+
+	for i, want := range []int64{1, 3, 2} {
+		delta := []int64{1, 2, -1}[i]
+		n, err := c.Incr(ctx, "sms:13800000000", delta, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("incr %d got %d, want %d", i, n, want)
+		}
+	}
+
+	// 计数可以通过Get读取
+	v, err := c.Get(ctx, "sms:13800000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v.([]byte)) != "2" {
+		t.Fatalf("get %q, want 2", v)
+	}
+
+	// 保留第一次设置的过期时间
+	ttl, err := c.client.TTL([]byte("sms:13800000000"))
+	if err != nil || ttl == 0 || ttl > 3600 {
+		t.Fatalf("ttl = %d, %v", ttl, err)
+	}
+
+	if err := c.Set(ctx, "name", []byte("go-micro"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Incr(ctx, "name", 1, 0); err == nil {
+		t.Fatal("incr on a non integer value should fail")
+	}
+}
@@ -0,0 +1,302 @@
+// Package cert 管理tls证书：监听证书文件的变化，通过tls.Config的回调原子地替换证书与CA，
+// 并定期检查证书的过期时间，轮换证书与CA不需要重启服务
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+var ErrNoCertificate = errors.New("cert: no certificate")
+
+// Expiry 证书的过期时间
+type Expiry struct {
+	File       string
+	CommonName string
+	IsCA       bool
+	NotAfter   time.Time
+}
+
+// bundle 一次加载的证书与CA，整体替换
+type bundle struct {
+	cert *tls.Certificate
+	pool *x509.CertPool
+	cas  []*x509.Certificate
+}
+
+type Manager struct {
+	opt    *option
+	logger *zap.Logger
+
+	current atomic.Value // *bundle
+
+	watcher   *fsnotify.Watcher
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewManager 加载证书并开始监听文件的变化，不再使用时需要调用Close
+func NewManager(opts ...Option) (*Manager, error) {
+	opt := NewOption()
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.certFile == "" && opt.caFile == "" {
+		return nil, errors.New("cert: no certificate or ca file")
+	}
+
+	m := &Manager{opt: opt, logger: opt.logger, done: make(chan struct{})}
+	if m.logger == nil {
+		m.logger = zap.L()
+	}
+
+	b, err := load(opt)
+	if err != nil {
+		return nil, err
+	}
+	m.current.Store(b)
+
+	// 监听目录而不是文件，证书通过重命名或符号链接替换时也能收到事件
+	if m.watcher, err = fsnotify.NewWatcher(); err != nil {
+		return nil, err
+	}
+	for _, dir := range m.dirs() {
+		if err := m.watcher.Add(dir); err != nil {
+			m.watcher.Close()
+			return nil, err
+		}
+	}
+	go m.watch()
+
+	m.checkExpiry()
+	register(m)
+	return m, nil
+}
+
+func (m *Manager) Name() string {
+	return m.opt.name
+}
+
+// Reload 重新加载证书，加载失败时保留原来的证书
+func (m *Manager) Reload() error {
+	b, err := load(m.opt)
+	if err != nil {
+		m.logger.Error("reload certificate", zap.String("name", m.opt.name), zap.Error(err))
+		return err
+	}
+	m.current.Store(b)
+	m.logger.Info("certificate reloaded", zap.String("name", m.opt.name))
+	m.checkExpiry()
+	return nil
+}
+
+// GetCertificate 用于服务端的tls.Config.GetCertificate
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := m.bundle().cert; cert != nil {
+		return cert, nil
+	}
+	return nil, ErrNoCertificate
+}
+
+// GetClientCertificate 用于客户端的tls.Config.GetClientCertificate，没有证书时不发送证书
+func (m *Manager) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if cert := m.bundle().cert; cert != nil {
+		return cert, nil
+	}
+	return &tls.Certificate{}, nil
+}
+
+// CAPool 当前的CA
+func (m *Manager) CAPool() *x509.CertPool {
+	return m.bundle().pool
+}
+
+// ServerConfig 服务端的tls配置，每次握手使用最新的证书与验证客户端的CA
+func (m *Manager) ServerConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	config := &tls.Config{
+		GetCertificate: m.GetCertificate,
+		ClientAuth:     clientAuth,
+	}
+	if m.opt.caFile != "" {
+		base := config.Clone()
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := base.Clone()
+			c.ClientCAs = m.CAPool()
+			return c, nil
+		}
+	}
+	return config
+}
+
+// ClientConfig 客户端的tls配置，RootCAs在调用时确定，每次建立连接时都需要重新获取
+func (m *Manager) ClientConfig(serverName string) *tls.Config {
+	config := &tls.Config{
+		RootCAs:    m.CAPool(),
+		ServerName: serverName,
+	}
+	if m.opt.certFile != "" {
+		config.GetClientCertificate = m.GetClientCertificate
+	}
+	return config
+}
+
+// Expiries 当前证书与CA的过期时间
+func (m *Manager) Expiries() []Expiry {
+	b := m.bundle()
+	var expiries []Expiry
+	if b.cert != nil {
+		expiries = append(expiries, Expiry{File: m.opt.certFile, CommonName: b.cert.Leaf.Subject.CommonName, NotAfter: b.cert.Leaf.NotAfter})
+	}
+	for _, ca := range b.cas {
+		expiries = append(expiries, Expiry{File: m.opt.caFile, CommonName: ca.Subject.CommonName, IsCA: true, NotAfter: ca.NotAfter})
+	}
+	return expiries
+}
+
+func (m *Manager) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		err = m.watcher.Close()
+		unregister(m)
+	})
+	return err
+}
+
+func (m *Manager) bundle() *bundle {
+	return m.current.Load().(*bundle)
+}
+
+func (m *Manager) files() []string {
+	var files []string
+	for _, f := range []string{m.opt.certFile, m.opt.keyFile, m.opt.caFile} {
+		if f != "" {
+			files = append(files, filepath.Clean(f))
+		}
+	}
+	return files
+}
+
+func (m *Manager) dirs() []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, f := range m.files() {
+		if dir := filepath.Dir(f); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// changed 事件是否与证书文件有关，k8s挂载的secret通过替换..data符号链接更新
+func (m *Manager) changed(e fsnotify.Event) bool {
+	name := filepath.Clean(e.Name)
+	if strings.HasPrefix(filepath.Base(name), "..") {
+		return true
+	}
+	for _, f := range m.files() {
+		if name == f {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) watch() {
+	ticker := time.NewTicker(m.opt.checkInterval)
+	defer ticker.Stop()
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-m.done:
+			return
+		case e, ok := <-m.watcher.Events:
+			if !ok {
+				return
+			}
+			if m.changed(e) {
+				// 等待证书与私钥都写入完成
+				reload = time.After(m.opt.reloadDelay)
+			}
+		case err, ok := <-m.watcher.Errors:
+			if !ok {
+				return
+			}
+			m.logger.Warn("watch certificate", zap.String("name", m.opt.name), zap.Error(err))
+		case <-reload:
+			reload = nil
+			m.Reload()
+		case <-ticker.C:
+			m.checkExpiry()
+		}
+	}
+}
+
+// checkExpiry 证书即将过期时告警，已经过期时记录错误
+func (m *Manager) checkExpiry() {
+	now := time.Now()
+	for _, e := range m.Expiries() {
+		fields := []zap.Field{
+			zap.String("name", m.opt.name),
+			zap.String("file", e.File),
+			zap.String("common_name", e.CommonName),
+			zap.Time("not_after", e.NotAfter),
+		}
+		switch remaining := e.NotAfter.Sub(now); {
+		case remaining <= 0:
+			m.logger.Error("certificate expired", fields...)
+		case remaining < m.opt.expiryWarning:
+			m.logger.Warn("certificate expiring soon", append(fields, zap.Duration("remaining", remaining))...)
+		}
+	}
+}
+
+func load(opt *option) (*bundle, error) {
+	b := &bundle{}
+	if opt.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(opt.certFile, opt.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+		b.cert = &cert
+	}
+	if opt.caFile != "" {
+		data, err := ioutil.ReadFile(opt.caFile)
+		if err != nil {
+			return nil, err
+		}
+		b.pool = x509.NewCertPool()
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			ca, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			b.pool.AddCert(ca)
+			b.cas = append(b.cas, ca)
+		}
+		if len(b.cas) == 0 {
+			return nil, fmt.Errorf("cert: no certificate found in %s", opt.caFile)
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,173 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"go-micro/internal/certtest"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// write 签发cn的证书写入certFile与keyFile，返回证书的序列号
+func write(t *testing.T, ca *certtest.CA, cn string, notAfter time.Time, certFile, keyFile string) *big.Int {
+	return ca.Issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		DNSNames:    []string{cn},
+		NotAfter:    notAfter,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, certFile, keyFile)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func serial(t *testing.T, m *Manager) *big.Int {
+	cert, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.SerialNumber
+}
+
+// eventually 等待文件变化后的重新加载
+func eventually(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met after 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := tempDir(t)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	ca := certtest.NewCA(t, "ca")
+	first := write(t, ca, "node6_03", time.Now().Add(365*24*time.Hour), certFile, keyFile)
+
+	m, err := NewManager(WithCertificate(certFile, keyFile), WithReloadDelay(10*time.Millisecond), WithLogger(zap.NewNop()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if serial(t, m).Cmp(first) != 0 {
+		t.Fatal("manager did not load the certificate")
+	}
+
+	second := write(t, ca, "node6_03", time.Now().Add(365*24*time.Hour), certFile, keyFile)
+	eventually(t, func() bool { return serial(t, m).Cmp(second) == 0 })
+
+	// 加载失败时保留原来的证书
+	certtest.WritePEM(t, keyFile, "EC PRIVATE KEY", []byte("broken"))
+	if err := m.Reload(); err == nil {
+		t.Fatal("reload with a broken key should fail")
+	}
+	if serial(t, m).Cmp(second) != 0 {
+		t.Fatal("a failed reload replaced the certificate")
+	}
+}
+
+func TestServerConfigRotatesCA(t *testing.T) {
+	dir := tempDir(t)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	oldCA, newCA := certtest.NewCA(t, "old"), certtest.NewCA(t, "new")
+	write(t, oldCA, "node6_03", time.Now().Add(365*24*time.Hour), certFile, keyFile)
+	oldCA.WriteCert(t, caFile)
+
+	m, err := NewManager(WithCertificate(certFile, keyFile), WithCA(caFile), WithLogger(zap.NewNop()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	config := m.ServerConfig(tls.RequireAndVerifyClientCert)
+
+	clientCert, clientKey := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	write(t, newCA, "pay", time.Now().Add(365*24*time.Hour), clientCert, clientKey)
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handshake := func() error {
+		c, s := net.Pipe()
+		defer c.Close()
+		defer s.Close()
+		go func() {
+			tc := tls.Client(c, &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{pair}})
+			// TLS 1.3的客户端先于服务端完成握手，继续读取服务端验证证书后的结果
+			if tc.Handshake() == nil {
+				tc.Read(make([]byte, 1))
+			}
+		}()
+		return tls.Server(s, config).Handshake()
+	}
+
+	if err := handshake(); err == nil {
+		t.Fatal("a client signed by an unknown CA was accepted")
+	}
+
+	// 轮换CA后不需要重启即可验证新CA签发的证书
+	newCA.WriteCert(t, caFile)
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := handshake(); err != nil {
+		t.Fatalf("handshake after rotating the CA: %v", err)
+	}
+}
+
+func TestExpiryWarning(t *testing.T) {
+	dir := tempDir(t)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	ca := certtest.NewCA(t, "ca")
+	write(t, ca, "node6_03", time.Now().Add(24*time.Hour), certFile, keyFile)
+
+	core, logs := observer.New(zap.WarnLevel)
+	m, err := NewManager(WithName("pay"), WithCertificate(certFile, keyFile), WithLogger(zap.New(core)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	entries := logs.FilterMessage("certificate expiring soon").All()
+	if len(entries) != 1 || entries[0].Level != zapcore.WarnLevel || entries[0].ContextMap()["name"] != "pay" {
+		t.Fatalf("logs = %+v", logs.All())
+	}
+
+	write(t, ca, "node6_03", time.Now().Add(-time.Minute), certFile, keyFile)
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if n := logs.FilterMessage("certificate expired").Len(); n != 1 {
+		t.Fatalf("expired logs = %d, want 1", n)
+	}
+
+	found := false
+	Range(func(r *Manager) bool {
+		if r == m {
+			e := r.Expiries()
+			found = len(e) == 1 && e[0].CommonName == "node6_03" && e[0].NotAfter.Before(time.Now())
+		}
+		return true
+	})
+	if !found {
+		t.Fatal("Range did not report the certificate expiry")
+	}
+}
@@ -0,0 +1,31 @@
+package cert
+
+import "sync"
+
+var (
+	lock     sync.RWMutex
+	managers = make(map[*Manager]struct{})
+)
+
+func register(m *Manager) {
+	lock.Lock()
+	managers[m] = struct{}{}
+	lock.Unlock()
+}
+
+func unregister(m *Manager) {
+	lock.Lock()
+	delete(managers, m)
+	lock.Unlock()
+}
+
+// Range 遍历没有关闭的Manager，用于导出证书的过期时间
+func Range(fn func(m *Manager) bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	for m := range managers {
+		if !fn(m) {
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cert
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	//证书在过期前多久开始告警
+	DefaultExpiryWarning = 30 * 24 * time.Hour
+	//检查证书过期时间的间隔
+	DefaultCheckInterval = time.Hour
+	//文件变化后等待多久再重新加载，避免证书与私钥只写入了一个
+	DefaultReloadDelay = 100 * time.Millisecond
+)
+
+type option struct {
+	name string
+
+	certFile string
+	keyFile  string
+	//CA证书，服务端用于验证客户端，客户端用于验证服务端
+	caFile string
+
+	expiryWarning time.Duration
+	checkInterval time.Duration
+	reloadDelay   time.Duration
+
+	logger *zap.Logger
+}
+
+type Option func(opt *option)
+
+func NewOption() *option {
+	return &option{
+		expiryWarning: DefaultExpiryWarning,
+		checkInterval: DefaultCheckInterval,
+		reloadDelay:   DefaultReloadDelay,
+	}
+}
+
+// 日志与指标中使用的名称
+func WithName(name string) Option {
+	return func(opt *option) {
+		opt.name = name
+	}
+}
+
+func WithCertificate(certFile, keyFile string) Option {
+	return func(opt *option) {
+		opt.certFile = certFile
+		opt.keyFile = keyFile
+	}
+}
+
+func WithCA(caFile string) Option {
+	return func(opt *option) {
+		opt.caFile = caFile
+	}
+}
+
+func WithExpiryWarning(before time.Duration) Option {
+	return func(opt *option) {
+		opt.expiryWarning = before
+	}
+}
+
+func WithCheckInterval(interval time.Duration) Option {
+	return func(opt *option) {
+		opt.checkInterval = interval
+	}
+}
+
+func WithReloadDelay(delay time.Duration) Option {
+	return func(opt *option) {
+		opt.reloadDelay = delay
+	}
+}
+
+// 证书加载与过期告警的日志，默认使用zap的全局logger
+func WithLogger(logger *zap.Logger) Option {
+	return func(opt *option) {
+		opt.logger = logger
+	}
+}
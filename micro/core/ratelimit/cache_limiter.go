@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"go-micro/core/cache"
+
+	"go.uber.org/zap"
+)
+
+// NewCacheLimiter 创建通过缓存计数的限流器，多个副本使用同一个集中式缓存时在集群范围内限流，
+// freecache等进程内缓存只在当前进程内限流，参考cache.IsShared。
+// 令牌桶需要原子地读改写整个状态，缓存限流总是使用滑动窗口，计数的key为前缀+key+窗口序号；
+// 缓存出错时放行请求。例如每个手机号每小时最多发送5条短信：
+//
+//	l := ratelimit.NewCacheLimiter(cache.CacheManager.Store(), ratelimit.WithPrefix("sms:"), ratelimit.WithRate(5, time.Hour))
+//	if !l.Allow(phone) { ... }
+func NewCacheLimiter(c cache.CacheInterface, opts ...Option) Limiter {
+	opt := NewOption()
+	for _, o := range opts {
+		o(opt)
+	}
+	return &cacheLimiter{opt: opt, cache: c}
+}
+
+type cacheLimiter struct {
+	opt   *option
+	cache cache.CacheInterface
+}
+
+func (l *cacheLimiter) Allow(key string) bool {
+	if l.opt.rate <= 0 || l.opt.window <= 0 {
+		return true
+	}
+
+	now := l.opt.now().UnixNano()
+	window := int64(l.opt.window)
+	index := now / window
+	// 计数需要保留到下一个窗口结束
+	expiration := 2 * l.opt.window
+	ctx := context.Background()
+
+	curr := l.key(key, index)
+	n, err := l.cache.Incr(ctx, curr, 1, expiration)
+	if err != nil {
+		l.fail(curr, err)
+		return true
+	}
+	prev, err := l.cache.Incr(ctx, l.key(key, index-1), 0, expiration)
+	if err != nil {
+		l.fail(curr, err)
+		return true
+	}
+
+	weight := 1 - float64(now%window)/float64(window)
+	if float64(prev)*weight+float64(n) <= float64(l.opt.rate) {
+		return true
+	}
+	// 被拒绝的请求不计数
+	if _, err := l.cache.Incr(ctx, curr, -1, expiration); err != nil {
+		l.fail(curr, err)
+	}
+	return false
+}
+
+func (l *cacheLimiter) key(key string, index int64) string {
+	return fmt.Sprintf("%s%s:%d", l.opt.prefix, key, index)
+}
+
+func (l *cacheLimiter) fail(key string, err error) {
+	zap.L().Warn("rate limit cache error", zap.String("key", key), zap.Error(err))
+}
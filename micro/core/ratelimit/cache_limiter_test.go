@@ -0,0 +1,29 @@
+package ratelimit
+
+import (
+	"go-micro/core/cache"
+	"go-micro/internal/fakeclock"
+	"testing"
+	"time"
+)
+
+func TestCacheLimiter(t *testing.T) {
+	clock := fakeclock.New()
+	c := cache.NewFreeCache(&cache.Config{})
+	opts := []Option{WithPrefix("sms:"), WithRate(5, time.Hour), withClock(clock)}
+
+	// 两个副本共享同一个缓存
+	a, b := NewCacheLimiter(c, opts...), NewCacheLimiter(c, opts...)
+	if n := allowN(a, "13800000000", 3) + allowN(b, "13800000000", 3); n != 5 {
+		t.Fatalf("replicas allowed %d in total, want 5", n)
+	}
+	if n := allowN(b, "13900000000", 10); n != 5 {
+		t.Fatalf("another phone allowed %d, want 5", n)
+	}
+
+	// 下一个窗口过去一半时，上一个窗口的5次按一半计入
+	clock.Add(time.Hour + 30*time.Minute - time.Duration(clock.Now().UnixNano()%int64(time.Hour)))
+	if n := allowN(a, "13800000000", 10); n != 2 {
+		t.Fatalf("half way through the next window allowed %d, want 2", n)
+	}
+}
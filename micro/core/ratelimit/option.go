@@ -0,0 +1,77 @@
+package ratelimit
+
+import "time"
+
+var (
+	DefaultAlgorithm = AlgorithmTokenBucket
+	DefaultRate      = 100
+	DefaultWindow    = time.Second
+)
+
+// Algorithm 限流算法
+type Algorithm string
+
+const (
+	// 令牌桶，按rate/window的速度补充令牌，允许burst个请求的突发
+	AlgorithmTokenBucket Algorithm = "token_bucket"
+	// 滑动窗口，按上一个窗口的计数加权估算最近window内的请求数
+	AlgorithmSlidingWindow Algorithm = "sliding_window"
+)
+
+type option struct {
+	algorithm Algorithm
+
+	//每个窗口允许的请求数
+	rate int
+
+	//窗口时长
+	window time.Duration
+
+	//令牌桶的容量，0表示与rate相同
+	burst int
+
+	//缓存限流的key前缀，区分不同的限流器
+	prefix string
+
+	//当前时间，测试时替换
+	now func() time.Time
+}
+
+type Option func(opt *option)
+
+func NewOption() *option {
+	return &option{
+		algorithm: DefaultAlgorithm,
+		rate:      DefaultRate,
+		window:    DefaultWindow,
+		now:       time.Now,
+	}
+}
+
+func WithAlgorithm(algorithm Algorithm) Option {
+	return func(opt *option) {
+		opt.algorithm = algorithm
+	}
+}
+
+// 每window时长允许rate个请求
+func WithRate(rate int, window time.Duration) Option {
+	return func(opt *option) {
+		opt.rate = rate
+		opt.window = window
+	}
+}
+
+// 令牌桶的容量，AlgorithmTokenBucket使用
+func WithBurst(burst int) Option {
+	return func(opt *option) {
+		opt.burst = burst
+	}
+}
+
+// 缓存限流的key前缀，NewCacheLimiter使用
+func WithPrefix(prefix string) Option {
+	return func(opt *option) {
+		opt.prefix = prefix
+	}
+}
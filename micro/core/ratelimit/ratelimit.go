@@ -0,0 +1,166 @@
+// Package ratelimit 提供按key区分的本地限流器，支持令牌桶与滑动窗口两种算法
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter 限流器，不同的key分别计数
+type Limiter interface {
+	// Allow 判断key对应的请求能否通过，通过时计入一次请求
+	Allow(key string) bool
+}
+
+// state 单个key的限流状态，由limiter加锁访问
+type state interface {
+	allow(now time.Time) bool
+	// idle 状态已经恢复到初始值，可以删除
+	idle(now time.Time) bool
+}
+
+// NewLimiter 创建限流器，rate或window不大于0时不限流
+func NewLimiter(opts ...Option) Limiter {
+	opt := NewOption()
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.burst <= 0 {
+		opt.burst = opt.rate
+	}
+
+	l := &limiter{
+		opt:       opt,
+		states:    make(map[string]state),
+		lastSweep: opt.now(),
+	}
+	switch opt.algorithm {
+	case AlgorithmSlidingWindow:
+		l.newState = func(now time.Time) state {
+			return &slidingWindow{rate: opt.rate, window: opt.window, start: now}
+		}
+	default:
+		l.newState = func(now time.Time) state {
+			return &tokenBucket{
+				burst:  float64(opt.burst),
+				rate:   float64(opt.rate),
+				window: float64(opt.window),
+				tokens: float64(opt.burst),
+				last:   now,
+			}
+		}
+	}
+	return l
+}
+
+type limiter struct {
+	opt      *option
+	newState func(now time.Time) state
+
+	mu        sync.Mutex
+	states    map[string]state
+	lastSweep time.Time
+}
+
+func (l *limiter) Allow(key string) bool {
+	if l.opt.rate <= 0 || l.opt.window <= 0 {
+		return true
+	}
+
+	now := l.opt.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	s, ok := l.states[key]
+	if !ok {
+		s = l.newState(now)
+		l.states[key] = s
+	}
+	return s.allow(now)
+}
+
+// sweep 每个窗口清理一次已经恢复初始值的key，避免按用户限流时map无限增长
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.opt.window {
+		return
+	}
+	l.lastSweep = now
+	for k, s := range l.states {
+		if s.idle(now) {
+			delete(l.states, k)
+		}
+	}
+}
+
+type tokenBucket struct {
+	burst  float64
+	rate   float64 //每个窗口补充的令牌数
+	window float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(elapsed) * b.rate / b.window
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *tokenBucket) idle(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+type slidingWindow struct {
+	rate   int
+	window time.Duration
+	//当前窗口的开始时间
+	start time.Time
+	prev  int
+	curr  int
+}
+
+func (w *slidingWindow) advance(now time.Time) {
+	n := now.Sub(w.start) / w.window
+	switch {
+	case n <= 0:
+		return
+	case n == 1:
+		w.prev = w.curr
+	default:
+		w.prev = 0
+	}
+	w.curr = 0
+	w.start = w.start.Add(n * w.window)
+}
+
+func (w *slidingWindow) allow(now time.Time) bool {
+	w.advance(now)
+	// 上一个窗口还在最近window内的部分按时间比例计入
+	weight := 1 - float64(now.Sub(w.start))/float64(w.window)
+	if float64(w.prev)*weight+float64(w.curr) >= float64(w.rate) {
+		return false
+	}
+	w.curr++
+	return true
+}
+
+func (w *slidingWindow) idle(now time.Time) bool {
+	w.advance(now)
+	return w.prev == 0 && w.curr == 0
+}
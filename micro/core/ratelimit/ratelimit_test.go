@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"go-micro/internal/fakeclock"
+	"testing"
+	"time"
+)
+
+func withClock(c *fakeclock.Clock) Option {
+	return func(opt *option) {
+		opt.now = c.Now
+	}
+}
+
+// allowN 连续请求n次，返回通过的次数
+func allowN(l Limiter, key string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if l.Allow(key) {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := fakeclock.New()
+	l := NewLimiter(WithRate(10, time.Second), WithBurst(5), withClock(clock))
+
+	if n := allowN(l, "a", 10); n != 5 {
+		t.Fatalf("burst allowed %d, want 5", n)
+	}
+
+	// 每100ms补充一个令牌
+	clock.Add(300 * time.Millisecond)
+	if n := allowN(l, "a", 10); n != 3 {
+		t.Fatalf("after 300ms allowed %d, want 3", n)
+	}
+
+	// 不同的key分别计数
+	if n := allowN(l, "b", 10); n != 5 {
+		t.Fatalf("key b allowed %d, want 5", n)
+	}
+
+	// 桶的容量不会超过burst
+	clock.Add(time.Hour)
+	if n := allowN(l, "a", 10); n != 5 {
+		t.Fatalf("after an hour allowed %d, want 5", n)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := fakeclock.New()
+	l := NewLimiter(WithAlgorithm(AlgorithmSlidingWindow), WithRate(10, time.Second), withClock(clock))
+
+	if n := allowN(l, "a", 20); n != 10 {
+		t.Fatalf("first window allowed %d, want 10", n)
+	}
+
+	// 进入下一个窗口的一半，上一个窗口的10次按一半计入
+	clock.Add(1500 * time.Millisecond)
+	if n := allowN(l, "a", 20); n != 5 {
+		t.Fatalf("half way through the next window allowed %d, want 5", n)
+	}
+
+	// 超过两个窗口后计数清零
+	clock.Add(2 * time.Second)
+	if n := allowN(l, "a", 20); n != 10 {
+		t.Fatalf("after two windows allowed %d, want 10", n)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	clock := fakeclock.New()
+	l := NewLimiter(WithRate(1, time.Second), withClock(clock)).(*limiter)
+
+	for _, key := range []string{"a", "b", "c"} {
+		l.Allow(key)
+	}
+	clock.Add(2 * time.Second)
+	l.Allow("d")
+
+	if len(l.states) != 1 {
+		t.Fatalf("%d keys left after sweep, want 1", len(l.states))
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	l := NewLimiter(WithRate(0, time.Second))
+	if n := allowN(l, "", 1000); n != 1000 {
+		t.Fatalf("allowed %d with rate 0, want all", n)
+	}
+}
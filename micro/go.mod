@@ -19,7 +19,9 @@ require (
 	github.com/spf13/viper v1.12.0
 	github.com/uber/jaeger-client-go v2.30.0+incompatible
 	github.com/uber/jaeger-lib v2.4.1+incompatible // indirect
+	github.com/ugorji/go/codec v1.2.7
 	go.uber.org/zap v1.21.0
+	google.golang.org/protobuf v1.28.0
 	gorm.io/driver/mysql v1.3.5
 	gorm.io/gorm v1.23.8
 )
@@ -0,0 +1,84 @@
+// Package certtest 测试使用的CA，签发证书并写入PEM文件
+package certtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// CA 自签名的CA，与cert目录下的CA使用相同的组织信息，一年后过期
+type CA struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+	// CA证书的DER编码
+	DER []byte
+}
+
+func NewCA(t testing.TB, cn string) *CA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Country: []string{"CN"}, Organization: []string{"star-linear"}, CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &CA{Key: key, DER: der}
+	if ca.Cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+// WriteCert 将CA证书写入file
+func (ca *CA) WriteCert(t testing.TB, file string) {
+	WritePEM(t, file, "CERTIFICATE", ca.DER)
+}
+
+// Issue 按tmpl签发证书并写入certFile与keyFile，返回证书的序列号；
+// 序列号与生效时间自动设置，tmpl.NotAfter为空时一小时后过期
+func (ca *CA) Issue(t testing.TB, tmpl *x509.Certificate, certFile, keyFile string) *big.Int {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	WritePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+	WritePEM(t, certFile, "CERTIFICATE", der)
+	return tmpl.SerialNumber
+}
+
+func WritePEM(t testing.TB, file, typ string, der []byte) {
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
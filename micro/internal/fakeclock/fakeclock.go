@@ -0,0 +1,28 @@
+// Package fakeclock 测试使用的时钟，时间只在调用Add时前进
+package fakeclock
+
+import (
+	"sync"
+	"time"
+)
+
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func New() *Clock {
+	return &Clock{now: time.Unix(1600000000, 0)}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"go-micro/core/cert"
+	"sync"
+)
+
+type certKey struct {
+	caFile, certFile, keyFile string
+}
+
+// certManagers 按证书文件共享的证书管理器，证书与CA在文件变化时自动重新加载，
+// 新建立的连接使用最新的证书
+type certManagers struct {
+	mu sync.Mutex
+	m  map[certKey]*cert.Manager
+}
+
+func newCertManagers() *certManagers {
+	return &certManagers{m: make(map[certKey]*cert.Manager)}
+}
+
+func (cm *certManagers) get(s *Server) (*cert.Manager, error) {
+	key := certKey{caFile: s.CertFile, certFile: s.ClientCertFile, keyFile: s.ClientKeyFile}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if m, ok := cm.m[key]; ok {
+		return m, nil
+	}
+	m, err := cert.NewManager(
+		cert.WithName(s.TlsServerName),
+		cert.WithCA(s.CertFile),
+		cert.WithCertificate(s.ClientCertFile, s.ClientKeyFile),
+	)
+	if err != nil {
+		return nil, err
+	}
+	cm.m[key] = m
+	return m, nil
+}
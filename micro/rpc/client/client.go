@@ -10,7 +10,13 @@ type RpcClient interface {
 	ConnRelease(serverName string, conn Conn)
 	NewConnect(serverName string) (Conn, error)
 	Call(ctx context.Context, req Request, resp interface{}, callOption ...CallOption) error
+	// 打开流式调用
+	Stream(ctx context.Context, req Request, callOption ...CallOption) (Stream, error)
 	NewRequest(serverName string, serverMethod string, req interface{}, opts ...RequestOption) Request
+	// 各节点连接池的统计信息
+	PoolStats() []NodePoolStats
+	// 停止监听注册中心并关闭所有连接
+	Close() error
 }
 
 type Conn interface {
@@ -21,6 +27,8 @@ type Conn interface {
 	Created() time.Time
 	//获取连接的地址
 	Remote() string
+	//连接使用的序列化方式
+	ContentType() string
 
 	Error() error
 
@@ -36,6 +44,8 @@ type Request interface {
 	Method() string
 	// 请求主题，也就是参数
 	Body() interface{}
+	// 序列化方式，为空时使用服务配置
+	ContentType() string
 
 	//SetHeader(key string, value interface{})
 	//
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bufio"
+	"go-micro/rpc/codec"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+)
+
+// NewCodec 根据连接创建对应序列化方式的rpc.ClientCodec
+type NewCodec func(conn io.ReadWriteCloser) (rpc.ClientCodec, error)
+
+// DefaultCodecs 客户端默认支持的序列化方式，json使用原有的jsonrpc协议，不发送协商首帧
+var DefaultCodecs = map[string]NewCodec{
+	codec.ContentTypeJSON: func(conn io.ReadWriteCloser) (rpc.ClientCodec, error) {
+		return jsonrpc.NewClientCodec(conn), nil
+	},
+	codec.ContentTypeMsgpack:  NewFrameCodec(codec.ContentTypeMsgpack),
+	codec.ContentTypeProtobuf: NewFrameCodec(codec.ContentTypeProtobuf),
+}
+
+// frameCodec 使用长度前缀数据帧的rpc.ClientCodec
+type frameCodec struct {
+	r io.Reader
+	w *bufio.Writer
+	c io.Closer
+	m codec.Marshaler
+
+	resp codec.Frame
+}
+
+// NewFrameCodec 返回使用contentType对应Marshaler的数据帧ClientCodec，创建时发送协商首帧
+func NewFrameCodec(contentType string) NewCodec {
+	return func(conn io.ReadWriteCloser) (rpc.ClientCodec, error) {
+		m, err := codec.Get(contentType)
+		if err != nil {
+			return nil, err
+		}
+		if err := codec.WritePreamble(conn, contentType); err != nil {
+			return nil, err
+		}
+		return &frameCodec{
+			r: bufio.NewReader(conn),
+			w: bufio.NewWriter(conn),
+			c: conn,
+			m: m,
+		}, nil
+	}
+}
+
+func (c *frameCodec) WriteRequest(r *rpc.Request, param interface{}) error {
+	f := codec.Frame{
+		Seq:           r.Seq,
+		ServiceMethod: r.ServiceMethod,
+	}
+	// header随数据帧发送，只序列化请求参数
+	if msg, ok := param.(*Message); ok {
+		f.Header = msg.Header
+		param = msg.Body
+	}
+
+	body, err := c.m.Marshal(param)
+	if err != nil {
+		return err
+	}
+	f.Body = body
+
+	if err := codec.WriteFrame(c.w, &f); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *frameCodec) ReadResponseHeader(r *rpc.Response) error {
+	if err := codec.ReadFrame(c.r, &c.resp); err != nil {
+		return err
+	}
+	r.Seq = c.resp.Seq
+	r.ServiceMethod = c.resp.ServiceMethod
+	r.Error = c.resp.Error
+	return nil
+}
+
+func (c *frameCodec) ReadResponseBody(x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	return c.m.Unmarshal(c.resp.Body, x)
+}
+
+func (c *frameCodec) Close() error {
+	return c.c.Close()
+}
@@ -9,6 +9,7 @@ var (
 
 	ErrAddrNotExist   = errors.New("不存在服务地址")
 	ErrPoolGetTimeout = errors.New("连接获取超时")
+	ErrPoolClosed     = errors.New("连接池已关闭")
 
 	ErrCreateConnHandleNotExit = errors.New("创建连接的处理方法不存在")
 
@@ -0,0 +1,372 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"go-micro/core/errors"
+	"go-micro/rpc/codec"
+	"go-micro/rpc/registry"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+var errMuxConnClosed = errors.ServiceUnavailable("go-micro/rpc/client/muxConn", "connection closed")
+
+// 多路复用连接使用数据帧协议，jsonrpc协议不支持，json请求改用数据帧传输json
+func muxContentType(contentType string) string {
+	if contentType == codec.ContentTypeJSON {
+		return codec.ContentTypeJSONFrame
+	}
+	return contentType
+}
+
+// 获取节点的多路复用连接，同一个节点的普通调用与流复用一个连接
+func (c *rpcClient) muxConn(serverName string, node *registry.Node, contentType string) (*muxConn, error) {
+	key := poolKey{address: node.Address, contentType: contentType}
+	return c.mux.getOrCreate(key, func() (*muxConn, error) {
+		s := c.serverFor(serverName, node)
+		conn, err := c.dial(s)
+		if err != nil {
+			return nil, err
+		}
+		mc, err := newMuxConn(conn, contentType, func(mc *muxConn) {
+			c.mux.drop(key, mc)
+		})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		mc.streamBuffer = c.opts.streamBuffer
+		return mc, nil
+	})
+}
+
+// muxConns 管理各节点的多路复用连接
+type muxConns struct {
+	sync.Mutex
+	conns map[poolKey]*muxConn
+	// 正在建立的连接，同一个节点的调用等待同一次连接
+	dialing map[poolKey]*muxDial
+}
+
+// muxDial 一次正在进行的连接，done关闭后conn与err可以读取
+type muxDial struct {
+	done chan struct{}
+	conn *muxConn
+	err  error
+}
+
+func newMuxConns() *muxConns {
+	return &muxConns{
+		conns:   make(map[poolKey]*muxConn),
+		dialing: make(map[poolKey]*muxDial),
+	}
+}
+
+// getOrCreate 在锁外建立连接，避免一个节点连接缓慢时阻塞其他节点的调用
+func (mcs *muxConns) getOrCreate(key poolKey, create func() (*muxConn, error)) (*muxConn, error) {
+	for {
+		mcs.Lock()
+		// 连接可能在创建过程中就已经断开，此时drop没有生效，需要重新创建
+		if conn, ok := mcs.conns[key]; ok && !conn.closed() {
+			mcs.Unlock()
+			return conn, nil
+		}
+		if d, ok := mcs.dialing[key]; ok {
+			mcs.Unlock()
+			<-d.done
+			if d.err != nil {
+				return nil, d.err
+			}
+			// 新建的连接已经断开时重新创建
+			if !d.conn.closed() {
+				return d.conn, nil
+			}
+			continue
+		}
+		d := &muxDial{done: make(chan struct{})}
+		mcs.dialing[key] = d
+		mcs.Unlock()
+
+		d.conn, d.err = create()
+
+		mcs.Lock()
+		delete(mcs.dialing, key)
+		if d.err == nil {
+			mcs.conns[key] = d.conn
+		}
+		mcs.Unlock()
+		close(d.done)
+		return d.conn, d.err
+	}
+}
+
+// 连接断开后移除，已经被新连接替换时不处理
+func (mcs *muxConns) drop(key poolKey, conn *muxConn) {
+	mcs.Lock()
+	if mcs.conns[key] == conn {
+		delete(mcs.conns, key)
+	}
+	mcs.Unlock()
+}
+
+// 关闭节点的所有多路复用连接
+func (mcs *muxConns) Remove(address string) {
+	var removed []*muxConn
+	mcs.Lock()
+	for key, conn := range mcs.conns {
+		if key.address == address {
+			removed = append(removed, conn)
+			delete(mcs.conns, key)
+		}
+	}
+	mcs.Unlock()
+
+	for _, conn := range removed {
+		conn.close(errMuxConnClosed)
+	}
+}
+
+// 关闭所有多路复用连接
+func (mcs *muxConns) Close() {
+	mcs.Lock()
+	conns := mcs.conns
+	mcs.conns = make(map[poolKey]*muxConn)
+	mcs.Unlock()
+
+	for _, conn := range conns {
+		conn.close(errMuxConnClosed)
+	}
+}
+
+// muxReceiver 等待响应的调用或者流，由读取协程按Seq分发数据帧
+type muxReceiver interface {
+	receive(f *codec.Frame)
+	finish(err error)
+}
+
+// muxConn 多路复用的连接，并发的调用与流通过数据帧的Seq区分
+type muxConn struct {
+	conn    io.ReadWriteCloser
+	m       codec.Marshaler
+	onClose func(*muxConn)
+	// 流中未接收消息数的上限，0表示不限制
+	streamBuffer int
+
+	wmu sync.Mutex // protects w
+	w   *bufio.Writer
+
+	mu      sync.Mutex // protects seq, pending, err
+	seq     uint64
+	pending map[uint64]muxReceiver
+	err     error
+}
+
+func newMuxConn(conn io.ReadWriteCloser, contentType string, onClose func(*muxConn)) (*muxConn, error) {
+	m, err := codec.Get(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if err := codec.WritePreamble(conn, contentType); err != nil {
+		return nil, err
+	}
+	mc := &muxConn{
+		conn:    conn,
+		m:       m,
+		w:       bufio.NewWriter(conn),
+		pending: make(map[uint64]muxReceiver),
+		onClose: onClose,
+	}
+	go mc.readLoop()
+	return mc, nil
+}
+
+// register 分配Seq并登记等待响应的调用或流
+func (mc *muxConn) register(newReceiver func(seq uint64) muxReceiver) (muxReceiver, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.err != nil {
+		return nil, mc.err
+	}
+	mc.seq++
+	r := newReceiver(mc.seq)
+	mc.pending[mc.seq] = r
+	return r, nil
+}
+
+// call 普通调用，ctx结束时移除等待中的调用，cancel为true时通知服务端取消handler
+func (mc *muxConn) call(ctx context.Context, req Request, resp interface{}, cancel bool) error {
+	body, err := mc.m.Marshal(req.Body())
+	if err != nil {
+		return err
+	}
+
+	r, err := mc.register(func(seq uint64) muxReceiver {
+		return &muxCall{conn: mc, seq: seq, done: make(chan struct{})}
+	})
+	if err != nil {
+		return err
+	}
+	call := r.(*muxCall)
+
+	err = mc.write(&codec.Frame{
+		Seq:           call.seq,
+		ServiceMethod: req.Method(),
+		Header:        header(ctx, req),
+		Body:          body,
+	})
+	if err != nil {
+		mc.close(errMuxConnClosed)
+		return errMuxConnClosed
+	}
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return call.err
+		}
+		if call.frame.Error != "" {
+			return errors.Parse(call.frame.Error)
+		}
+		return mc.m.Unmarshal(call.frame.Body, resp)
+	case <-ctx.Done():
+		mc.remove(call.seq)
+		if cancel {
+			mc.write(&codec.Frame{
+				Seq:           call.seq,
+				ServiceMethod: req.Method(),
+				Header:        http.Header{codec.StreamHeader: {codec.StreamCancel}},
+			})
+		}
+		return errors.Timeout("go-micro/rpc/client/muxConn.call", "server %s.%s", req.Service(), req.Method())
+	}
+}
+
+func (mc *muxConn) open(ctx context.Context, req Request) (*clientStream, error) {
+	body, err := mc.m.Marshal(req.Body())
+	if err != nil {
+		return nil, err
+	}
+	h := header(ctx, req)
+	h.Set(codec.StreamHeader, codec.StreamOpen)
+	h.Set(codec.StreamWindowHeader, strconv.Itoa(mc.streamBuffer))
+
+	ctx, cancel := context.WithCancel(ctx)
+	r, err := mc.register(func(seq uint64) muxReceiver {
+		return &clientStream{
+			ctx:           ctx,
+			cancel:        cancel,
+			req:           req,
+			seq:           seq,
+			serviceMethod: req.Method(),
+			conn:          mc,
+			limit:         mc.streamBuffer,
+			notify:        make(chan struct{}, 1),
+			done:          make(chan struct{}),
+			window:        codec.NewSendWindow(),
+			recv:          codec.NewRecvWindow(mc.streamBuffer),
+		}
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s := r.(*clientStream)
+
+	if err := s.write(codec.StreamOpen, h, body); err != nil {
+		s.finish(err)
+		return nil, err
+	}
+	go s.watch()
+	return s, nil
+}
+
+func (mc *muxConn) write(f *codec.Frame) error {
+	mc.wmu.Lock()
+	defer mc.wmu.Unlock()
+	if err := codec.WriteFrame(mc.w, f); err != nil {
+		return err
+	}
+	return mc.w.Flush()
+}
+
+func (mc *muxConn) readLoop() {
+	r := bufio.NewReader(mc.conn)
+	for {
+		var f codec.Frame
+		if err := codec.ReadFrame(r, &f); err != nil {
+			mc.close(errMuxConnClosed)
+			return
+		}
+
+		mc.mu.Lock()
+		p := mc.pending[f.Seq]
+		mc.mu.Unlock()
+		// 已经超时或取消的调用
+		if p == nil {
+			continue
+		}
+		p.receive(&f)
+	}
+}
+
+func (mc *muxConn) close(err error) {
+	mc.mu.Lock()
+	if mc.err != nil {
+		mc.mu.Unlock()
+		return
+	}
+	mc.err = err
+	pending := mc.pending
+	mc.pending = make(map[uint64]muxReceiver)
+	mc.mu.Unlock()
+
+	mc.conn.Close()
+	for _, p := range pending {
+		p.finish(err)
+	}
+	if mc.onClose != nil {
+		mc.onClose(mc)
+	}
+}
+
+func (mc *muxConn) closed() bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.err != nil
+}
+
+func (mc *muxConn) remove(seq uint64) {
+	mc.mu.Lock()
+	delete(mc.pending, seq)
+	mc.mu.Unlock()
+}
+
+// muxCall 等待响应的普通调用
+type muxCall struct {
+	conn *muxConn
+	seq  uint64
+
+	frame *codec.Frame
+	err   error
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (c *muxCall) receive(f *codec.Frame) {
+	c.complete(f, nil)
+}
+
+func (c *muxCall) finish(err error) {
+	c.complete(nil, err)
+}
+
+func (c *muxCall) complete(f *codec.Frame, err error) {
+	c.once.Do(func() {
+		c.frame, c.err = f, err
+		c.conn.remove(c.seq)
+		close(c.done)
+	})
+}
@@ -0,0 +1,284 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"go-micro/core/errors"
+	"go-micro/rpc/codec"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type muxArgs struct {
+	N     int
+	Delay time.Duration
+}
+
+// muxServer 按数据帧协议响应的假服务端，响应按Delay乱序返回
+type muxServer struct {
+	conn net.Conn
+
+	mu      sync.Mutex
+	cancels []uint64
+}
+
+func newMuxPair(t *testing.T) (*muxConn, *muxServer) {
+	c, s := net.Pipe()
+	srv := &muxServer{conn: s}
+	go srv.serve(t)
+
+	mc, err := newMuxConn(c, codec.ContentTypeJSONFrame, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mc, srv
+}
+
+func (s *muxServer) serve(t *testing.T) {
+	r := bufio.NewReader(s.conn)
+	if _, err := codec.ReadPreamble(r); err != nil {
+		return
+	}
+	m, _ := codec.Get(codec.ContentTypeJSONFrame)
+	var wmu sync.Mutex
+	for {
+		var f codec.Frame
+		if err := codec.ReadFrame(r, &f); err != nil {
+			return
+		}
+		switch f.Header.Get(codec.StreamHeader) {
+		case codec.StreamCancel:
+			s.mu.Lock()
+			s.cancels = append(s.cancels, f.Seq)
+			s.mu.Unlock()
+			continue
+		case codec.StreamSend:
+			// Echo流原样返回收到的消息
+			s.write(&wmu, &codec.Frame{Seq: f.Seq, Header: streamHeader(codec.StreamSend), Body: f.Body})
+			continue
+		case codec.StreamClose:
+			s.write(&wmu, &codec.Frame{Seq: f.Seq, Header: streamHeader(codec.StreamEnd)})
+			continue
+		case codec.StreamWindow:
+			// 不遵守客户端的接收窗口
+			continue
+		case codec.StreamOpen:
+			// 不限制客户端发送
+			window := streamHeader(codec.StreamWindow)
+			window.Set(codec.StreamWindowHeader, "0")
+			s.write(&wmu, &codec.Frame{Seq: f.Seq, Header: window})
+			var args muxArgs
+			m.Unmarshal(f.Body, &args)
+			// Count流发送N条消息后结束，其他流等待客户端的消息
+			if f.ServiceMethod == "Test.Count" {
+				go func(seq uint64) {
+					for i := 0; i < args.N; i++ {
+						body, _ := m.Marshal(i)
+						if s.write(&wmu, &codec.Frame{Seq: seq, Header: streamHeader(codec.StreamSend), Body: body}) != nil {
+							return
+						}
+					}
+					s.write(&wmu, &codec.Frame{Seq: seq, Header: streamHeader(codec.StreamEnd)})
+				}(f.Seq)
+			}
+			continue
+		}
+
+		var args muxArgs
+		if err := m.Unmarshal(f.Body, &args); err != nil {
+			t.Error(err)
+			return
+		}
+		go func(f codec.Frame) {
+			time.Sleep(args.Delay)
+			rsp := codec.Frame{Seq: f.Seq, ServiceMethod: f.ServiceMethod}
+			if args.N < 0 {
+				rsp.Error = errors.BadRequest("test", "negative").Error()
+			} else {
+				rsp.Body, _ = m.Marshal(args.N * 2)
+			}
+			s.write(&wmu, &rsp)
+		}(f)
+	}
+}
+
+func (s *muxServer) write(wmu *sync.Mutex, f *codec.Frame) error {
+	wmu.Lock()
+	defer wmu.Unlock()
+	return codec.WriteFrame(s.conn, f)
+}
+
+func streamHeader(op string) http.Header {
+	return http.Header{codec.StreamHeader: {op}}
+}
+
+func (s *muxServer) cancelled() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uint64(nil), s.cancels...)
+}
+
+func (mc *muxConn) pendingLen() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return len(mc.pending)
+}
+
+func TestMuxConnConcurrentCalls(t *testing.T) {
+	mc, _ := newMuxPair(t)
+	defer mc.close(errMuxConnClosed)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 先发送的请求后返回
+			req := newRequest("test", "Test.Double", &muxArgs{N: i, Delay: time.Duration(20-i) * time.Millisecond})
+			var rsp int
+			if err := mc.call(context.Background(), req, &rsp, true); err != nil {
+				t.Error(err)
+				return
+			}
+			if rsp != i*2 {
+				t.Errorf("call %d got %d", i, rsp)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := mc.pendingLen(); n != 0 {
+		t.Fatalf("pending calls = %d, want 0", n)
+	}
+}
+
+func TestMuxConnError(t *testing.T) {
+	mc, _ := newMuxPair(t)
+	defer mc.close(errMuxConnClosed)
+
+	var rsp int
+	err := mc.call(context.Background(), newRequest("test", "Test.Double", &muxArgs{N: -1}), &rsp, true)
+	if e := errors.FromError(err); e.Code != 400 {
+		t.Fatalf("got %v, want a 400 error", err)
+	}
+}
+
+func TestMuxConnCancel(t *testing.T) {
+	for _, send := range []bool{true, false} {
+		mc, srv := newMuxPair(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		var rsp int
+		err := mc.call(ctx, newRequest("test", "Test.Double", &muxArgs{N: 1, Delay: 200 * time.Millisecond}), &rsp, send)
+		cancel()
+		if e := errors.FromError(err); e.Code != 408 {
+			t.Fatalf("got %v, want a timeout", err)
+		}
+		if n := mc.pendingLen(); n != 0 {
+			t.Fatalf("pending calls = %d after timeout, want 0", n)
+		}
+
+		// 连接仍然可用，超时调用的响应被丢弃
+		if err := mc.call(context.Background(), newRequest("test", "Test.Double", &muxArgs{N: 2}), &rsp, send); err != nil || rsp != 4 {
+			t.Fatalf("call after timeout got %d, %v", rsp, err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		cancels := srv.cancelled()
+		if send && (len(cancels) != 1 || cancels[0] != 1) {
+			t.Fatalf("cancel frames = %v, want [1]", cancels)
+		}
+		if !send && len(cancels) != 0 {
+			t.Fatalf("cancel frames = %v, want none", cancels)
+		}
+		mc.close(errMuxConnClosed)
+	}
+}
+
+func TestMuxConnClose(t *testing.T) {
+	mc, srv := newMuxPair(t)
+
+	done := make(chan error, 1)
+	go func() {
+		var rsp int
+		done <- mc.call(context.Background(), newRequest("test", "Test.Double", &muxArgs{N: 1, Delay: time.Second}), &rsp, true)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	srv.conn.Close()
+
+	select {
+	case err := <-done:
+		if err != errMuxConnClosed {
+			t.Fatalf("got %v, want %v", err, errMuxConnClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending call was not failed when the connection closed")
+	}
+	if !mc.closed() {
+		t.Fatal("connection not marked closed")
+	}
+
+	var rsp int
+	if err := mc.call(context.Background(), newRequest("test", "Test.Double", &muxArgs{N: 1}), &rsp, true); err != errMuxConnClosed {
+		t.Fatalf("call on closed connection got %v", err)
+	}
+}
+
+func TestMuxConnsDialOutsideLock(t *testing.T) {
+	mcs := newMuxConns()
+	slow := poolKey{address: "slow", contentType: codec.ContentTypeJSONFrame}
+	fast := poolKey{address: "fast", contentType: codec.ContentTypeJSONFrame}
+
+	var dials int32
+	release := make(chan struct{})
+	results := make(chan *muxConn, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			mc, err := mcs.getOrCreate(slow, func() (*muxConn, error) {
+				atomic.AddInt32(&dials, 1)
+				<-release
+				mc, _ := newMuxPair(t)
+				return mc, nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			results <- mc
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// 慢节点连接过程中，其他节点的连接不受影响
+	done := make(chan error, 1)
+	go func() {
+		_, err := mcs.getOrCreate(fast, func() (*muxConn, error) {
+			mc, _ := newMuxPair(t)
+			return mc, nil
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("dial for another node blocked by a slow dial")
+	}
+
+	close(release)
+	first := <-results
+	for i := 1; i < 3; i++ {
+		if mc := <-results; mc != first {
+			t.Fatal("concurrent callers got different connections")
+		}
+	}
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Fatalf("dialed %d times, want 1", n)
+	}
+	mcs.Close()
+}
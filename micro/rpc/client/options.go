@@ -1,53 +1,101 @@
 package client
 
-import "time"
+import (
+	"go-micro/rpc/codec"
+	"go-micro/rpc/registry"
+	"go-micro/rpc/selector"
+	"time"
+)
 
 var (
-	DefaultPoolSize    = 2
-	DefaultPoolTTL     = 10 * time.Minute
-	DefaultConnTimeout = 30 * time.Second
-
-	//默认重试次数
-	DefaultRetries = 1
+	DefaultPoolSize = 2
+	DefaultPoolTTL  = 10 * time.Minute
+	//同一节点最多同时存在的连接数，0表示不限制
+	DefaultPoolMaxActive = 64
+	//空闲连接的超时时间
+	DefaultPoolIdleTimeout = 5 * time.Minute
+	//空闲连接的健康检查间隔
+	DefaultPoolHealthCheck = 30 * time.Second
+	DefaultConnTimeout     = 30 * time.Second
+
+	//默认最多尝试次数，包含第一次调用，未标记幂等的方法只在请求没有发出时重试
+	DefaultRetries = 3
 	//默认重试超时时间
 	DefaultRequestTimeout = 3 * time.Second
 	//默认重试验证方法
-	DefaultRetry = RetryAlways
+	DefaultRetry = RetryOnError
+	//默认第一次重试前的等待时间，之后指数增长
+	DefaultRetryBackoff = 100 * time.Millisecond
+	//默认重试等待时间的上限
+	DefaultRetryMaxBackoff = time.Second
+	//流的接收窗口，服务端最多发送该数量的Recv未接收的消息
+	DefaultStreamBuffer = 128
 )
 
 type Server struct {
 	Openssl       bool
 	CertFile      string
 	TlsServerName string
-	NetWork       string
-	Address       string
+	//双向认证时客户端的证书与私钥
+	ClientCertFile string
+	ClientKeyFile  string
+	NetWork        string
+	Address        string
+	ContentType    string
 }
 
 type dialOptions struct {
 	//需要连接的服务
 	Servers map[string]*Server
+	//服务注册中心，设置后优先通过注册中心解析服务地址
+	registry registry.Registry
+	//默认的序列化方式
+	contentType string
+	//支持的序列化方式，key为content-type
+	codecs map[string]NewCodec
 	//连接池大小
 	poolsize int
 
 	//连接生命周期
 	poolTTL time.Duration
+	//最多保留的空闲连接数
+	poolMaxIdle int
+	//最多同时存在的连接数
+	poolMaxActive int
+	//空闲连接的超时时间
+	poolIdleTimeout time.Duration
+	//空闲连接的健康检查间隔
+	poolHealthCheck time.Duration
 
 	//连接超时
 	connTimeout time.Duration
 
+	//每个节点只使用一个多路复用连接，不再使用连接池
+	multiplex bool
+	//多路复用的调用超时或取消时通知服务端取消handler
+	sendCancel bool
+	//流的接收窗口，服务端没有遵守窗口导致超过上限时取消流
+	streamBuffer int
+
 	//调用属性
 	callOptions CallOptions
 }
 
 type CallOptions struct {
 	CallWrappers []CallWrapper
+	// 选定节点之后执行的中间件
+	NodeWrappers []NodeWrapper
 
 	// Address of remote hosts
 	address []string
-	// 根据异常校验是否重试
-	retry RetryFunc
-	// 重试次数
-	retries int
+	// 节点的负载均衡策略
+	selector selector.Selector
+	// 本次调用中已经失败的节点，重试时优先选择其他节点
+	tried map[string]struct{}
+	// 重试策略
+	retryPolicy RetryPolicy
+	// 本次调用是否幂等，为空时按retryPolicy中的标记判断
+	idempotent *bool
 	// 请求超时
 	requestTimeout time.Duration
 }
@@ -58,13 +106,27 @@ type CallOptions struct {
 
 func newDialOptions() *dialOptions {
 	return &dialOptions{
-		Servers:     make(map[string]*Server),
-		poolsize:    DefaultPoolSize,
-		poolTTL:     DefaultPoolTTL,
-		connTimeout: DefaultConnTimeout,
+		Servers:         make(map[string]*Server),
+		contentType:     codec.DefaultContentType,
+		codecs:          DefaultCodecs,
+		poolsize:        DefaultPoolSize,
+		poolTTL:         DefaultPoolTTL,
+		poolMaxActive:   DefaultPoolMaxActive,
+		poolIdleTimeout: DefaultPoolIdleTimeout,
+		poolHealthCheck: DefaultPoolHealthCheck,
+		connTimeout:     DefaultConnTimeout,
+		sendCancel:      true,
+		streamBuffer:    DefaultStreamBuffer,
 		callOptions: CallOptions{
-			retry:          DefaultRetry,
-			retries:        DefaultRetries,
+			selector: selector.DefaultSelector,
+			retryPolicy: RetryPolicy{
+				MaxAttempts:    DefaultRetries,
+				InitialBackoff: DefaultRetryBackoff,
+				MaxBackoff:     DefaultRetryMaxBackoff,
+				Multiplier:     2,
+				Jitter:         0.2,
+				Retry:          DefaultRetry,
+			},
 			requestTimeout: DefaultRequestTimeout,
 		},
 	}
@@ -98,6 +160,12 @@ func SetServer(name string, server *Server) DialOption {
 	})
 }
 
+func WithRegistry(r registry.Registry) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.registry = r
+	})
+}
+
 func SetPoolSize(size int) DialOption {
 	return newFuncDialOption(func(options *dialOptions) {
 		options.poolsize = size
@@ -110,32 +178,143 @@ func SetPoolTTL(ttl time.Duration) DialOption {
 	})
 }
 
+// 最多保留的空闲连接数，默认与连接池大小相同
+func SetPoolMaxIdle(n int) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.poolMaxIdle = n
+	})
+}
+
+// 同一节点最多同时存在的连接数，0表示不限制
+func SetPoolMaxActive(n int) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.poolMaxActive = n
+	})
+}
+
+func SetPoolIdleTimeout(timeout time.Duration) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.poolIdleTimeout = timeout
+	})
+}
+
+// 空闲连接的健康检查间隔，0表示不检查
+func SetPoolHealthCheck(interval time.Duration) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.poolHealthCheck = interval
+	})
+}
+
 func SetConnectTimeOut(timeout time.Duration) DialOption {
 	return newFuncDialOption(func(options *dialOptions) {
 		options.connTimeout = timeout
 	})
 }
 
+// 每个节点的调用与流共用一个多路复用连接，连接池不再创建，服务端需要支持数据帧协议
+func SetMultiplex(enable bool) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.multiplex = enable
+	})
+}
+
+// 多路复用的调用超时或取消时是否通知服务端取消handler，默认通知
+func SetSendCancel(send bool) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.sendCancel = send
+	})
+}
+
+// 流的接收窗口，Recv未接收的服务端消息达到n条时服务端的Send等待，0表示不限制；
+// 服务端没有遵守窗口导致超过上限时取消流并返回429，同一个连接上的其他调用不受影响
+func SetStreamBuffer(n int) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.streamBuffer = n
+	})
+}
+
 func RequestTimeout(timeout time.Duration) DialOption {
 	return newFuncDialOption(func(options *dialOptions) {
 		options.callOptions.requestTimeout = timeout
 	})
 }
 
+// 最多尝试次数，包含第一次调用
 func Retries(retries int) DialOption {
 	return newFuncDialOption(func(options *dialOptions) {
-		options.callOptions.retries = retries
+		options.callOptions.retryPolicy.MaxAttempts = retries
 	})
 }
 
 func Retry(fn RetryFunc) DialOption {
 	return newFuncDialOption(func(options *dialOptions) {
-		options.callOptions.retry = fn
+		options.callOptions.retryPolicy.Retry = fn
+	})
+}
+
+func SetRetryPolicy(p RetryPolicy) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.callOptions.retryPolicy = p
+	})
+}
+
+// 标记幂等的方法，格式为Service.Method，只有这些方法在超时、传输错误等情况下重试
+func SetIdempotent(methods ...string) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		p := &options.callOptions.retryPolicy
+		p.Idempotent = append(append([]string(nil), p.Idempotent...), methods...)
+	})
+}
+
+// 标记非幂等的方法，格式为Service.Method，这些方法只在请求没有发出时重试
+func SetNonIdempotent(methods ...string) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		p := &options.callOptions.retryPolicy
+		p.NonIdempotent = append(append([]string(nil), p.NonIdempotent...), methods...)
+	})
+}
+
+// 设置默认的序列化方式
+func SetContentType(contentType string) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.contentType = contentType
+	})
+}
+
+// 注册content-type对应的序列化方式
+func WithCodec(contentType string, nc NewCodec) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		codecs := make(map[string]NewCodec, len(options.codecs)+1)
+		for ct, c := range options.codecs {
+			codecs[ct] = c
+		}
+		codecs[contentType] = nc
+		options.codecs = codecs
+	})
+}
+
+func SetSelector(s selector.Selector) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.callOptions.selector = s
 	})
 }
 
 type CallOption func(options *CallOptions)
 
+// 指定本次调用的负载均衡策略
+func WithSelector(s selector.Selector) CallOption {
+	return func(options *CallOptions) {
+		options.selector = s
+	}
+}
+
+// 指定本次调用的节点地址，不再通过注册中心和配置解析
+func WithAddress(addr ...string) CallOption {
+	return func(options *CallOptions) {
+		options.address = addr
+	}
+}
+
 // 全局设置，请求超时
 func WithRequestTimeout(timeout time.Duration) CallOption {
 	return func(options *CallOptions) {
@@ -143,16 +322,30 @@ func WithRequestTimeout(timeout time.Duration) CallOption {
 	}
 }
 
+// 本次调用最多尝试次数，包含第一次调用
 func WithRetries(retries int) CallOption {
 
 	return func(options *CallOptions) {
-		options.retries = retries
+		options.retryPolicy.MaxAttempts = retries
 	}
 }
 
 func WithRetry(fn RetryFunc) CallOption {
 	return func(options *CallOptions) {
-		options.retry = fn
+		options.retryPolicy.Retry = fn
+	}
+}
+
+func WithRetryPolicy(p RetryPolicy) CallOption {
+	return func(options *CallOptions) {
+		options.retryPolicy = p
+	}
+}
+
+// 标记本次调用是否幂等，非幂等的调用只在请求没有发出时重试
+func WithIdempotent(idempotent bool) CallOption {
+	return func(options *CallOptions) {
+		options.idempotent = &idempotent
 	}
 }
 
@@ -168,7 +361,27 @@ func WithWrapCall(cw ...CallWrapper) DialOption {
 	})
 }
 
+func WrapNode(nw ...NodeWrapper) CallOption {
+	return func(options *CallOptions) {
+		options.NodeWrappers = append(options.NodeWrappers, nw...)
+	}
+}
+
+func WithWrapNode(nw ...NodeWrapper) DialOption {
+	return newFuncDialOption(func(options *dialOptions) {
+		options.callOptions.NodeWrappers = append(options.callOptions.NodeWrappers, nw...)
+	})
+}
+
 type requestOptions struct {
+	contentType string
 }
 
 type RequestOption func(options *requestOptions)
+
+// 指定请求的序列化方式
+func WithContentType(contentType string) RequestOption {
+	return func(options *requestOptions) {
+		options.contentType = contentType
+	}
+}
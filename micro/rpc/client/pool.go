@@ -2,8 +2,8 @@ package client
 
 import (
 	"context"
-	"fmt"
 	"go-micro/core/debug"
+	"sync"
 	"time"
 )
 
@@ -15,144 +15,468 @@ type Pool interface {
 	Release(conn Conn)
 
 	Close()
+
+	Stats() PoolStats
 }
 
 // 定一个创建连接的方法
 type CreateConnectHandle func() (Conn, error)
 
 type PoolOptions struct {
+	// 保持的最少空闲连接数，创建连接池时预先建立
 	Size int
-	TTL  time.Duration
+	// 连接的最长存活时间
+	TTL time.Duration
+	// 最多保留的空闲连接数，默认为Size
+	MaxIdle int
+	// 最多同时存在的连接数（使用中与空闲），0表示不限制
+	MaxActive int
+	// 空闲超过该时间的连接会被关闭，0表示不关闭
+	IdleTimeout time.Duration
+	// 空闲连接的健康检查间隔，0表示不检查
+	HealthCheckInterval time.Duration
 	CreateConnectHandle
 }
 
+// PoolStats 连接池的统计信息
+type PoolStats struct {
+	// 使用中的连接数
+	Active int
+	// 空闲的连接数
+	Idle int
+	// 等待连接的次数与累计的等待时间
+	Waits    int64
+	WaitTime time.Duration
+	// 等待超时的次数
+	Timeouts int64
+}
+
+// NodePoolStats 节点连接池的统计信息
+type NodePoolStats struct {
+	Address     string
+	ContentType string
+	PoolStats
+}
+
+// pinger 支持健康检查的连接
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// 连接池按节点地址与序列化方式区分
+type poolKey struct {
+	address     string
+	contentType string
+}
+
 // 管理连接池
 type managePool struct {
-	pools map[string]Pool
+	sync.RWMutex
+	pools map[poolKey]Pool
 }
 
 func newManagePool() *managePool {
 	return &managePool{
-		pools: make(map[string]Pool),
+		pools: make(map[poolKey]Pool),
 	}
 }
 
-func (mp *managePool) Add(tab string, pool Pool) {
+func (mp *managePool) Add(tab poolKey, pool Pool) {
+	mp.Lock()
 	mp.pools[tab] = pool
+	mp.Unlock()
 }
 
-func (mp *managePool) Get(tab string) (Pool, bool) {
+func (mp *managePool) Get(tab poolKey) (Pool, bool) {
+	mp.RLock()
 	pool, ok := mp.pools[tab]
+	mp.RUnlock()
 	return pool, ok
 }
 
+// 获取连接池，不存在时通过create创建
+func (mp *managePool) GetOrCreate(tab poolKey, create func() (Pool, error)) (Pool, error) {
+	if pool, ok := mp.Get(tab); ok {
+		return pool, nil
+	}
+
+	mp.Lock()
+	defer mp.Unlock()
+	if pool, ok := mp.pools[tab]; ok {
+		return pool, nil
+	}
+	pool, err := create()
+	if err != nil {
+		return nil, err
+	}
+	mp.pools[tab] = pool
+	return pool, nil
+}
+
+// 移除并关闭节点的所有连接池
+func (mp *managePool) Remove(address string) {
+	var removed []Pool
+	mp.Lock()
+	for tab, pool := range mp.pools {
+		if tab.address == address {
+			removed = append(removed, pool)
+			delete(mp.pools, tab)
+		}
+	}
+	mp.Unlock()
+
+	for _, pool := range removed {
+		pool.Close()
+	}
+}
+
+// 关闭所有连接池
+func (mp *managePool) Close() {
+	mp.Lock()
+	pools := mp.pools
+	mp.pools = make(map[poolKey]Pool)
+	mp.Unlock()
+
+	for _, pool := range pools {
+		pool.Close()
+	}
+}
+
+// 所有连接池的统计信息
+func (mp *managePool) Stats() []NodePoolStats {
+	mp.RLock()
+	defer mp.RUnlock()
+	stats := make([]NodePoolStats, 0, len(mp.pools))
+	for tab, pool := range mp.pools {
+		stats = append(stats, NodePoolStats{Address: tab.address, ContentType: tab.contentType, PoolStats: pool.Stats()})
+	}
+	return stats
+}
+
+type idleConn struct {
+	conn     Conn
+	released time.Time
+}
+
 type pool struct {
-	count int //用于创建的连接
-	conns chan Conn
-	size  int
-	ttl   time.Duration
-	CreateConnectHandle
+	opts PoolOptions
+
+	mu      sync.Mutex // protects following
+	idle    []idleConn // 按放回的时间排序，最近放回的在最后
+	open    int        // 已经创建且未关闭的连接数，包含空闲连接
+	waiters []chan Conn
+	closed  bool
+	stats   PoolStats
+
+	stop chan struct{}
 }
 
 func initPool(options PoolOptions) (*pool, error) {
 	if options.Size <= 0 {
 		return nil, ErrPoolSize
 	}
+	if options.CreateConnectHandle == nil {
+		return nil, ErrCreateConnHandleNotExit
+	}
+	if options.MaxIdle < options.Size {
+		options.MaxIdle = options.Size
+	}
+	if options.MaxActive > 0 && options.MaxActive < options.MaxIdle {
+		options.MaxActive = options.MaxIdle
+	}
 
 	p := &pool{
-		size:                options.Size,
-		ttl:                 options.TTL,
-		conns:               make(chan Conn, options.Size),
-		CreateConnectHandle: options.CreateConnectHandle,
+		opts: options,
+		stop: make(chan struct{}),
 	}
 
-	return p, p.init()
+	debug.PrintDirExePos(dir+"init", "连接数 %d", p.opts.Size)
+	go p.maintain()
+	return p, nil
 }
 
-// 初识连接
-func (p *pool) init() error {
-	if p.CreateConnectHandle == nil {
-		return ErrCreateConnHandleNotExit
-	}
+// 获取连接，没有空闲连接且达到MaxActive时等待其他连接放回
+func (p *pool) Get(ctx context.Context) (Conn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
 
-	debug.PrintDirExePos(dir+"init", "连接数 %d", p.size)
-	// 创建连接
-	for i := 0; i < p.size; i++ {
-		//time.Sleep(time.Second)
-		conn, err := p.CreateConnectHandle()
-		if err != nil {
-			continue
-			//return err
+		if conn := p.popIdle(); conn != nil {
+			p.mu.Unlock()
+			return conn, nil
 		}
 
-		p.count++
-		p.conns <- conn
-	}
-	return nil
-}
+		if p.opts.MaxActive <= 0 || p.open < p.opts.MaxActive {
+			p.open++
+			p.mu.Unlock()
+			return p.create()
+		}
 
-// 获取连接
-func (p *pool) Get(ctx context.Context) (Conn, error) {
-	//判断正在使用的连接是否少于总连接数
-	//判断正在使用的连接是否少于总连接数
-	if p.count < p.size {
-		p.createConn()
-	}
-	for {
+		// 等待放回的连接，收到nil表示有连接被关闭，可以重新创建
+		ch := make(chan Conn, 1)
+		p.waiters = append(p.waiters, ch)
+		p.stats.Waits++
+		p.mu.Unlock()
+
+		start := time.Now()
 		select {
-		case conn := <-p.conns:
-			if d := time.Since(conn.Created()); d > p.ttl {
-				conn.Close()
-				p.count--
-				// 创建新的连接
-				p.createConn()
-				continue
+		case conn := <-ch:
+			p.addWaitTime(start)
+			if conn != nil {
+				return conn, nil
 			}
-			return conn, nil
 		case <-ctx.Done():
+			p.mu.Lock()
+			p.removeWaiter(ch)
+			p.stats.Timeouts++
+			p.stats.WaitTime += time.Since(start)
+			p.mu.Unlock()
+			// 移除前可能已经收到连接
+			select {
+			case conn := <-ch:
+				if conn != nil {
+					p.Release(conn)
+				} else {
+					p.signal()
+				}
+			default:
+			}
 			return nil, ErrPoolGetTimeout
 		}
 	}
 }
 
-// 释放连接
+// 放回连接，出错或过期的连接直接关闭
 func (p *pool) Release(conn Conn) {
 	// 可能连接为nil
 	if conn == nil {
 		return
 	}
 
-	if conn.Error() == nil {
-		p.conns <- conn
+	p.mu.Lock()
+	if p.closed || conn.Error() != nil || p.expired(conn, time.Now()) {
+		p.discard(conn)
+		return
+	}
+
+	// 在持有锁时交给等待者，等待超时的Get移除自己之后不会再收到连接
+	if len(p.waiters) > 0 {
+		ch := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		ch <- conn
+		p.mu.Unlock()
+		return
+	}
+
+	if len(p.idle) >= p.opts.MaxIdle {
+		p.discard(conn)
+		return
+	}
+	p.idle = append(p.idle, idleConn{conn: conn, released: time.Now()})
+	p.mu.Unlock()
+}
+
+// 关闭连接池及所有空闲连接，使用中的连接在放回时关闭
+func (p *pool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
 		return
 	}
+	p.closed = true
+	close(p.stop)
+	idle := p.idle
+	p.idle = nil
+	p.open -= len(idle)
+	// 唤醒等待中的Get，返回ErrPoolClosed
+	for _, ch := range p.waiters {
+		ch <- nil
+	}
+	p.waiters = nil
+	p.mu.Unlock()
+
+	for _, ic := range idle {
+		ic.conn.Close()
+	}
+}
+
+func (p *pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Idle = len(p.idle)
+	stats.Active = p.open - len(p.idle)
+	return stats
+}
+
+func (p *pool) create() (Conn, error) {
+	conn, err := p.opts.CreateConnectHandle()
+	if err == nil && conn.Error() != nil {
+		err = conn.Error()
+	}
+	if err != nil {
+		p.mu.Lock()
+		p.open--
+		p.signal()
+		p.mu.Unlock()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// 取出最近放回的可用空闲连接，需要持有p.mu
+func (p *pool) popIdle() Conn {
+	now := time.Now()
+	for len(p.idle) > 0 {
+		ic := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if ic.conn.Error() == nil && !p.expired(ic.conn, now) && !p.idleTimeout(ic, now) {
+			return ic.conn
+		}
+		p.open--
+		ic.conn.Close()
+	}
+	return nil
+}
+
+// 关闭连接并释放名额，需要持有p.mu，返回时释放p.mu
+func (p *pool) discard(conn Conn) {
+	p.open--
+	p.signal()
+	p.mu.Unlock()
 	conn.Close()
-	p.createConn()
 }
 
-func (p *pool) createConn() {
-	go func() {
-		retry := 0
-		// 创建的时候会出现异常所以用for
-		for {
-			if p.CreateConnectHandle == nil {
-				return
-			}
-			conn, err := p.CreateConnectHandle()
-			if retry > 10 {
-				return
-			}
-			if err != nil {
-				retry++
-				time.Sleep(1 * time.Second)
-				continue
-			}
-			p.count++
-			p.conns <- conn
+// 有连接关闭时唤醒一个等待者重新创建连接，需要持有p.mu
+func (p *pool) signal() {
+	if len(p.waiters) == 0 {
+		return
+	}
+	ch := p.waiters[0]
+	p.waiters = p.waiters[1:]
+	ch <- nil
+}
+
+func (p *pool) removeWaiter(ch chan Conn) {
+	for i, w := range p.waiters {
+		if w == ch {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
 			return
 		}
-	}()
+	}
 }
-func (p *pool) Close() {
-	fmt.Println("关闭连接")
+
+func (p *pool) addWaitTime(start time.Time) {
+	p.mu.Lock()
+	p.stats.WaitTime += time.Since(start)
+	p.mu.Unlock()
+}
+
+func (p *pool) expired(conn Conn, now time.Time) bool {
+	return p.opts.TTL > 0 && now.Sub(conn.Created()) > p.opts.TTL
+}
+
+func (p *pool) idleTimeout(ic idleConn, now time.Time) bool {
+	return p.opts.IdleTimeout > 0 && now.Sub(ic.released) > p.opts.IdleTimeout
+}
+
+// maintain 补充空闲连接到Size，定期清理过期的空闲连接并做健康检查
+func (p *pool) maintain() {
+	p.fill()
+
+	interval := p.opts.HealthCheckInterval
+	if interval <= 0 || (p.opts.IdleTimeout > 0 && p.opts.IdleTimeout < interval) {
+		interval = p.opts.IdleTimeout
+	}
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		p.evict()
+		if p.opts.HealthCheckInterval > 0 {
+			p.healthCheck()
+		}
+		p.fill()
+	}
+}
+
+// 补充空闲连接，创建失败时等待下一次检查
+func (p *pool) fill() {
+	for {
+		p.mu.Lock()
+		if p.closed || len(p.idle) >= p.opts.Size || (p.opts.MaxActive > 0 && p.open >= p.opts.MaxActive) {
+			p.mu.Unlock()
+			return
+		}
+		p.open++
+		p.mu.Unlock()
+
+		conn, err := p.create()
+		if err != nil {
+			debug.PrintErrDirExePos(dir+"fill", err, "创建连接错误")
+			return
+		}
+		p.Release(conn)
+	}
+}
+
+// 关闭出错、过期以及空闲超时的连接
+func (p *pool) evict() {
+	now := time.Now()
+	var closed []Conn
+	p.mu.Lock()
+	idle := p.idle[:0]
+	for _, ic := range p.idle {
+		if ic.conn.Error() != nil || p.expired(ic.conn, now) || p.idleTimeout(ic, now) {
+			closed = append(closed, ic.conn)
+			p.open--
+			p.signal()
+			continue
+		}
+		idle = append(idle, ic)
+	}
+	p.idle = idle
+	p.mu.Unlock()
+
+	for _, conn := range closed {
+		conn.Close()
+	}
+}
+
+// 对空闲连接做健康检查，检查时连接仍可以被使用，失败的连接由evict关闭
+func (p *pool) healthCheck() {
+	p.mu.Lock()
+	conns := make([]Conn, 0, len(p.idle))
+	for _, ic := range p.idle {
+		conns = append(conns, ic.conn)
+	}
+	p.mu.Unlock()
+
+	for _, conn := range conns {
+		pc, ok := conn.(pinger)
+		if !ok {
+			continue
+		}
+		timeout := p.opts.HealthCheckInterval
+		if timeout > DefaultRequestTimeout {
+			timeout = DefaultRequestTimeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := pc.Ping(ctx); err != nil {
+			debug.PrintErrDirExePos(dir+"healthCheck", err, "连接 %v 健康检查失败", conn.Remote())
+		}
+		cancel()
+	}
+	p.evict()
 }
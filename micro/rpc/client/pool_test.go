@@ -0,0 +1,245 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeConn struct {
+	id      int64
+	created time.Time
+
+	mu      sync.Mutex
+	err     error
+	closed  bool
+	pingErr error
+}
+
+func (c *fakeConn) Call(ctx context.Context, req Request, resp interface{}, opts CallOptions) error {
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *fakeConn) Created() time.Time  { return c.created }
+func (c *fakeConn) Remote() string      { return "fake" }
+func (c *fakeConn) ContentType() string { return "" }
+func (c *fakeConn) Id() int64           { return c.id }
+
+func (c *fakeConn) Error() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pingErr != nil {
+		c.err = c.pingErr
+	}
+	return c.pingErr
+}
+
+func (c *fakeConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+type fakeDialer struct {
+	n     int64
+	fail  int32
+	conns sync.Map
+}
+
+func (d *fakeDialer) create() (Conn, error) {
+	if atomic.LoadInt32(&d.fail) != 0 {
+		return nil, errors.New("dial failed")
+	}
+	c := &fakeConn{id: atomic.AddInt64(&d.n, 1), created: time.Now()}
+	d.conns.Store(c.id, c)
+	return c, nil
+}
+
+func newTestPool(t *testing.T, opts PoolOptions) (*pool, *fakeDialer) {
+	d := &fakeDialer{}
+	opts.CreateConnectHandle = d.create
+	p, err := initPool(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p, d
+}
+
+func TestPoolMaxActive(t *testing.T) {
+	p, d := newTestPool(t, PoolOptions{Size: 1, MaxActive: 2})
+
+	ctx := context.Background()
+	c1, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Stats(); s.Active != 2 {
+		t.Fatalf("stats = %+v", s)
+	}
+
+	// 达到MaxActive后等待超时
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(tctx); err != ErrPoolGetTimeout {
+		t.Fatalf("err = %v", err)
+	}
+
+	// 放回的连接交给等待者
+	got := make(chan Conn)
+	go func() {
+		c, _ := p.Get(ctx)
+		got <- c
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.Release(c1)
+	if c := <-got; c != c1 {
+		t.Fatalf("got %v, want %v", c, c1)
+	}
+
+	s := p.Stats()
+	if s.Active != 2 || s.Idle != 0 || s.Waits != 2 || s.Timeouts != 1 || s.WaitTime <= 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+
+	// 超过MaxIdle的连接被关闭
+	p.Release(c1)
+	p.Release(c2)
+	if s := p.Stats(); s.Active != 0 || s.Idle != 1 || !c2.(*fakeConn).isClosed() {
+		t.Fatalf("stats = %+v", s)
+	}
+	if n := atomic.LoadInt64(&d.n); n > 2 {
+		t.Fatalf("created %d conns", n)
+	}
+}
+
+func TestPoolDiscard(t *testing.T) {
+	p, _ := newTestPool(t, PoolOptions{Size: 1, MaxActive: 1})
+
+	ctx := context.Background()
+	c, _ := p.Get(ctx)
+	fc := c.(*fakeConn)
+	fc.err = errors.New("broken")
+
+	// 等待者在出错的连接关闭后重新创建连接
+	got := make(chan Conn)
+	go func() {
+		c, _ := p.Get(ctx)
+		got <- c
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.Release(c)
+	if !fc.isClosed() {
+		t.Fatal("broken conn not closed")
+	}
+	c2 := <-got
+	if c2 == nil || c2 == c {
+		t.Fatalf("got %v", c2)
+	}
+	p.Release(c2)
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	p, d := newTestPool(t, PoolOptions{Size: 2, IdleTimeout: time.Hour, HealthCheckInterval: 10 * time.Millisecond})
+
+	waitFor(t, func() bool { return p.Stats().Idle == 2 })
+	first, _ := d.conns.Load(int64(1))
+	first.(*fakeConn).mu.Lock()
+	first.(*fakeConn).pingErr = errors.New("no response")
+	first.(*fakeConn).mu.Unlock()
+
+	// 健康检查失败的连接被关闭，并补充新的连接
+	waitFor(t, func() bool { return first.(*fakeConn).isClosed() && p.Stats().Idle == 2 })
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	p, d := newTestPool(t, PoolOptions{Size: 1, MaxIdle: 3, IdleTimeout: 20 * time.Millisecond})
+
+	ctx := context.Background()
+	var conns []Conn
+	for i := 0; i < 3; i++ {
+		c, _ := p.Get(ctx)
+		conns = append(conns, c)
+	}
+	for _, c := range conns {
+		p.Release(c)
+	}
+
+	// 空闲超时的连接被关闭，保留Size个连接
+	waitFor(t, func() bool {
+		s := p.Stats()
+		return s.Idle == 1 && s.Active == 0 && atomic.LoadInt64(&d.n) > 3
+	})
+}
+
+func TestPoolClose(t *testing.T) {
+	p, d := newTestPool(t, PoolOptions{Size: 2, MaxActive: 2})
+	waitFor(t, func() bool { return p.Stats().Idle == 2 })
+
+	ctx := context.Background()
+	c, _ := p.Get(ctx)
+	p.Close()
+
+	if _, err := p.Get(ctx); err != ErrPoolClosed {
+		t.Fatalf("err = %v", err)
+	}
+	p.Release(c)
+
+	d.conns.Range(func(_, v interface{}) bool {
+		if !v.(*fakeConn).isClosed() {
+			t.Fatalf("conn %d not closed", v.(*fakeConn).id)
+		}
+		return true
+	})
+	if s := p.Stats(); s.Active != 0 || s.Idle != 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestPoolCreateError(t *testing.T) {
+	p, d := newTestPool(t, PoolOptions{Size: 1, MaxActive: 1})
+	atomic.StoreInt32(&d.fail, 1)
+	waitFor(t, func() bool { return p.Stats().Active == 0 })
+
+	if _, err := p.Get(context.Background()); err == nil {
+		t.Fatal("expected dial error")
+	}
+	// 创建失败不占用名额
+	atomic.StoreInt32(&d.fail, 0)
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release(c)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -17,6 +17,11 @@ type rpcRequest struct {
 	header http.Header
 }
 
+// NewRequest 创建请求，与RpcClient.NewRequest相同，供没有客户端的wrapper与测试使用
+func NewRequest(service, endpoint string, request interface{}, reqOpts ...RequestOption) Request {
+	return newRequest(service, endpoint, request, reqOpts...)
+}
+
 func newRequest(service, endpoint string, request interface{}, reqOpts ...RequestOption) Request {
 	var opts requestOptions
 
@@ -25,11 +30,12 @@ func newRequest(service, endpoint string, request interface{}, reqOpts ...Reques
 	}
 
 	return &rpcRequest{
-		service:  service,
-		method:   endpoint,
-		endpoint: endpoint,
-		body:     request,
-		opts:     opts,
+		service:     service,
+		method:      endpoint,
+		endpoint:    endpoint,
+		contentType: opts.contentType,
+		body:        request,
+		opts:        opts,
 
 		//header: make(map[string]interface{}),
 		header: http.Header{},
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"go-micro/core/debug"
+	"go-micro/rpc/registry"
+	"sync"
+	"time"
+)
+
+var (
+	//注册中心节点的缓存时间，注册中心的变化会通过watch及时清理缓存
+	DefaultRegistryCacheTTL = 30 * time.Second
+	//watch异常后的重试间隔
+	DefaultWatchRetryInterval = time.Second
+)
+
+type cacheEntry struct {
+	nodes  []*registry.Node
+	expiry time.Time
+}
+
+// nodeCache 缓存服务的节点，避免每次请求都访问注册中心
+type nodeCache struct {
+	sync.RWMutex
+	ttl     time.Duration
+	entries map[string]*cacheEntry
+}
+
+func newNodeCache(ttl time.Duration) *nodeCache {
+	return &nodeCache{
+		ttl:     ttl,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+func (nc *nodeCache) get(service string) ([]*registry.Node, bool) {
+	nc.RLock()
+	defer nc.RUnlock()
+	entry, ok := nc.entries[service]
+	if !ok || time.Now().After(entry.expiry) {
+		return nil, false
+	}
+	return entry.nodes, true
+}
+
+func (nc *nodeCache) set(service string, nodes []*registry.Node) {
+	nc.Lock()
+	nc.entries[service] = &cacheEntry{
+		nodes:  nodes,
+		expiry: time.Now().Add(nc.ttl),
+	}
+	nc.Unlock()
+}
+
+// 清理服务的缓存，返回清理前缓存的节点
+func (nc *nodeCache) del(service string) []*registry.Node {
+	nc.Lock()
+	defer nc.Unlock()
+	entry, ok := nc.entries[service]
+	if !ok {
+		return nil
+	}
+	delete(nc.entries, service)
+	return entry.nodes
+}
+
+// 解析服务的节点，优先从注册中心获取，注册中心不存在该服务时使用配置中的地址
+func (c *rpcClient) lookup(serverName string) ([]*registry.Node, error) {
+	if c.opts.registry != nil {
+		if nodes, ok := c.cache.get(serverName); ok {
+			return nodes, nil
+		}
+
+		services, err := c.opts.registry.GetService(serverName)
+		if err != nil && err != registry.ErrNotFound {
+			debug.PrintErrDirExePos(dir+":lookup", err, "从注册中心获取%v服务错误", serverName)
+		}
+
+		var nodes []*registry.Node
+		for _, s := range services {
+			nodes = append(nodes, s.Nodes...)
+		}
+		if len(nodes) > 0 {
+			c.cache.set(serverName, nodes)
+			return nodes, nil
+		}
+	}
+
+	server, ok := c.opts.Servers[serverName]
+	if !ok || server.Address == "" {
+		return nil, ErrNotServer
+	}
+	return []*registry.Node{{Id: serverName, Address: server.Address}}, nil
+}
+
+// 节点的连接配置，网络与tls配置沿用服务的配置
+func (c *rpcClient) serverFor(serverName string, node *registry.Node) *Server {
+	s := &Server{}
+	if cfg, ok := c.opts.Servers[serverName]; ok {
+		*s = *cfg
+	}
+	s.Address = node.Address
+	if s.NetWork == "" {
+		s.NetWork = "tcp"
+	}
+	return s
+}
+
+// 请求使用的序列化方式，优先级：请求 > 服务配置 > 全局配置
+func (c *rpcClient) contentType(serverName string, req Request) string {
+	if req != nil && req.ContentType() != "" {
+		return req.ContentType()
+	}
+	if cfg, ok := c.opts.Servers[serverName]; ok && cfg.ContentType != "" {
+		return cfg.ContentType
+	}
+	return c.opts.contentType
+}
+
+// 获取节点的连接池，不存在时创建
+func (c *rpcClient) getPool(serverName string, node *registry.Node, contentType string) (Pool, error) {
+	return c.mp.GetOrCreate(poolKey{address: node.Address, contentType: contentType}, func() (Pool, error) {
+		debug.PrintDirExePos(dir+"getPool", "创建 %v(%v %v) 连接池", serverName, node.Address, contentType)
+		s := c.serverFor(serverName, node)
+		s.ContentType = contentType
+		return initPool(PoolOptions{
+			Size:                c.opts.poolsize,
+			TTL:                 c.opts.poolTTL,
+			MaxIdle:             c.opts.poolMaxIdle,
+			MaxActive:           c.opts.poolMaxActive,
+			IdleTimeout:         c.opts.poolIdleTimeout,
+			HealthCheckInterval: c.opts.poolHealthCheck,
+			CreateConnectHandle: c.newConnect(serverName, s),
+		})
+	})
+}
+
+// 监听注册中心，服务变化时清理缓存，节点下线时关闭对应的连接池，Close之后退出
+func (c *rpcClient) watch() {
+	defer close(c.watched)
+	for {
+		w, err := c.opts.registry.Watch()
+		if err != nil {
+			debug.PrintErrDirExePos(dir+":watch", err, "监听注册中心错误")
+			if !c.wait(DefaultWatchRetryInterval) {
+				return
+			}
+			continue
+		}
+		if !c.setWatcher(w) {
+			w.Stop()
+			return
+		}
+
+		for {
+			res, err := w.Next()
+			if err != nil {
+				if c.isClosed() {
+					return
+				}
+				debug.PrintErrDirExePos(dir+":watch", err, "监听注册中心错误")
+				break
+			}
+			c.update(res)
+		}
+		w.Stop()
+		if !c.wait(DefaultWatchRetryInterval) {
+			return
+		}
+	}
+}
+
+// 记录当前的watcher，Close时停止它，客户端已经关闭时返回false
+func (c *rpcClient) setWatcher(w registry.Watcher) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.watcher = w
+	return true
+}
+
+// 是否已经在监听注册中心
+func (c *rpcClient) watching() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.watcher != nil
+}
+
+func (c *rpcClient) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// 等待d后返回true，客户端关闭时立即返回false
+func (c *rpcClient) wait(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-c.exit:
+		return false
+	}
+}
+
+func (c *rpcClient) update(res *registry.Result) {
+	cached := c.cache.del(res.Service.Name)
+	if res.Action != registry.ActionDelete {
+		return
+	}
+
+	for _, n := range res.Service.Nodes {
+		addr := n.Address
+		// 部分注册中心注销时只返回节点id，从缓存中找到对应的地址
+		for _, cn := range cached {
+			if addr == "" && cn.Id == n.Id {
+				addr = cn.Address
+			}
+		}
+		if addr != "" {
+			c.mp.Remove(addr)
+			c.mux.Remove(addr)
+		}
+	}
+}
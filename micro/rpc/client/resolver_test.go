@@ -0,0 +1,68 @@
+package client
+
+import (
+	"go-micro/rpc/registry"
+	"testing"
+	"time"
+)
+
+func TestWatchRemovesExpiredNodes(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	c := NewClient(WithRegistry(r))
+	defer c.Close()
+
+	addr := "127.0.0.1:9001"
+	p, _ := newTestPool(t, PoolOptions{Size: 1})
+	c.mp.Add(poolKey{address: addr}, p)
+
+	// 等待watch开始监听
+	for !c.watching() {
+		time.Sleep(time.Millisecond)
+	}
+	s := &registry.Service{Name: "test", Nodes: []*registry.Node{{Id: "test-1", Address: addr}}}
+	if err := r.Register(s, registry.RegisterTTL(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := c.mp.Get(poolKey{address: addr}); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the pool of an expired node was not removed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if !closed {
+		t.Fatal("the pool of an expired node was not closed")
+	}
+}
+
+func TestCloseStopsWatch(t *testing.T) {
+	c := NewClient(WithRegistry(registry.NewMemoryRegistry()))
+	for !c.watching() {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not stop the watch loop")
+	}
+	select {
+	case <-c.watched:
+	default:
+		t.Fatal("the watch loop is still running")
+	}
+	// 重复关闭不会阻塞
+	c.Close()
+}
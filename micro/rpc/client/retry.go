@@ -1,6 +1,12 @@
 package client
 
-import "context"
+import (
+	"context"
+	"go-micro/core/errors"
+	"math"
+	"math/rand"
+	"time"
+)
 
 // note that returning either false or a non-nil error will result in the call not being retried
 type RetryFunc func(ctx context.Context, req Request, retryCount int, err error) (bool, error)
@@ -9,3 +15,140 @@ type RetryFunc func(ctx context.Context, req Request, retryCount int, err error)
 func RetryAlways(ctx context.Context, req Request, retryCount int, err error) (bool, error) {
 	return true, nil
 }
+
+// RetryOnError 只重试超时与服务端错误，4xx说明请求本身有问题，重试也不会成功
+func RetryOnError(ctx context.Context, req Request, retryCount int, err error) (bool, error) {
+	return Retryable(err), nil
+}
+
+// Retryable 错误码为408或5xx时可以重试，没有错误码的错误不重试
+func Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := errors.FromError(err).Code
+	return code == 408 || code >= 500 && code < 600
+}
+
+const (
+	// 没有获取到连接，请求没有发出
+	idNotConnected = "go-micro/rpc/client/rpcClient.NewConnect"
+	// 与server.IdShuttingDown一致，服务端正在关闭，请求没有执行
+	idShuttingDown = "go-micro/rpc/server.ShuttingDown"
+)
+
+// 拒绝请求的中间件使用的错误Id，返回这些错误时请求没有被handler执行
+const (
+	// IdBreakerOpen 熔断器拒绝请求，请求没有发出
+	IdBreakerOpen = "go-micro/rpc/wrapper/breaker"
+	// IdBulkheadFull 舱壁已满或者排队超时，handler没有执行
+	IdBulkheadFull = "go-micro/rpc/wrapper/bulkhead"
+)
+
+// NotSent 请求确定没有被服务端执行，非幂等的方法也可以安全地重试其他节点
+func NotSent(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch errors.FromError(err).Id {
+	case idNotConnected, idShuttingDown, IdBreakerOpen, IdBulkheadFull:
+		return true
+	}
+	return false
+}
+
+// RetryPolicy 调用失败后的重试策略，第n次重试前等待
+// InitialBackoff * Multiplier^(n-1)，不超过MaxBackoff，并按Jitter随机浮动
+type RetryPolicy struct {
+	// 最多尝试次数，包含第一次调用，小于1时按1处理
+	MaxAttempts int
+	// 第一次重试前的等待时间，0表示不等待
+	InitialBackoff time.Duration
+	// 等待时间的上限，0表示不限制
+	MaxBackoff time.Duration
+	// 等待时间的增长倍数，小于1时按1处理
+	Multiplier float64
+	// 等待时间的随机浮动比例，取值0~1，避免大量客户端同时重试
+	Jitter float64
+	// 单次尝试的超时时间，0表示只受整个调用的超时限制
+	PerAttemptTimeout time.Duration
+	// 判断错误是否可以重试，为空时使用RetryOnError
+	Retry RetryFunc
+	// 幂等的方法，格式为Service.Method，只有这些方法在超时、传输错误等情况下重试
+	Idempotent []string
+	// 非幂等的方法，格式为Service.Method，如创建支付订单，优先于Idempotent
+	NonIdempotent []string
+}
+
+// 最多尝试次数，小于1时按1处理
+func (p *RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// idempotent 方法是否幂等，调用时的标记优先，未标记的方法按非幂等处理
+func (p *RetryPolicy) idempotent(req Request, idempotent *bool) bool {
+	if idempotent != nil {
+		return *idempotent
+	}
+	for _, m := range p.NonIdempotent {
+		if m == req.Method() {
+			return false
+		}
+	}
+	for _, m := range p.Idempotent {
+		if m == req.Method() {
+			return true
+		}
+	}
+	return false
+}
+
+// retry 非幂等的方法只在请求确定没有发出时重试，避免超时后服务端已经执行的请求被重复执行；
+// 客户端舱壁已满的429等重试也不会成功的错误不重试
+func (p *RetryPolicy) retry(ctx context.Context, req Request, retryCount int, err error, idempotent bool) (bool, error) {
+	if !idempotent {
+		return NotSent(err) && Retryable(err), nil
+	}
+	if p.Retry == nil {
+		return RetryOnError(ctx, req, retryCount, err)
+	}
+	return p.Retry(ctx, req, retryCount, err)
+}
+
+// backoff 第retryCount次重试前的等待时间，retryCount从1开始
+func (p *RetryPolicy) backoff(retryCount int) time.Duration {
+	if p.InitialBackoff <= 0 || retryCount < 1 {
+		return 0
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retryCount-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if jitter := math.Min(p.Jitter, 1); jitter > 0 {
+		d *= 1 - jitter + 2*jitter*rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// 等待重试，ctx结束时返回false
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
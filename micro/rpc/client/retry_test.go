@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	stderrors "errors"
+	"go-micro/core/errors"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.BadRequest("test", "bad"), false},
+		{errors.NotFound("test", "missing"), false},
+		{errors.Conflict("test", "conflict"), false},
+		{errors.Timeout("test", "timeout"), true},
+		{errors.InternalServerError("test", "internal"), true},
+		{errors.ServiceUnavailable("test", "unavailable"), true},
+		// 服务端返回的错误被客户端解析
+		{stderrors.New(errors.ServiceUnavailable("test", "unavailable").Error()), true},
+		{stderrors.New("plain error"), false},
+	}
+
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+	want := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := p.backoff(i); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i, got, w)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(2); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("backoff with jitter = %v, want within [100ms, 300ms]", got)
+		}
+	}
+}
+
+func TestRetryPolicyIdempotent(t *testing.T) {
+	p := RetryPolicy{
+		Idempotent:    []string{"Payment.Query", "Payment.Create"},
+		NonIdempotent: []string{"Payment.Create"},
+	}
+	yes, no := true, false
+
+	tests := []struct {
+		method     string
+		idempotent *bool
+		want       bool
+	}{
+		{"Payment.Query", nil, true},
+		// 未标记的方法按非幂等处理
+		{"Payment.Refund", nil, false},
+		// NonIdempotent优先于Idempotent
+		{"Payment.Create", nil, false},
+		// 调用时显式标记优先于策略中的配置
+		{"Payment.Query", &no, false},
+		{"Payment.Create", &yes, true},
+	}
+	for _, tt := range tests {
+		req := newRequest("pay", tt.method, nil)
+		if got := p.idempotent(req, tt.idempotent); got != tt.want {
+			t.Errorf("idempotent(%s, %v) = %v, want %v", tt.method, tt.idempotent, got, tt.want)
+		}
+	}
+
+	if got := (&RetryPolicy{}).attempts(); got != 1 {
+		t.Errorf("attempts with zero MaxAttempts = %d, want 1", got)
+	}
+}
+
+var (
+	unavailable  = errors.ServiceUnavailable("test", "unavailable")
+	notConnected = errors.ServiceUnavailable(idNotConnected, "no available connection")
+)
+
+// failing 按顺序返回errs中的错误，用完后返回nil
+func failing(attempts *int, errs ...error) CallWrapper {
+	return func(CallFunc) CallFunc {
+		return func(ctx context.Context, req Request, resp interface{}, opts CallOptions) error {
+			*attempts++
+			if *attempts <= len(errs) {
+				return errs[*attempts-1]
+			}
+			return nil
+		}
+	}
+}
+
+func TestCallRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2, Idempotent: []string{"Test.Call"}}
+	badRequest := errors.BadRequest("test", "bad")
+
+	tests := []struct {
+		name     string
+		errs     []error
+		opts     []CallOption
+		wantErr  error
+		attempts int
+	}{
+		{"success after retries", []error{unavailable, unavailable}, nil, nil, 3},
+		{"budget exhausted", []error{unavailable, unavailable, unavailable}, nil, unavailable, 3},
+		{"client error is not retried", []error{badRequest}, nil, badRequest, 1},
+		{"non idempotent call", []error{unavailable}, []CallOption{WithIdempotent(false)}, unavailable, 1},
+		{"non idempotent call not sent", []error{notConnected}, []CallOption{WithIdempotent(false)}, nil, 2},
+		{"retry func", []error{badRequest, badRequest}, []CallOption{WithRetry(RetryAlways)}, nil, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			c := NewClient(SetRetryPolicy(policy))
+			opts := append([]CallOption{WrapCall(failing(&attempts, tt.errs...))}, tt.opts...)
+			err := c.Call(context.Background(), c.NewRequest("test", "Test.Call", nil), nil, opts...)
+			if err != tt.wantErr {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.attempts {
+				t.Fatalf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestCallRetryUnmarkedMethod(t *testing.T) {
+	timeout := errors.Timeout("test", "timeout")
+	shuttingDown := errors.ServiceUnavailable(idShuttingDown, "shutting down")
+	clientFull := errors.TooManyRequests(IdBulkheadFull, "full")
+
+	tests := []struct {
+		name     string
+		errs     []error
+		wantErr  error
+		attempts int
+	}{
+		// 超时时服务端可能已经执行，未标记幂等的方法不重试
+		{"timeout", []error{timeout}, timeout, 1},
+		{"transport error", []error{unavailable}, unavailable, 1},
+		{"not connected", []error{notConnected, notConnected}, nil, 3},
+		{"shutting down", []error{shuttingDown}, nil, 2},
+		{"breaker open", []error{errors.ServiceUnavailable(IdBreakerOpen, "open")}, nil, 2},
+		{"bulkhead full", []error{errors.ServiceUnavailable(IdBulkheadFull, "full")}, nil, 2},
+		// 客户端的舱壁是本地的限制，重试也不会成功
+		{"client bulkhead full", []error{clientFull}, clientFull, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			c := NewClient(SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Retry: RetryAlways}))
+			err := c.Call(context.Background(), c.NewRequest("test", "Test.Call", nil), nil, WrapCall(failing(&attempts, tt.errs...)))
+			if err != tt.wantErr {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.attempts {
+				t.Fatalf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestCallRetryStopsAtDeadline(t *testing.T) {
+	attempts := 0
+	c := NewClient(SetRetryPolicy(RetryPolicy{MaxAttempts: 10, InitialBackoff: 40 * time.Millisecond}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := c.Call(ctx, c.NewRequest("test", "Test.Call", nil), nil, WrapCall(failing(&attempts, unavailable, unavailable, unavailable, unavailable, unavailable)), WithIdempotent(true))
+	if err != unavailable {
+		t.Fatalf("got %v, want the last error", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", attempts)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Fatalf("call took %v after the deadline", d)
+	}
+}
@@ -3,19 +3,32 @@ package client
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"go-micro/core/debug"
 	"go-micro/core/errors"
-	"io/ioutil"
+	"go-micro/rpc/codec"
+	"go-micro/rpc/registry"
+	"go-micro/rpc/selector"
+	"net"
 	"net/rpc"
-	"net/rpc/jsonrpc"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type rpcClient struct {
-	opts *dialOptions
-	mp   *managePool
-	id   int64
+	opts  *dialOptions
+	mp    *managePool
+	mux   *muxConns
+	cache *nodeCache
+	certs *certManagers
+	id    int64
+
+	mu      sync.Mutex // protects watcher, closed
+	watcher registry.Watcher
+	closed  bool
+	exit    chan struct{}
+	// watch协程退出时关闭
+	watched chan struct{}
 }
 
 func NewClient(opt ...DialOption) (client *rpcClient) {
@@ -25,34 +38,67 @@ func NewClient(opt ...DialOption) (client *rpcClient) {
 	}
 
 	client = &rpcClient{
-		opts: opts,
-		mp:   newManagePool(),
-	}
-
-	poolOpts := PoolOptions{
-		Size: opts.poolsize,
-		TTL:  opts.poolTTL,
+		opts:  opts,
+		mp:    newManagePool(),
+		mux:   newMuxConns(),
+		cache: newNodeCache(DefaultRegistryCacheTTL),
+		certs: newCertManagers(),
+		exit:  make(chan struct{}),
 	}
 
 	for serverName, server := range opts.Servers {
+		// 多路复用的连接在第一次调用时建立
+		if server.Address == "" || opts.multiplex {
+			continue
+		}
 		debug.PrintDirExePos(dir+"NewClient", "创建 %v 连接池", serverName)
-		poolOpts.CreateConnectHandle = client.newConnect(serverName, server)
-		pool, err := initPool(poolOpts)
-		if err == ErrCreateConnHandleNotExit {
+		node := &registry.Node{Id: serverName, Address: server.Address}
+		_, err := client.getPool(serverName, node, client.contentType(serverName, nil))
+		if err != nil {
 			debug.PrintErrDirExePos(dir+"NewClient", err, "创建%v连接池出现异常", serverName)
-			continue
 		}
+	}
 
-		client.mp.Add(serverName, pool)
+	if opts.registry != nil {
+		client.watched = make(chan struct{})
+		go client.watch()
 	}
 
 	return
 }
 
+// Close 停止监听注册中心并关闭所有连接池与多路复用连接，之后不应再使用该客户端
+func (c *rpcClient) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.exit)
+	if c.watcher != nil {
+		c.watcher.Stop()
+	}
+	c.mu.Unlock()
+
+	if c.watched != nil {
+		<-c.watched
+	}
+	c.mp.Close()
+	c.mux.Close()
+	return nil
+}
+
 // 回收连接
 func (c *rpcClient) ConnRelease(serverName string, conn Conn) {
-	pool, ok := c.mp.Get(serverName)
+	if conn == nil {
+		return
+	}
+
+	pool, ok := c.mp.Get(poolKey{address: conn.Remote(), contentType: conn.ContentType()})
 	if !ok {
+		// 节点已经下线，连接池已被移除
+		conn.Close()
 		return
 	}
 
@@ -61,36 +107,96 @@ func (c *rpcClient) ConnRelease(serverName string, conn Conn) {
 
 // 根据服务名创建连接
 func (c *rpcClient) NewConnect(serverName string) (Conn, error) {
-	pool, ok := c.mp.Get(serverName)
-	if !ok {
-		debug.PrintErrDirExePos(dir+":NewConnect", ErrNotServer, "获取%v连接池错误", serverName)
-		return nil, ErrNotServer
+	node, err := c.next(serverName, c.opts.callOptions)
+	if err != nil {
+		debug.PrintErrDirExePos(dir+":NewConnect", err, "获取%v服务节点错误", serverName)
+		return nil, err
+	}
+	// 通过NewConnect获取的连接由调用方使用，不统计节点的调用结果
+	c.opts.callOptions.selector.Mark(serverName, node, nil)
+
+	return c.connect(context.TODO(), serverName, node, c.contentType(serverName, nil))
+}
+
+// 选择本次调用的节点，重试时优先排除已经失败的节点
+func (c *rpcClient) next(serverName string, callOption CallOptions) (*registry.Node, error) {
+	var nodes []*registry.Node
+	if len(callOption.address) > 0 {
+		for _, addr := range callOption.address {
+			nodes = append(nodes, &registry.Node{Id: addr, Address: addr})
+		}
+	} else {
+		var err error
+		if nodes, err = c.lookup(serverName); err != nil {
+			return nil, err
+		}
 	}
 
-	ctx, _ := context.WithTimeout(context.TODO(), c.opts.connTimeout)
+	tried := make([]string, 0, len(callOption.tried))
+	for addr := range callOption.tried {
+		tried = append(tried, addr)
+	}
+	return callOption.selector.Select(serverName, nodes, selector.Exclude(tried...))
+}
+
+// 从节点的连接池中获取连接
+func (c *rpcClient) connect(ctx context.Context, serverName string, node *registry.Node, contentType string) (Conn, error) {
+	pool, err := c.getPool(serverName, node, contentType)
+	if err != nil {
+		debug.PrintErrDirExePos(dir+":connect", err, "获取%v连接池错误", serverName)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.opts.connTimeout)
+	defer cancel()
 	conn, err := pool.Get(ctx)
 	if err != nil {
-		debug.PrintErrDirExePos(dir+":NewConnect", ErrNotServer, "从连接池中获取%v连接错误", serverName)
-		return nil, errors.NotFound("go-micro/rpc/client/rpcClient.NewConnect", "server %s: not found", serverName)
+		debug.PrintErrDirExePos(dir+":connect", ErrNotServer, "从连接池中获取%v连接错误", serverName)
+		return nil, errors.ServiceUnavailable(idNotConnected, "server %s: no available connection", serverName)
 	}
 
 	return conn, nil
-
 }
 
-func (c *rpcClient) call(ctx context.Context, req Request, resp interface{}, callOption CallOptions) error {
-	conn, err := c.NewConnect(req.Service())
+func (c *rpcClient) call(ctx context.Context, req Request, resp interface{}, callOption CallOptions) (err error) {
+	node, err := c.next(req.Service(), callOption)
+	if err != nil {
+		debug.PrintErrDirExePos(dir, err, "获取服务节点 %v 异常", req.Service())
+		return err
+	}
 	defer func() {
-		c.ConnRelease(req.Service(), conn)
+		callOption.selector.Mark(req.Service(), node, err)
+		if err != nil && callOption.tried != nil {
+			callOption.tried[node.Address] = struct{}{}
+		}
 	}()
 
+	ncall := c.callNode
+	for i := len(callOption.NodeWrappers); i > 0; i-- {
+		ncall = callOption.NodeWrappers[i-1](ncall)
+	}
+	return ncall(ctx, node, req, resp, callOption)
+}
+
+// callNode 通过节点的连接发送请求
+func (c *rpcClient) callNode(ctx context.Context, node *registry.Node, req Request, resp interface{}, callOption CallOptions) error {
+	if c.opts.multiplex {
+		mc, err := c.muxConn(req.Service(), node, muxContentType(c.contentType(req.Service(), req)))
+		if err != nil {
+			debug.PrintErrDirExePos(dir, err, "获取服务连接 %v 异常", req.Service())
+			return errors.ServiceUnavailable(idNotConnected, "server %s: no available connection", req.Service())
+		}
+		return mc.call(ctx, req, resp, c.opts.sendCancel)
+	}
+
+	conn, err := c.connect(ctx, req.Service(), node, c.contentType(req.Service(), req))
 	if err != nil {
 		debug.PrintErrDirExePos(dir, err, "获取服务连接 %v 异常", req.Service())
 		return err
 	}
+	defer c.ConnRelease(req.Service(), conn)
 
 	return conn.Call(ctx, req, resp, callOption)
-
 }
 
 func (c *rpcClient) Call(ctx context.Context, req Request, resp interface{}, callOption ...CallOption) error {
@@ -123,98 +229,117 @@ func (c *rpcClient) Call(ctx context.Context, req Request, resp interface{}, cal
 		rcall = callOpts.CallWrappers[i-1](rcall)
 	}
 
-	//执行失败重试
-	retries := callOpts.retries
-	ch := make(chan error, retries+1)
+	//执行失败重试，重试时优先选择其他节点
+	callOpts.tried = make(map[string]struct{})
+	policy := callOpts.retryPolicy
+	attempts := policy.attempts()
+	idempotent := policy.idempotent(req, callOpts.idempotent)
 	var gerr error
-	for i := 0; i < retries; i++ {
-		go func(i int) {
-			ch <- rcall(ctx, req, resp, callOpts)
-		}(i)
+	for i := 0; i < attempts; i++ {
+		if i > 0 && !sleep(ctx, policy.backoff(i)) {
+			return gerr
+		}
 
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.PerAttemptTimeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, policy.PerAttemptTimeout)
+		}
+		ch := make(chan error, 1)
+		go func() {
+			ch <- rcall(actx, req, resp, callOpts)
+		}()
+
+		var err error
 		select {
 		case <-ctx.Done():
+			cancel()
 			return errors.Timeout("go-micro/rpc/client/rpcClient.Call", "server %s.%s timeout", req.Service(), req.Method())
-		case err := <-ch:
-			// if the call succeeded lets bail early
-			if err == nil {
-				return nil
-			}
-
-			retry, rerr := callOpts.retry(ctx, req, i, err)
-			if rerr != nil {
-				return rerr
-			}
-
-			if !retry {
-				return err
-			}
-
-			gerr = err
-
+		case err = <-ch:
+			cancel()
+		}
+		// if the call succeeded lets bail early
+		if err == nil {
+			return nil
 		}
+		gerr = err
 
+		retry, rerr := policy.retry(ctx, req, i, err, idempotent)
+		if rerr != nil {
+			return rerr
+		}
+		if !retry {
+			return err
+		}
 	}
 
 	return gerr
-
 }
 
 func (c *rpcClient) NewRequest(serverName string, serverMethod string, req interface{}, opts ...RequestOption) Request {
 	return newRequest(serverName, serverMethod, req, opts...)
 }
 
+func (c *rpcClient) PoolStats() []NodePoolStats {
+	return c.mp.Stats()
+}
+
 func (c *rpcClient) newConnect(serverName string, s *Server) CreateConnectHandle {
 	return func() (Conn, error) {
-		c.id++
+		id := atomic.AddInt64(&c.id, 1)
 		//建立连接
 		client, err := c.getClient(s)
 		if err != nil {
 			debug.PrintErrDirExePos(dir+":newConnect", err, "创建%v服务出现异常", serverName)
 			return &connect{
-				id:  c.id,
-				err: errors.InternalServerError("go-micro/rpc/client/rpcClient.NewConnect", "server %s: create rpc client err %s ", serverName, err),
+				id:  id,
+				err: errors.InternalServerError(idNotConnected, "server %s: create rpc client err %s ", serverName, err),
 			}, err
 		}
 
 		return &connect{
-			client:  client,
-			id:      c.id,
-			addr:    s.Address,
-			err:     nil,
-			created: time.Now(),
+			client:      client,
+			id:          id,
+			addr:        s.Address,
+			contentType: s.ContentType,
+			err:         nil,
+			created:     time.Now(),
 		}, nil
 	}
 }
 
 func (c *rpcClient) getClient(s *Server) (client *rpc.Client, err error) {
+	newCodec, ok := c.opts.codecs[s.ContentType]
+	if !ok {
+		return nil, codec.ErrUnknownContentType
+	}
 
-	debug.DD("openssl %v; s = %v", s.Openssl, s)
-	if !s.Openssl {
-		return jsonrpc.Dial(s.NetWork, s.Address)
+	conn, err := c.dial(s)
+	if err != nil {
+		return nil, err
 	}
 
-	certPool := x509.NewCertPool()
-	certBytes, err := ioutil.ReadFile(s.CertFile)
+	cc, err := newCodec(conn)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
-	certPool.AppendCertsFromPEM(certBytes)
+	return rpc.NewClientWithCodec(cc), nil
+}
 
-	config := &tls.Config{
-		RootCAs:    certPool,
-		ServerName: s.TlsServerName,
+func (c *rpcClient) dial(s *Server) (net.Conn, error) {
+	debug.DD("openssl %v; s = %v", s.Openssl, s)
+	dialer := &net.Dialer{Timeout: c.opts.connTimeout}
+	if !s.Openssl {
+		return dialer.Dial(s.NetWork, s.Address)
 	}
 
-	conn, err := tls.Dial(s.NetWork, s.Address, config)
-	//conn, err := rpc.DialHTTP("tcp", ":8000")
+	m, err := c.certs.get(s)
 	if err != nil {
-		//log.Fatal(err)
 		return nil, err
 	}
+	config := m.ClientConfig(s.TlsServerName)
 
-	//client, err := rpc.Dial("tcp", ":9503")
-	return jsonrpc.NewClient(conn), err
+	return tls.DialWithDialer(dialer, s.NetWork, s.Address, config)
 }
 
 //调度失败-》重试
@@ -3,36 +3,44 @@ package client
 import (
 	"context"
 	"go-micro/core/errors"
+	"go-micro/rpc/codec"
+	"go-micro/rpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"io"
+	"net"
+	"net/http"
 	"net/rpc"
+	"sync"
 	"time"
 )
 
 type connect struct {
-	client  *rpc.Client
-	id      int64
-	addr    string
-	err     error
-	created time.Time
+	client      *rpc.Client
+	id          int64
+	addr        string
+	contentType string
+	created     time.Time
+
+	mu  sync.Mutex // protects err
+	err error
 }
 
-// 调用
+// 调用，超时返回后rpc.Client中等待的调用要等到服务端响应才会移除，需要取消时使用SetMultiplex
 func (c *connect) Call(ctx context.Context, req Request, resp interface{}, callOption CallOptions) error {
-	ch := make(chan error, 1)
-	go func() {
-		//ch <- c.client.Call(req.Method(), req.Body(), resp)
-
-		ch <- c.client.Call(req.Method(), &Message{
-			//Header: req.GetHeader(),
-			Header: req.Header(),
-			Body:   req.Body(),
-		}, resp)
-	}()
+	call := c.client.Go(req.Method(), &Message{
+		Header: header(ctx, req),
+		Body:   req.Body(),
+	}, resp, make(chan *rpc.Call, 1))
 
 	select {
-	case err := <-ch:
-		if err != nil {
-			return errors.Parse(err.Error())
-			return errors.InternalServerError("go-micro/rpc/client/rpcConnect.Call", "server %s.%s.%v", req.Service(), req.Method(), err.Error())
+	case <-call.Done:
+		if call.Error != nil {
+			c.check(call.Error)
+			// 连接断开时请求不一定到达服务端，返回503以便重试其他节点
+			if isTransportError(call.Error) {
+				return errors.ServiceUnavailable("go-micro/rpc/client/rpcConnect.Call", "server %s.%s: %v", req.Service(), req.Method(), call.Error)
+			}
+			return errors.Parse(call.Error.Error())
 		}
 		return nil
 	case <-ctx.Done():
@@ -41,7 +49,26 @@ func (c *connect) Call(ctx context.Context, req Request, resp interface{}, callO
 	}
 }
 
+// 请求头中附加context的metadata与剩余的超时时间，重试时请求会被多次发送，因此不修改req本身
+func header(ctx context.Context, req Request) http.Header {
+	h := req.Header().Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	if md, ok := metadata.FromContext(ctx); ok {
+		metadata.ToHeader(md, h)
+	}
+	if d, ok := ctx.Deadline(); ok {
+		metadata.SetTimeout(h, time.Until(d))
+	}
+	return h
+}
+
 func (c *connect) Close() error {
+	// 创建失败的连接没有rpc.Client
+	if c.client == nil {
+		return nil
+	}
 	return c.client.Close()
 }
 
@@ -53,10 +80,52 @@ func (c *connect) Remote() string {
 	return c.addr
 }
 
+func (c *connect) ContentType() string {
+	return c.contentType
+}
+
 func (c *connect) Error() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.err
 }
 
+// Ping 健康检查，只要收到服务端的响应就说明连接可用，不支持codec.PingMethod的旧版本服务端返回的错误也是响应。
+// 服务端繁忙时响应可能超时，超时不会将连接标记为不可用，连接断开由之后的调用发现
+func (c *connect) Ping(ctx context.Context) error {
+	call := c.client.Go(codec.PingMethod, &Message{Header: http.Header{}, Body: &emptypb.Empty{}}, &emptypb.Empty{}, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		c.check(call.Error)
+		return c.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 连接断开后rpc.Client不能再使用，记录错误后连接池不再复用该连接
+func (c *connect) check(err error) {
+	if isTransportError(err) {
+		c.setErr(err)
+	}
+}
+
+func (c *connect) setErr(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+}
+
+func isTransportError(err error) bool {
+	if err == rpc.ErrShutdown || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
 func (c *connect) Id() int64 {
 	return c.id
 }
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"testing"
+	"time"
+)
+
+func TestPingTimeoutKeepsConnection(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		s, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- s
+		// 读取请求但不响应
+		ioutil.ReadAll(s)
+	}()
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &connect{client: rpc.NewClientWithCodec(jsonrpc.NewClientCodec(c))}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := conn.Ping(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := conn.Error(); err != nil {
+		t.Fatalf("a ping timeout marked the connection bad: %v", err)
+	}
+
+	// 连接断开后健康检查失败
+	(<-accepted).Close()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := conn.Ping(ctx); err == nil || conn.Error() == nil {
+		t.Fatalf("got %v, want the connection marked bad after it closed", err)
+	}
+}
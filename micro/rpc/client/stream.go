@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"go-micro/core/debug"
+	"go-micro/core/errors"
+	"go-micro/rpc/codec"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Stream 客户端的流，服务端handler的签名见server.Stream
+type Stream interface {
+	Context() context.Context
+	Request() Request
+	// 向服务端发送消息
+	Send(msg interface{}) error
+	// 接收服务端的消息，handler正常返回后返回io.EOF，否则返回handler的错误
+	Recv(msg interface{}) error
+	// 不再发送消息，服务端的Recv会返回io.EOF
+	CloseSend() error
+	// 取消流，服务端handler的context会被取消
+	Close() error
+}
+
+// Stream 打开一个流，流不使用RequestTimeout与重试，需要超时时通过ctx设置
+func (c *rpcClient) Stream(ctx context.Context, req Request, callOption ...CallOption) (Stream, error) {
+	callOpts := c.opts.callOptions
+	for _, opt := range callOption {
+		opt(&callOpts)
+	}
+
+	node, err := c.next(req.Service(), callOpts)
+	if err != nil {
+		debug.PrintErrDirExePos(dir+":Stream", err, "获取服务节点 %v 异常", req.Service())
+		return nil, err
+	}
+
+	sc, err := c.muxConn(req.Service(), node, muxContentType(c.contentType(req.Service(), req)))
+	callOpts.selector.Mark(req.Service(), node, err)
+	if err != nil {
+		debug.PrintErrDirExePos(dir+":Stream", err, "获取服务连接 %v 异常", req.Service())
+		return nil, errors.ServiceUnavailable("go-micro/rpc/client/rpcClient.Stream", "server %s: no available connection", req.Service())
+	}
+	return sc.open(ctx, req)
+}
+
+type clientStream struct {
+	ctx           context.Context
+	cancel        context.CancelFunc
+	req           Request
+	seq           uint64
+	serviceMethod string
+	conn          *muxConn
+
+	mu     sync.Mutex // protects queue, err
+	queue  [][]byte
+	err    error // 流结束的原因，io.EOF表示正常结束
+	limit  int   // queue的长度上限，0表示不限制
+	notify chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	// 向服务端发送消息的额度，收到服务端的第一个window帧之前为0
+	window *codec.SendWindow
+	// 接收服务端消息的窗口，大小为limit
+	recv *codec.RecvWindow
+}
+
+func (s *clientStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *clientStream) Request() Request {
+	return s.req
+}
+
+// Send 服务端的接收窗口已满时等待handler接收
+func (s *clientStream) Send(msg interface{}) error {
+	if err := s.finished(); err != nil {
+		return err
+	}
+	if !s.window.Acquire(s.done) {
+		return s.finished()
+	}
+	body, err := s.conn.m.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.write(codec.StreamSend, nil, body)
+}
+
+func (s *clientStream) Recv(msg interface{}) error {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			b := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			if n := s.recv.Consume(); n > 0 && s.finished() == nil {
+				s.write(codec.StreamWindow, http.Header{codec.StreamWindowHeader: {strconv.Itoa(n)}}, nil)
+			}
+			return s.conn.m.Unmarshal(b, msg)
+		}
+		err := s.err
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.done:
+		}
+	}
+}
+
+func (s *clientStream) CloseSend() error {
+	if s.finished() != nil {
+		return nil
+	}
+	return s.write(codec.StreamClose, nil, nil)
+}
+
+func (s *clientStream) Close() error {
+	s.cancel()
+	return nil
+}
+
+func (s *clientStream) write(op string, h http.Header, body []byte) error {
+	if h == nil {
+		h = http.Header{}
+	}
+	h.Set(codec.StreamHeader, op)
+	return s.conn.write(&codec.Frame{
+		Seq:           s.seq,
+		ServiceMethod: s.serviceMethod,
+		Header:        h,
+		Body:          body,
+	})
+}
+
+// 超时或者调用方取消时通知服务端取消handler
+func (s *clientStream) watch() {
+	select {
+	case <-s.done:
+		return
+	case <-s.ctx.Done():
+	}
+
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	s.write(codec.StreamCancel, nil, nil)
+
+	err := s.ctx.Err()
+	if err == context.DeadlineExceeded {
+		err = errors.Timeout("go-micro/rpc/client/rpcStream", "stream %s.%s timeout", s.req.Service(), s.req.Method())
+	}
+	s.finish(err)
+}
+
+func (s *clientStream) receive(f *codec.Frame) {
+	switch f.Header.Get(codec.StreamHeader) {
+	case codec.StreamSend:
+		s.push(f.Body)
+		return
+	case codec.StreamWindow:
+		n, _ := strconv.Atoi(f.Header.Get(codec.StreamWindowHeader))
+		s.window.Grant(n)
+		return
+	}
+	// 结束帧，服务端拒绝打开流时返回的是不带StreamHeader的普通响应
+	var err error = io.EOF
+	if f.Error != "" {
+		err = errors.Parse(f.Error)
+	}
+	s.finish(err)
+}
+
+// 读取协程收到服务端的消息，读取协程不能等待Recv，否则会阻塞连接上的其他调用；
+// 服务端按窗口发送时消息不会超过上限，没有遵守窗口导致超过上限时取消流
+func (s *clientStream) push(body []byte) {
+	s.mu.Lock()
+	if s.limit > 0 && len(s.queue) >= s.limit {
+		s.mu.Unlock()
+		s.overflow()
+		return
+	}
+	s.queue = append(s.queue, body)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// 通知服务端取消handler，未接收的消息被丢弃，Recv返回429
+func (s *clientStream) overflow() {
+	err := errors.TooManyRequests("go-micro/rpc/client/rpcStream", "stream %s.%s has more than %d unreceived messages",
+		s.req.Service(), s.req.Method(), s.limit)
+	s.mu.Lock()
+	s.queue = nil
+	s.mu.Unlock()
+	s.finish(err)
+	// 在读取协程之外发送，避免写阻塞时影响其他调用的响应
+	go s.write(codec.StreamCancel, nil, nil)
+}
+
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.done)
+		s.conn.remove(s.seq)
+		s.cancel()
+	})
+}
+
+func (s *clientStream) finished() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"go-micro/core/errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func openTestStream(t *testing.T, mc *muxConn, ctx context.Context, method string, args *muxArgs) *clientStream {
+	st, err := mc.open(ctx, newRequest("test", method, args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// 等待服务端收到取消帧
+func waitCancelled(t *testing.T, srv *muxServer, seq uint64) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		for _, s := range srv.cancelled() {
+			if s == seq {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no cancel frame for stream %d, got %v", seq, srv.cancelled())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamRecv(t *testing.T) {
+	mc, _ := newMuxPair(t)
+	defer mc.close(errMuxConnClosed)
+
+	st := openTestStream(t, mc, context.Background(), "Test.Count", &muxArgs{N: 5})
+	for i := 0; ; i++ {
+		var n int
+		err := st.Recv(&n)
+		if err == io.EOF {
+			if i != 5 {
+				t.Fatalf("got %d messages, want 5", i)
+			}
+			break
+		}
+		if err != nil || n != i {
+			t.Fatalf("got %d %v, want %d", n, err, i)
+		}
+	}
+	if n := mc.pendingLen(); n != 0 {
+		t.Fatalf("pending = %d after the stream ended, want 0", n)
+	}
+}
+
+func TestStreamBidi(t *testing.T) {
+	mc, _ := newMuxPair(t)
+	defer mc.close(errMuxConnClosed)
+
+	st := openTestStream(t, mc, context.Background(), "Test.Echo", &muxArgs{})
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := st.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+		var reply string
+		if err := st.Recv(&reply); err != nil || reply != msg {
+			t.Fatalf("got %q %v, want %q", reply, err, msg)
+		}
+	}
+	st.CloseSend()
+	var reply string
+	if err := st.Recv(&reply); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+	if err := st.Send("d"); err != io.EOF {
+		t.Fatalf("Send after the stream ended got %v, want io.EOF", err)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	mc, srv := newMuxPair(t)
+	defer mc.close(errMuxConnClosed)
+
+	st := openTestStream(t, mc, context.Background(), "Test.Echo", &muxArgs{})
+	st.Close()
+	waitCancelled(t, srv, st.seq)
+	var reply string
+	if err := st.Recv(&reply); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	st = openTestStream(t, mc, ctx, "Test.Echo", &muxArgs{})
+	if err := st.Recv(&reply); errors.FromError(err).Code != 408 {
+		t.Fatalf("got %v, want a 408 timeout", err)
+	}
+	waitCancelled(t, srv, st.seq)
+}
+
+func TestStreamOverflow(t *testing.T) {
+	mc, srv := newMuxPair(t)
+	defer mc.close(errMuxConnClosed)
+	mc.streamBuffer = 4
+
+	// 不接收消息，超过上限后取消流
+	st := openTestStream(t, mc, context.Background(), "Test.Count", &muxArgs{N: 100})
+	waitCancelled(t, srv, st.seq)
+	var n int
+	if err := st.Recv(&n); errors.FromError(err).Code != 429 {
+		t.Fatalf("got %v, want a 429 overflow error", err)
+	}
+
+	// 连接上的其他调用不受影响
+	var rsp int
+	if err := mc.call(context.Background(), newRequest("test", "Test.Double", &muxArgs{N: 2}), &rsp, true); err != nil || rsp != 4 {
+		t.Fatalf("call after overflow got %d, %v", rsp, err)
+	}
+}
@@ -1,7 +1,16 @@
 package client
 
-import "context"
+import (
+	"context"
+	"go-micro/rpc/registry"
+)
 
 type CallFunc func(ctx context.Context, req Request, resp interface{}, callOption CallOptions) error
 
 type CallWrapper func(callFunc CallFunc) CallFunc
+
+// NodeCallFunc 选定节点之后的调用，每次重试都会重新选择节点
+type NodeCallFunc func(ctx context.Context, node *registry.Node, req Request, resp interface{}, callOption CallOptions) error
+
+// NodeWrapper 在CallWrapper之内、选定节点之后执行，可以按节点处理调用
+type NodeWrapper func(callFunc NodeCallFunc) NodeCallFunc
@@ -0,0 +1,59 @@
+// Package codec 管理rpc的序列化方式，按content-type注册，客户端与服务端在建立连接后通过首帧协商使用的序列化方式
+package codec
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeProtobuf = "application/protobuf"
+	// 使用数据帧传输的json，流式调用不能使用jsonrpc协议，json请求的流改用该方式
+	ContentTypeJSONFrame = "application/json+frame"
+)
+
+// PingMethod 连接池健康检查的方法，服务端在读取请求后直接响应，不经过HandlerWrapper，
+// 使用JSON-RPC保留的rpc.前缀，不会与注册的服务冲突
+const PingMethod = "rpc.ping"
+
+// 未协商时使用的序列化方式，兼容原有的jsonrpc客户端
+var DefaultContentType = ContentTypeJSON
+
+var ErrUnknownContentType = errors.New("codec: unknown content-type")
+
+// Marshaler 请求参数与响应的序列化方法
+type Marshaler interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+	String() string
+}
+
+var (
+	lock       sync.RWMutex
+	marshalers = map[string]Marshaler{
+		ContentTypeJSON:      jsonMarshaler{},
+		ContentTypeMsgpack:   newMsgpackMarshaler(),
+		ContentTypeProtobuf:  protoMarshaler{},
+		ContentTypeJSONFrame: jsonMarshaler{},
+	}
+)
+
+// Register 注册content-type对应的序列化方法，已存在时覆盖
+func Register(contentType string, m Marshaler) {
+	lock.Lock()
+	marshalers[contentType] = m
+	lock.Unlock()
+}
+
+// Get 获取content-type对应的序列化方法
+func Get(contentType string) (Marshaler, error) {
+	lock.RLock()
+	m, ok := marshalers[contentType]
+	lock.RUnlock()
+	if !ok {
+		return nil, ErrUnknownContentType
+	}
+	return m, nil
+}
@@ -0,0 +1,214 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// 协商首帧的标识，json请求不会以该字节开头，因此没有首帧的连接按DefaultContentType处理
+const preambleMagic byte = 0x00
+
+// 单帧的最大长度
+var MaxFrameSize uint32 = 16 << 20
+
+// 流式调用通过数据帧的StreamHeader区分消息类型，同一个流的数据帧使用相同的Seq
+const StreamHeader = "Micro-Stream"
+
+const (
+	// 客户端打开流，Body为请求参数
+	StreamOpen = "open"
+	// 流中的消息，两端都可以发送
+	StreamSend = "send"
+	// 客户端不再发送消息
+	StreamClose = "close"
+	// 客户端取消流，也用于取消多路复用连接上的普通调用
+	StreamCancel = "cancel"
+	// 服务端结束流，Error为handler返回的错误
+	StreamEnd = "end"
+	// 接收方归还发送额度，两端都可以发送
+	StreamWindow = "window"
+)
+
+// StreamWindowHeader 打开流的帧中为客户端的接收窗口，window帧中为归还的额度；
+// 服务端开始执行handler前发送一个window帧告知自己的接收窗口，0表示不限制
+const StreamWindowHeader = "Micro-Stream-Window"
+
+var (
+	ErrFrameTooLarge = errors.New("codec: frame too large")
+	ErrInvalidFrame  = errors.New("codec: invalid frame")
+)
+
+// WritePreamble 客户端建立连接后发送的首帧：magic + 长度 + content-type
+func WritePreamble(w io.Writer, contentType string) error {
+	if len(contentType) > 255 {
+		return ErrInvalidFrame
+	}
+	b := make([]byte, 0, len(contentType)+2)
+	b = append(b, preambleMagic, byte(len(contentType)))
+	b = append(b, contentType...)
+	_, err := w.Write(b)
+	return err
+}
+
+// ReadPreamble 服务端读取首帧，连接没有发送首帧时返回DefaultContentType且不消费数据
+func ReadPreamble(r *bufio.Reader) (string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if b[0] != preambleMagic {
+		return DefaultContentType, nil
+	}
+
+	if _, err := r.Discard(1); err != nil {
+		return "", err
+	}
+	n, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	ct := make([]byte, n)
+	if _, err := io.ReadFull(r, ct); err != nil {
+		return "", err
+	}
+	return string(ct), nil
+}
+
+// Frame 长度前缀的数据帧，Header部分使用固定的二进制格式，Body由Marshaler序列化
+//
+//	uint32 长度 | uvarint Seq | string ServiceMethod | string Error | Header | Body
+type Frame struct {
+	Seq           uint64
+	ServiceMethod string
+	Error         string
+	Header        http.Header
+	Body          []byte
+}
+
+func (f *Frame) reset() {
+	f.Seq = 0
+	f.ServiceMethod = ""
+	f.Error = ""
+	f.Header = nil
+	f.Body = nil
+}
+
+func WriteFrame(w io.Writer, f *Frame) error {
+	b := make([]byte, 4, 64+len(f.Body))
+	b = appendUvarint(b, f.Seq)
+	b = appendString(b, f.ServiceMethod)
+	b = appendString(b, f.Error)
+	b = appendUvarint(b, uint64(len(f.Header)))
+	for k, vs := range f.Header {
+		b = appendString(b, k)
+		b = appendUvarint(b, uint64(len(vs)))
+		for _, v := range vs {
+			b = appendString(b, v)
+		}
+	}
+	b = append(b, f.Body...)
+
+	if uint32(len(b)-4) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	_, err := w.Write(b)
+	return err
+}
+
+func ReadFrame(r io.Reader, f *Frame) error {
+	f.reset()
+
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	d := decoder{b: b}
+	f.Seq = d.uvarint()
+	f.ServiceMethod = d.string()
+	f.Error = d.string()
+	if count := d.count(); count > 0 {
+		f.Header = make(http.Header, count)
+		for i := 0; i < count && d.err == nil; i++ {
+			k := d.string()
+			vs := make([]string, d.count())
+			for j := range vs {
+				vs[j] = d.string()
+			}
+			f.Header[k] = vs
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	f.Body = d.b
+	return nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = ErrInvalidFrame
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// 读取元素个数，每个元素至少占用一个字节，超过剩余长度说明数据有误
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.err = ErrInvalidFrame
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(len(d.b)) {
+		d.err = ErrInvalidFrame
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
@@ -0,0 +1,87 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	var buf bytes.Buffer
+	in := &Frame{
+		Seq:           7,
+		ServiceMethod: "Arith.Add",
+		Header:        http.Header{"Trace-Id": []string{"a", "b"}},
+		Body:          []byte("body"),
+	}
+	if err := WriteFrame(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(Frame)
+	if err := ReadFrame(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Seq != in.Seq || out.ServiceMethod != in.ServiceMethod || string(out.Body) != "body" {
+		t.Fatalf("expected %+v got %+v", in, out)
+	}
+	if out.Header.Get("Trace-Id") != "a" || len(out.Header["Trace-Id"]) != 2 {
+		t.Fatalf("expected header %v got %v", in.Header, out.Header)
+	}
+}
+
+func TestInvalidFrame(t *testing.T) {
+	// 长度为3，header中的字符串长度超出剩余长度
+	b := []byte{0, 0, 0, 3, 1, 10, 'a'}
+	if err := ReadFrame(bytes.NewReader(b), new(Frame)); err != ErrInvalidFrame {
+		t.Fatalf("expected %v got %v", ErrInvalidFrame, err)
+	}
+}
+
+func TestPreamble(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePreamble(&buf, ContentTypeMsgpack); err != nil {
+		t.Fatal(err)
+	}
+	ct, err := ReadPreamble(bufio.NewReader(&buf))
+	if err != nil || ct != ContentTypeMsgpack {
+		t.Fatalf("expected %s got %s %v", ContentTypeMsgpack, ct, err)
+	}
+
+	// 没有首帧的连接使用默认的序列化方式，且不消费数据
+	r := bufio.NewReader(bytes.NewReader([]byte(`{"method":"Arith.Add"}`)))
+	ct, err = ReadPreamble(r)
+	if err != nil || ct != DefaultContentType {
+		t.Fatalf("expected %s got %s %v", DefaultContentType, ct, err)
+	}
+	if b, _ := r.Peek(1); b[0] != '{' {
+		t.Fatal("preamble consumed request data")
+	}
+}
+
+func TestMarshalers(t *testing.T) {
+	type args struct {
+		A int
+		B string
+	}
+	for _, ct := range []string{ContentTypeJSON, ContentTypeMsgpack} {
+		m, err := Get(ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := m.Marshal(&args{A: 1, B: "b"})
+		if err != nil {
+			t.Fatalf("%s: %v", m, err)
+		}
+		var out args
+		if err := m.Unmarshal(b, &out); err != nil || out.A != 1 || out.B != "b" {
+			t.Fatalf("%s: expected %+v got %+v %v", m, args{A: 1, B: "b"}, out, err)
+		}
+	}
+
+	m, _ := Get(ContentTypeProtobuf)
+	if _, err := m.Marshal(1); err != ErrNotProtoMessage {
+		t.Fatalf("expected %v got %v", ErrNotProtoMessage, err)
+	}
+}
@@ -0,0 +1,74 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+var ErrNotProtoMessage = errors.New("codec: value does not implement proto.Message")
+
+type jsonMarshaler struct{}
+
+func (jsonMarshaler) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonMarshaler) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+func (jsonMarshaler) String() string {
+	return "json"
+}
+
+type msgpackMarshaler struct {
+	handle *codec.MsgpackHandle
+}
+
+func newMsgpackMarshaler() *msgpackMarshaler {
+	h := new(codec.MsgpackHandle)
+	// 使用新版规范区分string与[]byte
+	h.WriteExt = true
+	h.RawToString = true
+	return &msgpackMarshaler{handle: h}
+}
+
+func (m *msgpackMarshaler) Marshal(v interface{}) ([]byte, error) {
+	var b []byte
+	err := codec.NewEncoderBytes(&b, m.handle).Encode(v)
+	return b, err
+}
+
+func (m *msgpackMarshaler) Unmarshal(b []byte, v interface{}) error {
+	return codec.NewDecoderBytes(b, m.handle).Decode(v)
+}
+
+func (m *msgpackMarshaler) String() string {
+	return "msgpack"
+}
+
+// protoMarshaler 参数与响应需要实现proto.Message
+type protoMarshaler struct{}
+
+func (protoMarshaler) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (protoMarshaler) Unmarshal(b []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(b, m)
+}
+
+func (protoMarshaler) String() string {
+	return "protobuf"
+}
@@ -0,0 +1,94 @@
+package codec
+
+import "sync"
+
+// SendWindow 流的发送额度，每条消息消耗一个额度，额度用完时等待接收方的window帧，
+// 接收方只需要缓存窗口大小的消息，处理较慢时发送方等待而不是取消流
+type SendWindow struct {
+	mu        sync.Mutex
+	credit    int
+	unlimited bool
+	notify    chan struct{}
+}
+
+// NewSendWindow 没有额度的发送窗口，收到对端的窗口后通过Grant设置
+func NewSendWindow() *SendWindow {
+	return &SendWindow{notify: make(chan struct{}, 1)}
+}
+
+// Grant 增加n个额度，n小于等于0表示对端不限制
+func (w *SendWindow) Grant(n int) {
+	w.mu.Lock()
+	if n <= 0 {
+		w.unlimited = true
+	} else {
+		w.credit += n
+	}
+	w.mu.Unlock()
+	w.wake()
+}
+
+// Acquire 消耗一个额度，没有额度时等待，done关闭时返回false
+func (w *SendWindow) Acquire(done <-chan struct{}) bool {
+	for {
+		w.mu.Lock()
+		if w.unlimited || w.credit > 0 {
+			if !w.unlimited {
+				w.credit--
+			}
+			more := w.unlimited || w.credit > 0
+			w.mu.Unlock()
+			// 还有额度时唤醒其他等待的发送方
+			if more {
+				w.wake()
+			}
+			return true
+		}
+		w.mu.Unlock()
+
+		select {
+		case <-w.notify:
+		case <-done:
+			return false
+		}
+	}
+}
+
+func (w *SendWindow) wake() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// RecvWindow 流的接收窗口，处理的消息达到窗口的一半时归还额度
+type RecvWindow struct {
+	mu       sync.Mutex
+	size     int
+	consumed int
+}
+
+// NewRecvWindow size为最多缓存的消息数，小于等于0表示不限制
+func NewRecvWindow(size int) *RecvWindow {
+	return &RecvWindow{size: size}
+}
+
+func (w *RecvWindow) Size() int {
+	return w.size
+}
+
+// Consume 处理了一条消息，返回需要通过window帧归还的额度，0表示暂不归还
+func (w *RecvWindow) Consume() int {
+	if w.size <= 0 {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.consumed++
+	if w.consumed*2 < w.size {
+		return 0
+	}
+	n := w.consumed
+	w.consumed = 0
+	return n
+}
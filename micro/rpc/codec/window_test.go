@@ -0,0 +1,55 @@
+package codec
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendWindow(t *testing.T) {
+	w := NewSendWindow()
+	done := make(chan struct{})
+
+	// 没有额度时等待
+	acquired := make(chan bool, 1)
+	go func() { acquired <- w.Acquire(done) }()
+	select {
+	case <-acquired:
+		t.Fatal("Acquire returned without credit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	w.Grant(2)
+	if !<-acquired {
+		t.Fatal("Acquire failed after Grant")
+	}
+	if !w.Acquire(done) {
+		t.Fatal("Acquire failed with credit left")
+	}
+
+	// done关闭时放弃等待
+	go func() { acquired <- w.Acquire(done) }()
+	close(done)
+	if <-acquired {
+		t.Fatal("Acquire succeeded without credit")
+	}
+
+	w.Grant(0)
+	for i := 0; i < 10; i++ {
+		if !w.Acquire(nil) {
+			t.Fatal("Acquire failed on an unlimited window")
+		}
+	}
+}
+
+func TestRecvWindow(t *testing.T) {
+	w := NewRecvWindow(4)
+	if n := w.Consume(); n != 0 {
+		t.Fatalf("got %d after one message, want 0", n)
+	}
+	if n := w.Consume(); n != 2 {
+		t.Fatalf("got %d after half the window, want 2", n)
+	}
+	if n := NewRecvWindow(0).Consume(); n != 0 {
+		t.Fatalf("got %d on an unlimited window, want 0", n)
+	}
+}
@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"go-micro/core/errors"
+	"go-micro/core/router"
+	"go-micro/rpc/server"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler 网关转发的目标，*server.RpcServer 与 *server.Server 均实现了该接口
+type Handler interface {
+	Methods() []string
+	IsStream(serviceMethod string) bool
+	Call(ctx context.Context, req *server.Request, decode func(argv interface{}) error) (interface{}, error)
+}
+
+// Router 返回挂载所有服务方法的路由，配合 router.Register 使用
+func Router(h Handler) router.Router {
+	return func(g *gin.Engine) {
+		Register(g, h)
+	}
+}
+
+// Register 将已注册的服务方法挂载为 POST /{Service}/{Method}
+// 需要在服务注册完成之后调用，传入 gin.RouterGroup 可以添加统一的前缀。
+// 流式方法无法通过http调用，内置的调试服务不对外暴露，两者都不会挂载
+func Register(g gin.IRoutes, h Handler) {
+	for _, serviceMethod := range h.Methods() {
+		dot := strings.LastIndex(serviceMethod, ".")
+		if serviceMethod[:dot] == server.DebugServiceName || h.IsStream(serviceMethod) {
+			continue
+		}
+		g.POST("/"+serviceMethod[:dot]+"/"+serviceMethod[dot+1:], handle(h, serviceMethod))
+	}
+}
+
+func handle(h Handler, serviceMethod string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := &server.Request{
+			ServiceMethod: serviceMethod,
+			Header:        c.Request.Header.Clone(),
+		}
+
+		rsp, err := h.Call(c.Request.Context(), req, func(argv interface{}) error {
+			// 允许空的请求体，此时参数为零值
+			err := json.NewDecoder(c.Request.Body).Decode(argv)
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			e := errors.FromError(err)
+			c.JSON(status(e), e)
+			return
+		}
+		c.JSON(http.StatusOK, rsp)
+	}
+}
+
+// 将 errors.Error.Code 转换为http状态码，非http状态码的错误按500处理
+func status(e *errors.Error) int {
+	if e.Code >= 400 && e.Code < 600 {
+		return int(e.Code)
+	}
+	return http.StatusInternalServerError
+}
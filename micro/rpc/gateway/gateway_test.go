@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"go-micro/core/errors"
+	"go-micro/rpc/server"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Arith struct{}
+
+func (Arith) Add(ctx context.Context, args *Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (Arith) Div(ctx context.Context, args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.BadRequest("arith", "divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func (Arith) Count(ctx context.Context, args *Args, stream server.Stream) error {
+	for i := args.A; i < args.B; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newEngine(t *testing.T) (*gin.Engine, *string) {
+	gin.SetMode(gin.TestMode)
+
+	var header string
+	s := server.NewRpcServer(server.WithHandlerWrap(func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+			header = req.Header.Get("X-Test")
+			return h(ctx, req, argv, rsp)
+		}
+	}))
+	if err := s.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+
+	g := gin.New()
+	Router(s)(g)
+	return g, &header
+}
+
+func do(g *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("X-Test", "gateway")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	return w
+}
+
+func TestGateway(t *testing.T) {
+	g, header := newEngine(t)
+
+	w := do(g, "/Arith/Add", `{"A":1,"B":2}`)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "3" {
+		t.Fatalf("Add: %d %s", w.Code, w.Body)
+	}
+	if *header != "gateway" {
+		t.Fatalf("header not forwarded: %q", *header)
+	}
+
+	w = do(g, "/Arith/Div", `{"A":1,"B":0}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Div: %d %s", w.Code, w.Body)
+	}
+	var e errors.Error
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || e.Detail != "divide by zero" {
+		t.Fatalf("Div: %v %s", err, w.Body)
+	}
+
+	w = do(g, "/Arith/Add", `{"A":`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("bad body: %d %s", w.Code, w.Body)
+	}
+
+	w = do(g, "/Arith/Mul", `{}`)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown method: %d", w.Code)
+	}
+}
+
+func TestGatewaySkipsStreamAndDebug(t *testing.T) {
+	g, _ := newEngine(t)
+	for _, path := range []string{"/Arith/Count", "/Debug/Services"} {
+		if w := do(g, path, `{}`); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderPrefix metadata在Message.Header中的前缀
+	HeaderPrefix = "Micro-Meta-"
+	// TimeoutHeader 客户端剩余的超时时间，使用相对时间避免两端时钟不一致
+	TimeoutHeader = "Micro-Timeout"
+)
+
+// Metadata 随请求在服务之间传递的键值对，键不区分大小写
+type Metadata map[string]string
+
+type metadataKey struct{}
+
+func (md Metadata) Get(key string) (string, bool) {
+	val, ok := md[textproto.CanonicalMIMEHeaderKey(key)]
+	return val, ok
+}
+
+func (md Metadata) Set(key, val string) {
+	md[textproto.CanonicalMIMEHeaderKey(key)] = val
+}
+
+func (md Metadata) Delete(key string) {
+	delete(md, textproto.CanonicalMIMEHeaderKey(key))
+}
+
+func Copy(md Metadata) Metadata {
+	cmd := make(Metadata, len(md))
+	for k, v := range md {
+		cmd.Set(k, v)
+	}
+	return cmd
+}
+
+// NewContext 返回携带md副本的context
+func NewContext(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, Copy(md))
+}
+
+// FromContext 返回context中metadata的副本，修改副本不会影响context
+func FromContext(ctx context.Context) (Metadata, bool) {
+	md, ok := ctx.Value(metadataKey{}).(Metadata)
+	if !ok {
+		return nil, false
+	}
+	return Copy(md), true
+}
+
+// Get 获取context中metadata的值
+func Get(ctx context.Context, key string) (string, bool) {
+	md, ok := ctx.Value(metadataKey{}).(Metadata)
+	if !ok {
+		return "", false
+	}
+	return md.Get(key)
+}
+
+// MergeContext 将md合并到context已有的metadata中，overwrite为false时保留已有的值
+func MergeContext(ctx context.Context, md Metadata, overwrite bool) context.Context {
+	cmd, ok := FromContext(ctx)
+	if !ok {
+		return NewContext(ctx, md)
+	}
+	for k, v := range md {
+		if _, ok := cmd.Get(k); ok && !overwrite {
+			continue
+		}
+		cmd.Set(k, v)
+	}
+	return context.WithValue(ctx, metadataKey{}, cmd)
+}
+
+// ToHeader 将metadata写入请求头
+func ToHeader(md Metadata, h http.Header) {
+	for k, v := range md {
+		h.Set(HeaderPrefix+k, v)
+	}
+}
+
+// FromHeader 从请求头中解析metadata，json请求中的header不一定是规范格式，前缀不区分大小写
+func FromHeader(h http.Header) Metadata {
+	md := Metadata{}
+	for k, vs := range h {
+		if len(k) <= len(HeaderPrefix) || !strings.EqualFold(k[:len(HeaderPrefix)], HeaderPrefix) || len(vs) == 0 {
+			continue
+		}
+		md.Set(k[len(HeaderPrefix):], vs[0])
+	}
+	return md
+}
+
+// SetTimeout 将剩余的超时时间写入请求头
+func SetTimeout(h http.Header, d time.Duration) {
+	h.Set(TimeoutHeader, d.String())
+}
+
+// Timeout 从请求头中解析超时时间
+func Timeout(h http.Header) (time.Duration, bool) {
+	v := h.Get(TimeoutHeader)
+	if v == "" {
+		// json请求中的header不一定是规范格式
+		for k, vs := range h {
+			if strings.EqualFold(k, TimeoutHeader) && len(vs) > 0 {
+				v = vs[0]
+			}
+		}
+	}
+	if v == "" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,52 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestContext(t *testing.T) {
+	ctx := NewContext(context.Background(), Metadata{"user": "bob"})
+	ctx = MergeContext(ctx, Metadata{"User": "alice", "trace": "1"}, false)
+
+	md, ok := FromContext(ctx)
+	if !ok {
+		t.Fatal("metadata not found")
+	}
+	if v, _ := md.Get("USER"); v != "bob" {
+		t.Fatalf("user = %q", v)
+	}
+	if v, _ := Get(ctx, "trace"); v != "1" {
+		t.Fatalf("trace = %q", v)
+	}
+
+	// 修改副本不影响context
+	md.Set("user", "eve")
+	if v, _ := Get(ctx, "user"); v != "bob" {
+		t.Fatalf("user = %q", v)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := http.Header{}
+	ToHeader(Metadata{"user": "bob"}, h)
+	SetTimeout(h, 3*time.Second)
+	// json请求中的header未经规范化
+	h["micro-meta-trace"] = []string{"1"}
+
+	md := FromHeader(h)
+	if len(md) != 2 {
+		t.Fatalf("metadata = %v", md)
+	}
+	if v, _ := md.Get("user"); v != "bob" {
+		t.Fatalf("user = %q", v)
+	}
+	if v, _ := md.Get("trace"); v != "1" {
+		t.Fatalf("trace = %q", v)
+	}
+	if d, ok := Timeout(h); !ok || d != 3*time.Second {
+		t.Fatalf("timeout = %v %v", d, ok)
+	}
+}
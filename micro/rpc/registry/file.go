@@ -0,0 +1,336 @@
+package registry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const fileExt = ".json"
+
+// fileRecord 每个节点对应目录下的一个文件，文件名为 服务名@节点id.json
+type fileRecord struct {
+	Service *Service  `json:"service"`
+	Expiry  time.Time `json:"expiry"`
+}
+
+func (r *fileRecord) expired(now time.Time) bool {
+	return !r.Expiry.IsZero() && now.After(r.Expiry)
+}
+
+// fileRegistry 基于共享目录的注册中心，同一台机器或挂载了同一目录的多个进程可以互相发现。
+// 每个节点单独一个文件，写入时先写临时文件再重命名，保证读取方不会读到写了一半的内容
+type fileRegistry struct {
+	dir string
+}
+
+func NewFileRegistry(dir string) (Registry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileRegistry{dir: dir}, nil
+}
+
+func (f *fileRegistry) Register(s *Service, opts ...RegisterOption) error {
+	var options RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	var expiry time.Time
+	if options.TTL > 0 {
+		expiry = time.Now().Add(options.TTL)
+	}
+
+	for _, n := range s.Nodes {
+		srv := copyService(s)
+		srv.Nodes = []*Node{copyNode(n)}
+
+		b, err := json.Marshal(&fileRecord{Service: srv, Expiry: expiry})
+		if err != nil {
+			return err
+		}
+
+		path := f.path(s.Name, n.Id)
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fileRegistry) Deregister(s *Service) error {
+	for _, n := range s.Nodes {
+		if err := os.Remove(f.path(s.Name, n.Id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fileRegistry) GetService(name string) ([]*Service, error) {
+	services, err := f.load(url.PathEscape(name) + "@*" + fileExt)
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return nil, ErrNotFound
+	}
+	return services, nil
+}
+
+func (f *fileRegistry) ListServices() ([]*Service, error) {
+	return f.load("*" + fileExt)
+}
+
+func (f *fileRegistry) Watch(opts ...WatchOption) (Watcher, error) {
+	var options WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := fw.Add(f.dir); err != nil {
+		fw.Close()
+		return nil, err
+	}
+
+	w := &fileWatcher{
+		reg:    f,
+		opts:   options,
+		fw:     fw,
+		expiry: make(map[string]time.Time),
+	}
+	// 已经存在的节点在过期时同样需要通知
+	paths, _ := filepath.Glob(filepath.Join(f.dir, "*"+fileExt))
+	now := time.Now()
+	for _, path := range paths {
+		name, _, ok := parseFileName(path)
+		if !ok || (options.Service != "" && options.Service != name) {
+			continue
+		}
+		if record, err := readRecord(path); err == nil && !record.expired(now) {
+			w.track(path, record.Expiry)
+		}
+	}
+	w.schedule()
+	return w, nil
+}
+
+func (f *fileRegistry) String() string {
+	return "file"
+}
+
+func (f *fileRegistry) path(name, id string) string {
+	return filepath.Join(f.dir, url.PathEscape(name)+"@"+url.PathEscape(id)+fileExt)
+}
+
+// 读取匹配的节点文件并按服务版本合并，过期的节点会被忽略
+func (f *fileRegistry) load(pattern string) ([]*Service, error) {
+	paths, err := filepath.Glob(filepath.Join(f.dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	// name => version => service
+	merged := make(map[string]map[string]*Service)
+	var services []*Service
+	for _, path := range paths {
+		record, err := readRecord(path)
+		if err != nil || record.expired(now) {
+			continue
+		}
+
+		s := record.Service
+		versions, ok := merged[s.Name]
+		if !ok {
+			versions = make(map[string]*Service)
+			merged[s.Name] = versions
+		}
+		if srv, ok := versions[s.Version]; ok {
+			srv.Nodes = append(srv.Nodes, s.Nodes...)
+			continue
+		}
+		versions[s.Version] = s
+		services = append(services, s)
+	}
+	return services, nil
+}
+
+func readRecord(path string) (*fileRecord, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	record := new(fileRecord)
+	if err := json.Unmarshal(b, record); err != nil {
+		return nil, err
+	}
+	if record.Service == nil {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// 从文件名中解析服务名与节点id
+func parseFileName(path string) (name, id string, ok bool) {
+	base := filepath.Base(path)
+	if !strings.HasSuffix(base, fileExt) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimSuffix(base, fileExt), "@", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	name, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return "", "", false
+	}
+	id, err = url.PathUnescape(parts[1])
+	if err != nil {
+		return "", "", false
+	}
+	return name, id, true
+}
+
+type fileWatcher struct {
+	reg  *fileRegistry
+	opts WatchOptions
+	fw   *fsnotify.Watcher
+	once sync.Once
+
+	// 设置了TTL的节点文件的过期时间，过期前没有刷新的节点通知ActionDelete，只在Next中访问
+	expiry  map[string]time.Time
+	timer   *time.Timer
+	timerC  <-chan time.Time
+	pending []*Result
+}
+
+func (w *fileWatcher) Next() (*Result, error) {
+	for {
+		if len(w.pending) > 0 {
+			r := w.pending[0]
+			w.pending = w.pending[1:]
+			return r, nil
+		}
+		select {
+		case <-w.timerC:
+			w.sweep()
+		case event, ok := <-w.fw.Events:
+			if !ok {
+				return nil, ErrWatcherStopped
+			}
+			if r := w.result(event); r != nil {
+				return r, nil
+			}
+		case _, ok := <-w.fw.Errors:
+			if !ok {
+				return nil, ErrWatcherStopped
+			}
+		}
+	}
+}
+
+func (w *fileWatcher) result(event fsnotify.Event) *Result {
+	name, id, ok := parseFileName(event.Name)
+	if !ok {
+		return nil
+	}
+	if w.opts.Service != "" && w.opts.Service != name {
+		return nil
+	}
+
+	switch {
+	case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		w.track(event.Name, time.Time{})
+		w.schedule()
+		return &Result{
+			Action:  ActionDelete,
+			Service: &Service{Name: name, Nodes: []*Node{{Id: id}}},
+		}
+	case event.Op&(fsnotify.Create|fsnotify.Write) != 0:
+		record, err := readRecord(event.Name)
+		if err != nil {
+			return nil
+		}
+		w.track(event.Name, record.Expiry)
+		w.schedule()
+		action := ActionUpdate
+		if event.Op&fsnotify.Create != 0 {
+			action = ActionCreate
+		}
+		return &Result{Action: action, Service: record.Service}
+	}
+	return nil
+}
+
+// 记录节点文件的过期时间，expiry为零值时不再跟踪
+func (w *fileWatcher) track(path string, expiry time.Time) {
+	if expiry.IsZero() {
+		delete(w.expiry, path)
+		return
+	}
+	w.expiry[path] = expiry
+}
+
+// 按最早的过期时间重新设置定时器
+func (w *fileWatcher) schedule() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer, w.timerC = nil, nil
+	}
+	var next time.Time
+	for _, at := range w.expiry {
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	if next.IsZero() {
+		return
+	}
+	w.timer = time.NewTimer(time.Until(next) + time.Millisecond)
+	w.timerC = w.timer.C
+}
+
+// sweep 重新读取到期的节点文件，没有刷新过期时间的节点通知ActionDelete
+func (w *fileWatcher) sweep() {
+	now := time.Now()
+	for path, at := range w.expiry {
+		if !now.After(at) {
+			continue
+		}
+		delete(w.expiry, path)
+		record, err := readRecord(path)
+		if err == nil && !record.expired(now) {
+			w.track(path, record.Expiry)
+			continue
+		}
+		// 读取失败时文件已经被删除，删除事件由fsnotify通知
+		if err == nil {
+			w.pending = append(w.pending, &Result{Action: ActionDelete, Service: record.Service})
+		}
+	}
+	w.schedule()
+}
+
+func (w *fileWatcher) Stop() {
+	w.once.Do(func() {
+		w.fw.Close()
+	})
+}
@@ -0,0 +1,287 @@
+package registry
+
+import (
+	"sync"
+	"time"
+)
+
+// 单个watcher缓存的事件数，消费不及时的事件会被丢弃
+var watcherBuffer = 64
+
+type memNode struct {
+	*Node
+	ttl      time.Duration
+	lastSeen time.Time
+}
+
+func (n *memNode) expired(now time.Time) bool {
+	return n.ttl > 0 && now.Sub(n.lastSeen) > n.ttl
+}
+
+type memService struct {
+	name     string
+	version  string
+	metadata map[string]string
+	nodes    map[string]*memNode
+}
+
+// memRegistry 进程内的注册中心，适用于单进程部署和测试
+type memRegistry struct {
+	sync.RWMutex
+	// name => version => service
+	services map[string]map[string]*memService
+	watchers map[*memWatcher]struct{}
+	// 清理过期节点的定时器，只在存在设置了TTL的节点时运行
+	sweeper *time.Timer
+	sweepAt time.Time
+}
+
+func NewMemoryRegistry() Registry {
+	return &memRegistry{
+		services: make(map[string]map[string]*memService),
+		watchers: make(map[*memWatcher]struct{}),
+	}
+}
+
+func (m *memRegistry) Register(s *Service, opts ...RegisterOption) error {
+	var options RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	versions, ok := m.services[s.Name]
+	if !ok {
+		versions = make(map[string]*memService)
+		m.services[s.Name] = versions
+	}
+
+	action := ActionUpdate
+	srv, ok := versions[s.Version]
+	if !ok {
+		action = ActionCreate
+		srv = &memService{
+			name:    s.Name,
+			version: s.Version,
+			nodes:   make(map[string]*memNode),
+		}
+		versions[s.Version] = srv
+	}
+	srv.metadata = copyMetadata(s.Metadata)
+
+	now := time.Now()
+	for _, n := range s.Nodes {
+		srv.nodes[n.Id] = &memNode{
+			Node:     copyNode(n),
+			ttl:      options.TTL,
+			lastSeen: now,
+		}
+	}
+	if options.TTL > 0 {
+		m.scheduleSweep(now.Add(options.TTL))
+	}
+
+	m.notify(&Result{Action: action, Service: copyService(s)})
+	return nil
+}
+
+func (m *memRegistry) Deregister(s *Service) error {
+	m.Lock()
+	defer m.Unlock()
+
+	versions, ok := m.services[s.Name]
+	if !ok {
+		return nil
+	}
+	srv, ok := versions[s.Version]
+	if !ok {
+		return nil
+	}
+
+	for _, n := range s.Nodes {
+		delete(srv.nodes, n.Id)
+	}
+	if len(srv.nodes) == 0 {
+		delete(versions, s.Version)
+	}
+	if len(versions) == 0 {
+		delete(m.services, s.Name)
+	}
+
+	m.notify(&Result{Action: ActionDelete, Service: copyService(s)})
+	return nil
+}
+
+func (m *memRegistry) GetService(name string) ([]*Service, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	versions, ok := m.services[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	services := m.toServices(versions, time.Now())
+	if len(services) == 0 {
+		return nil, ErrNotFound
+	}
+	return services, nil
+}
+
+func (m *memRegistry) ListServices() ([]*Service, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	now := time.Now()
+	var services []*Service
+	for _, versions := range m.services {
+		services = append(services, m.toServices(versions, now)...)
+	}
+	return services, nil
+}
+
+// 转换为对外的Service，过期但还没有清理的节点不会返回
+func (m *memRegistry) toServices(versions map[string]*memService, now time.Time) []*Service {
+	services := make([]*Service, 0, len(versions))
+	for _, srv := range versions {
+		s := &Service{
+			Name:     srv.name,
+			Version:  srv.version,
+			Metadata: copyMetadata(srv.metadata),
+		}
+		for _, n := range srv.nodes {
+			if n.expired(now) {
+				continue
+			}
+			s.Nodes = append(s.Nodes, copyNode(n.Node))
+		}
+		if len(s.Nodes) > 0 {
+			services = append(services, s)
+		}
+	}
+	return services
+}
+
+// 在at之后清理过期节点，已有更早的清理时不处理，调用方需持有锁
+func (m *memRegistry) scheduleSweep(at time.Time) {
+	if m.sweeper != nil && !at.Before(m.sweepAt) {
+		return
+	}
+	if m.sweeper != nil {
+		m.sweeper.Stop()
+	}
+	m.sweepAt = at
+	// 节点在超过TTL之后才算过期
+	m.sweeper = time.AfterFunc(time.Until(at)+time.Millisecond, m.sweep)
+}
+
+// sweep 移除过期的节点并通知ActionDelete，之后按最早的过期时间继续清理
+func (m *memRegistry) sweep() {
+	m.Lock()
+	defer m.Unlock()
+	m.sweeper = nil
+
+	now := time.Now()
+	var next time.Time
+	for name, versions := range m.services {
+		for version, srv := range versions {
+			var expired []*Node
+			for id, n := range srv.nodes {
+				if n.expired(now) {
+					expired = append(expired, copyNode(n.Node))
+					delete(srv.nodes, id)
+					continue
+				}
+				if at := n.lastSeen.Add(n.ttl); n.ttl > 0 && (next.IsZero() || at.Before(next)) {
+					next = at
+				}
+			}
+			if len(expired) == 0 {
+				continue
+			}
+			if len(srv.nodes) == 0 {
+				delete(versions, version)
+			}
+			m.notify(&Result{Action: ActionDelete, Service: &Service{
+				Name:     srv.name,
+				Version:  srv.version,
+				Metadata: copyMetadata(srv.metadata),
+				Nodes:    expired,
+			}})
+		}
+		if len(versions) == 0 {
+			delete(m.services, name)
+		}
+	}
+	if !next.IsZero() {
+		m.scheduleSweep(next)
+	}
+}
+
+func (m *memRegistry) Watch(opts ...WatchOption) (Watcher, error) {
+	var options WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	w := &memWatcher{
+		opts: options,
+		res:  make(chan *Result, watcherBuffer),
+		exit: make(chan struct{}),
+	}
+
+	m.Lock()
+	m.watchers[w] = struct{}{}
+	m.Unlock()
+
+	go func() {
+		<-w.exit
+		m.Lock()
+		delete(m.watchers, w)
+		m.Unlock()
+	}()
+
+	return w, nil
+}
+
+func (m *memRegistry) String() string {
+	return "memory"
+}
+
+// 调用方需持有锁
+func (m *memRegistry) notify(r *Result) {
+	for w := range m.watchers {
+		if w.opts.Service != "" && w.opts.Service != r.Service.Name {
+			continue
+		}
+		select {
+		case <-w.exit:
+		case w.res <- r:
+		default:
+		}
+	}
+}
+
+type memWatcher struct {
+	opts WatchOptions
+	res  chan *Result
+	exit chan struct{}
+	once sync.Once
+}
+
+func (w *memWatcher) Next() (*Result, error) {
+	select {
+	case r := <-w.res:
+		return r, nil
+	case <-w.exit:
+		return nil, ErrWatcherStopped
+	}
+}
+
+func (w *memWatcher) Stop() {
+	w.once.Do(func() {
+		close(w.exit)
+	})
+}
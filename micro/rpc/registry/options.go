@@ -0,0 +1,29 @@
+package registry
+
+import "time"
+
+type RegisterOptions struct {
+	// 节点的存活时间，超过该时间没有重新注册的节点视为下线；0表示永不过期
+	TTL time.Duration
+}
+
+type RegisterOption func(opts *RegisterOptions)
+
+func RegisterTTL(ttl time.Duration) RegisterOption {
+	return func(opts *RegisterOptions) {
+		opts.TTL = ttl
+	}
+}
+
+type WatchOptions struct {
+	// 只监听指定的服务，为空则监听所有服务
+	Service string
+}
+
+type WatchOption func(opts *WatchOptions)
+
+func WatchService(name string) WatchOption {
+	return func(opts *WatchOptions) {
+		opts.Service = name
+	}
+}
@@ -0,0 +1,67 @@
+// Package registry 提供服务注册与发现，服务端启动时注册自身节点，客户端通过它解析服务地址
+package registry
+
+import "errors"
+
+var (
+	DefaultRegistry Registry = NewMemoryRegistry()
+
+	ErrNotFound       = errors.New("查找不到服务")
+	ErrWatcherStopped = errors.New("watcher已停止")
+)
+
+// Registry 服务注册中心
+type Registry interface {
+	// 注册服务节点，重复注册同一节点会刷新其存活时间
+	Register(s *Service, opts ...RegisterOption) error
+	// 注销服务节点
+	Deregister(s *Service) error
+	// 根据服务名获取服务，每个版本对应一个Service
+	GetService(name string) ([]*Service, error)
+	// 列出所有服务
+	ListServices() ([]*Service, error)
+	// 监听服务的变化
+	Watch(opts ...WatchOption) (Watcher, error)
+
+	String() string
+}
+
+type Service struct {
+	Name     string            `json:"name"`
+	Version  string            `json:"version"`
+	Metadata map[string]string `json:"metadata"`
+	Nodes    []*Node           `json:"nodes"`
+}
+
+type Node struct {
+	Id       string            `json:"id"`
+	Address  string            `json:"address"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+func copyService(s *Service) *Service {
+	cp := *s
+	cp.Metadata = copyMetadata(s.Metadata)
+	cp.Nodes = make([]*Node, 0, len(s.Nodes))
+	for _, n := range s.Nodes {
+		cp.Nodes = append(cp.Nodes, copyNode(n))
+	}
+	return &cp
+}
+
+func copyNode(n *Node) *Node {
+	cp := *n
+	cp.Metadata = copyMetadata(n.Metadata)
+	return &cp
+}
+
+func copyMetadata(md map[string]string) map[string]string {
+	if md == nil {
+		return nil
+	}
+	cp := make(map[string]string, len(md))
+	for k, v := range md {
+		cp[k] = v
+	}
+	return cp
+}
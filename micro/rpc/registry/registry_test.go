@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func testRegistry(t *testing.T, r Registry) {
+	w, err := r.Watch(WatchService("test"))
+	if err != nil {
+		t.Fatalf("watch %s: %v", r, err)
+	}
+	defer w.Stop()
+
+	s := &Service{
+		Name:    "test",
+		Version: "1.0",
+		Nodes: []*Node{
+			{Id: "test-1", Address: "127.0.0.1:9001"},
+			{Id: "test-2", Address: "127.0.0.1:9002"},
+		},
+	}
+	if err := r.Register(s); err != nil {
+		t.Fatalf("register %s: %v", r, err)
+	}
+
+	services, err := r.GetService("test")
+	if err != nil {
+		t.Fatalf("get service %s: %v", r, err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 2 {
+		t.Fatalf("%s: expected 1 service with 2 nodes got %+v", r, services)
+	}
+
+	res, err := w.Next()
+	if err != nil {
+		t.Fatalf("watch next %s: %v", r, err)
+	}
+	if res.Service.Name != "test" {
+		t.Fatalf("%s: expected event for test got %+v", r, res)
+	}
+
+	if err := r.Deregister(s); err != nil {
+		t.Fatalf("deregister %s: %v", r, err)
+	}
+	if _, err := r.GetService("test"); err != ErrNotFound {
+		t.Fatalf("%s: expected %v got %v", r, ErrNotFound, err)
+	}
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	testRegistry(t, NewMemoryRegistry())
+}
+
+func TestFileRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewFileRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRegistry(t, r)
+}
+
+func TestRegisterTTL(t *testing.T) {
+	r := NewMemoryRegistry()
+	s := &Service{Name: "test", Nodes: []*Node{{Id: "test-1", Address: "127.0.0.1:9001"}}}
+	if err := r.Register(s, RegisterTTL(10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := r.GetService("test"); err != ErrNotFound {
+		t.Fatalf("expected expired node to be ignored, got %v", err)
+	}
+}
+
+func TestMemoryRegistryExpiredDelete(t *testing.T) {
+	r := NewMemoryRegistry()
+	w, err := r.Watch(WatchService("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	s := &Service{Name: "test", Nodes: []*Node{
+		{Id: "test-1", Address: "127.0.0.1:9001"},
+	}}
+	if err := r.Register(s, RegisterTTL(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := w.Next(); err != nil || res.Action != ActionCreate {
+		t.Fatalf("got %v %v, want create", res, err)
+	}
+
+	res, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != ActionDelete || len(res.Service.Nodes) != 1 || res.Service.Nodes[0].Address != "127.0.0.1:9001" {
+		t.Fatalf("got %v %+v, want delete of the expired node", res.Action, res.Service)
+	}
+	if _, err := r.GetService("test"); err != ErrNotFound {
+		t.Fatalf("expected expired service to be removed, got %v", err)
+	}
+}
+
+func TestFileRegistryExpiredDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := NewFileRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{Name: "test", Nodes: []*Node{{Id: "test-1", Address: "127.0.0.1:9001"}}}
+	// 监听之前注册的节点过期时同样通知
+	if err := r.Register(s, RegisterTTL(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	for {
+		res, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Action != ActionDelete {
+			continue
+		}
+		if len(res.Service.Nodes) != 1 || res.Service.Nodes[0].Address != "127.0.0.1:9001" {
+			t.Fatalf("got %+v, want delete of the expired node", res.Service)
+		}
+		return
+	}
+}
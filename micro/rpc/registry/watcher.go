@@ -0,0 +1,20 @@
+package registry
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Watcher 监听注册中心的变化
+type Watcher interface {
+	// 阻塞直到有新的变化或者watcher被停止
+	Next() (*Result, error)
+	Stop()
+}
+
+// Result 注册中心的变化，Service中只包含发生变化的节点
+type Result struct {
+	Action  string
+	Service *Service
+}
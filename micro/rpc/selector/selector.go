@@ -0,0 +1,66 @@
+// Package selector 负载均衡，从服务的多个节点中为每次调用选择一个节点
+package selector
+
+import (
+	"errors"
+	"go-micro/rpc/registry"
+)
+
+var (
+	DefaultSelector = NewRoundRobin()
+
+	ErrNoneAvailable = errors.New("没有可用的服务节点")
+)
+
+type Selector interface {
+	// 从nodes中选择一个节点
+	Select(service string, nodes []*registry.Node, opts ...SelectOption) (*registry.Node, error)
+	// 调用结束后标记节点的调用结果，每次Select成功后都需要调用
+	Mark(service string, node *registry.Node, err error)
+
+	String() string
+}
+
+type SelectOptions struct {
+	// 需要排除的节点地址，比如本次调用中已经失败过的节点
+	Exclude map[string]struct{}
+}
+
+type SelectOption func(opts *SelectOptions)
+
+func Exclude(addrs ...string) SelectOption {
+	return func(opts *SelectOptions) {
+		if opts.Exclude == nil {
+			opts.Exclude = make(map[string]struct{}, len(addrs))
+		}
+		for _, addr := range addrs {
+			opts.Exclude[addr] = struct{}{}
+		}
+	}
+}
+
+// 过滤被排除的节点，所有节点都被排除时返回全部节点，以便重试时仍有节点可用
+func filter(nodes []*registry.Node, opts []SelectOption) ([]*registry.Node, error) {
+	if len(nodes) == 0 {
+		return nil, ErrNoneAvailable
+	}
+
+	var options SelectOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	if len(options.Exclude) == 0 {
+		return nodes, nil
+	}
+
+	filtered := make([]*registry.Node, 0, len(nodes))
+	for _, n := range nodes {
+		if _, ok := options.Exclude[n.Address]; !ok {
+			filtered = append(filtered, n)
+		}
+	}
+	if len(filtered) == 0 {
+		return nodes, nil
+	}
+	return filtered, nil
+}
@@ -0,0 +1,75 @@
+package selector
+
+import (
+	"go-micro/rpc/registry"
+	"testing"
+)
+
+var testNodes = []*registry.Node{
+	{Id: "test-1", Address: "127.0.0.1:9001"},
+	{Id: "test-2", Address: "127.0.0.1:9002", Metadata: map[string]string{WeightKey: "0"}},
+	{Id: "test-3", Address: "127.0.0.1:9003"},
+}
+
+func TestSelectors(t *testing.T) {
+	for _, s := range []Selector{NewRoundRobin(), NewRandom(), NewWeighted(), NewLeastInflight()} {
+		if _, err := s.Select("test", nil); err != ErrNoneAvailable {
+			t.Fatalf("%s: expected %v got %v", s, ErrNoneAvailable, err)
+		}
+
+		for i := 0; i < 10; i++ {
+			n, err := s.Select("test", testNodes, Exclude("127.0.0.1:9001"))
+			if err != nil {
+				t.Fatalf("%s: %v", s, err)
+			}
+			if n.Address == "127.0.0.1:9001" {
+				t.Fatalf("%s: selected excluded node", s)
+			}
+			s.Mark("test", n, nil)
+		}
+
+		// 所有节点都被排除时仍然返回节点
+		if _, err := s.Select("test", testNodes[:1], Exclude("127.0.0.1:9001")); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	s := NewRoundRobin()
+	for i := 0; i < 6; i++ {
+		n, _ := s.Select("test", testNodes)
+		if n != testNodes[i%len(testNodes)] {
+			t.Fatalf("expected %s got %s", testNodes[i%len(testNodes)].Id, n.Id)
+		}
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	s := NewWeighted()
+	for i := 0; i < 100; i++ {
+		n, _ := s.Select("test", testNodes)
+		if n.Id == "test-2" {
+			t.Fatal("selected node with weight 0")
+		}
+	}
+}
+
+func TestLeastInflight(t *testing.T) {
+	s := NewLeastInflight()
+	seen := make(map[string]bool)
+	for i := 0; i < len(testNodes); i++ {
+		n, _ := s.Select("test", testNodes)
+		seen[n.Id] = true
+	}
+	if len(seen) != len(testNodes) {
+		t.Fatalf("expected every node to be selected once, got %v", seen)
+	}
+
+	n, _ := s.Select("test", testNodes)
+	s.Mark("test", n, nil)
+	s.Mark("test", testNodes[0], nil)
+	if n, _ = s.Select("test", testNodes); n != testNodes[0] {
+		t.Fatalf("expected %s got %s", testNodes[0].Id, n.Id)
+	}
+}
@@ -0,0 +1,184 @@
+package selector
+
+import (
+	"go-micro/rpc/registry"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 节点权重在Metadata中的key，未设置时权重为1
+const WeightKey = "weight"
+
+var (
+	rmu sync.Mutex
+	rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func intn(n int) int {
+	rmu.Lock()
+	defer rmu.Unlock()
+	return rnd.Intn(n)
+}
+
+// roundRobin 轮询，每个服务单独计数
+type roundRobin struct {
+	mu       sync.Mutex
+	counters map[string]*uint64
+}
+
+func NewRoundRobin() Selector {
+	return &roundRobin{
+		counters: make(map[string]*uint64),
+	}
+}
+
+func (r *roundRobin) Select(service string, nodes []*registry.Node, opts ...SelectOption) (*registry.Node, error) {
+	nodes, err := filter(nodes, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	counter, ok := r.counters[service]
+	if !ok {
+		counter = new(uint64)
+		r.counters[service] = counter
+	}
+	r.mu.Unlock()
+
+	i := atomic.AddUint64(counter, 1) - 1
+	return nodes[i%uint64(len(nodes))], nil
+}
+
+func (r *roundRobin) Mark(service string, node *registry.Node, err error) {}
+
+func (r *roundRobin) String() string {
+	return "roundrobin"
+}
+
+// random 随机
+type random struct{}
+
+func NewRandom() Selector {
+	return random{}
+}
+
+func (random) Select(service string, nodes []*registry.Node, opts ...SelectOption) (*registry.Node, error) {
+	nodes, err := filter(nodes, opts)
+	if err != nil {
+		return nil, err
+	}
+	return nodes[intn(len(nodes))], nil
+}
+
+func (random) Mark(service string, node *registry.Node, err error) {}
+
+func (random) String() string {
+	return "random"
+}
+
+// weighted 按节点权重随机
+type weighted struct{}
+
+func NewWeighted() Selector {
+	return weighted{}
+}
+
+func weight(n *registry.Node) int {
+	w, err := strconv.Atoi(n.Metadata[WeightKey])
+	if err != nil || w < 0 {
+		return 1
+	}
+	return w
+}
+
+func (weighted) Select(service string, nodes []*registry.Node, opts ...SelectOption) (*registry.Node, error) {
+	nodes, err := filter(nodes, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, n := range nodes {
+		total += weight(n)
+	}
+	if total == 0 {
+		return nodes[intn(len(nodes))], nil
+	}
+
+	r := intn(total)
+	for _, n := range nodes {
+		r -= weight(n)
+		if r < 0 {
+			return n, nil
+		}
+	}
+	return nodes[len(nodes)-1], nil
+}
+
+func (weighted) Mark(service string, node *registry.Node, err error) {}
+
+func (weighted) String() string {
+	return "weighted"
+}
+
+// leastInflight 选择正在处理的请求最少的节点，数量相同时随机选择
+type leastInflight struct {
+	mu       sync.Mutex
+	inflight map[string]int64
+}
+
+func NewLeastInflight() Selector {
+	return &leastInflight{
+		inflight: make(map[string]int64),
+	}
+}
+
+func (l *leastInflight) Select(service string, nodes []*registry.Node, opts ...SelectOption) (*registry.Node, error) {
+	nodes, err := filter(nodes, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var (
+		best  *registry.Node
+		least int64
+		ties  int
+	)
+	for _, n := range nodes {
+		inflight := l.inflight[n.Address]
+		switch {
+		case best == nil || inflight < least:
+			best, least, ties = n, inflight, 1
+		case inflight == least:
+			// 蓄水池抽样，在数量相同的节点中等概率选择
+			ties++
+			if intn(ties) == 0 {
+				best = n
+			}
+		}
+	}
+
+	l.inflight[best.Address]++
+	return best, nil
+}
+
+func (l *leastInflight) Mark(service string, node *registry.Node, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[node.Address] <= 1 {
+		delete(l.inflight, node.Address)
+		return
+	}
+	l.inflight[node.Address]--
+}
+
+func (l *leastInflight) String() string {
+	return "least_inflight"
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bufio"
+	"go-micro/rpc/codec"
+	"io"
+	"sync"
+)
+
+// NewCodec 根据连接创建对应序列化方式的ServerCodec，返回错误时关闭连接
+type NewCodec func(conn io.ReadWriteCloser) (ServerCodec, error)
+
+// DefaultCodecs 服务端默认支持的序列化方式，json使用原有的jsonrpc协议，其他使用长度前缀的数据帧
+var DefaultCodecs = map[string]NewCodec{
+	codec.ContentTypeJSON: func(conn io.ReadWriteCloser) (ServerCodec, error) {
+		return NewServerCodec(conn), nil
+	},
+	codec.ContentTypeMsgpack:  NewFrameCodec(codec.ContentTypeMsgpack),
+	codec.ContentTypeProtobuf: NewFrameCodec(codec.ContentTypeProtobuf),
+	// 流式调用使用数据帧传输json
+	codec.ContentTypeJSONFrame: NewFrameCodec(codec.ContentTypeJSONFrame),
+}
+
+// bufferedConn 协商时预读的数据保留在bufio.Reader中
+type bufferedConn struct {
+	*bufio.Reader
+	io.WriteCloser
+}
+
+// negotiateCodec 在读取第一个请求时根据首帧协商序列化方式，再交给实际的ServerCodec处理
+type negotiateCodec struct {
+	conn   io.ReadWriteCloser
+	codecs map[string]NewCodec
+
+	mu    sync.Mutex // protects codec
+	codec ServerCodec
+}
+
+func newNegotiateCodec(conn io.ReadWriteCloser, codecs map[string]NewCodec) ServerCodec {
+	return &negotiateCodec{
+		conn:   conn,
+		codecs: codecs,
+	}
+}
+
+// 只会在ServeCodec的读取协程中调用，读取首帧时不持有锁，以便Close可以中断阻塞的读取
+func (c *negotiateCodec) negotiate() (ServerCodec, error) {
+	if sc := c.current(); sc != nil {
+		return sc, nil
+	}
+
+	r := bufio.NewReader(c.conn)
+	ct, err := codec.ReadPreamble(r)
+	if err != nil {
+		return nil, err
+	}
+	newCodec, ok := c.codecs[ct]
+	if !ok {
+		return nil, codec.ErrUnknownContentType
+	}
+
+	sc, err := newCodec(bufferedConn{Reader: r, WriteCloser: c.conn})
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.codec = sc
+	c.mu.Unlock()
+	return sc, nil
+}
+
+func (c *negotiateCodec) current() ServerCodec {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.codec
+}
+
+func (c *negotiateCodec) ReadRequestHeader(r *Request) error {
+	sc, err := c.negotiate()
+	if err != nil {
+		return err
+	}
+	return sc.ReadRequestHeader(r)
+}
+
+func (c *negotiateCodec) ReadRequestBody(r *Request, x interface{}) error {
+	return c.current().ReadRequestBody(r, x)
+}
+
+func (c *negotiateCodec) WriteResponse(r *Response, x interface{}) error {
+	return c.current().WriteResponse(r, x)
+}
+
+func (c *negotiateCodec) Close() error {
+	if sc := c.current(); sc != nil {
+		return sc.Close()
+	}
+	return c.conn.Close()
+}
+
+// frameCodec 使用长度前缀数据帧的ServerCodec
+type frameCodec struct {
+	r io.Reader
+	w *bufio.Writer
+	c io.Closer
+	m codec.Marshaler
+
+	req codec.Frame
+}
+
+// NewFrameCodec 返回使用contentType对应Marshaler的数据帧ServerCodec，Marshaler在每个连接协商时获取，
+// contentType没有通过codec.Register注册时拒绝协商该序列化方式的连接
+func NewFrameCodec(contentType string) NewCodec {
+	return func(conn io.ReadWriteCloser) (ServerCodec, error) {
+		m, err := codec.Get(contentType)
+		if err != nil {
+			return nil, err
+		}
+		return &frameCodec{
+			r: conn,
+			w: bufio.NewWriter(conn),
+			c: conn,
+			m: m,
+		}, nil
+	}
+}
+
+func (c *frameCodec) ReadRequestHeader(r *Request) error {
+	if err := codec.ReadFrame(c.r, &c.req); err != nil {
+		return err
+	}
+	r.ServiceMethod = c.req.ServiceMethod
+	r.Seq = c.req.Seq
+	r.Header = c.req.Header
+	return nil
+}
+
+func (c *frameCodec) ReadRequestBody(r *Request, x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	return c.m.Unmarshal(c.req.Body, x)
+}
+
+func (c *frameCodec) WriteResponse(r *Response, x interface{}) error {
+	f := &codec.Frame{
+		Seq:           r.Seq,
+		ServiceMethod: r.ServiceMethod,
+		Error:         r.Error,
+	}
+	if r.Error == "" {
+		body, err := c.m.Marshal(x)
+		if err != nil {
+			f.Error = err.Error()
+		} else {
+			f.Body = body
+		}
+	}
+	return c.writeFrame(f)
+}
+
+func (c *frameCodec) rawBody() []byte {
+	return c.req.Body
+}
+
+func (c *frameCodec) marshaler() codec.Marshaler {
+	return c.m
+}
+
+func (c *frameCodec) writeFrame(f *codec.Frame) error {
+	if err := codec.WriteFrame(c.w, f); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *frameCodec) Close() error {
+	return c.c.Close()
+}
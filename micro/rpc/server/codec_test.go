@@ -0,0 +1,68 @@
+package server
+
+import (
+	"go-micro/rpc/codec"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUnknownFrameCodecRejectsConnection(t *testing.T) {
+	const contentType = "application/x-unregistered"
+	s := NewRpcServer(WithCodec(contentType, NewFrameCodec(contentType)))
+	if err := s.Register(newBlockService()); err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := run(t, s)
+	defer s.Stop()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := codec.WritePreamble(conn, contentType); err != nil {
+			t.Fatal(err)
+		}
+		// 没有注册Marshaler的序列化方式直接关闭连接，服务不受影响
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := ioutil.ReadAll(conn); err != nil {
+			t.Fatalf("the connection was not closed: %v", err)
+		}
+		conn.Close()
+	}
+}
+
+// lateMarshaler 在服务创建之后才注册
+type lateMarshaler struct {
+	codec.Marshaler
+}
+
+func (lateMarshaler) String() string {
+	return "late"
+}
+
+func TestFrameCodecLooksUpMarshalerPerConnection(t *testing.T) {
+	const contentType = "application/x-late"
+	nc := NewFrameCodec(contentType)
+
+	c, _ := net.Pipe()
+	defer c.Close()
+	if _, err := nc(c); err != codec.ErrUnknownContentType {
+		t.Fatalf("got %v before Register, want %v", err, codec.ErrUnknownContentType)
+	}
+
+	jsonMarshaler, err := codec.Get(codec.ContentTypeJSONFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec.Register(contentType, lateMarshaler{jsonMarshaler})
+	sc, err := nc(c)
+	if err != nil {
+		t.Fatalf("got %v after Register", err)
+	}
+	if m := sc.(*frameCodec).m; m.String() != "late" {
+		t.Fatalf("got marshaler %s, want the one registered later", m)
+	}
+}
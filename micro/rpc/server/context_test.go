@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"go-micro/rpc/client"
+	"go-micro/rpc/codec"
+	"go-micro/rpc/metadata"
+	"testing"
+	"time"
+)
+
+type ContextArgs struct{}
+
+type ContextReply struct {
+	User        string
+	HasDeadline bool
+	Remaining   time.Duration
+}
+
+type ContextService struct{}
+
+func (ContextService) Info(ctx context.Context, args *ContextArgs, reply *ContextReply) error {
+	reply.User, _ = metadata.Get(ctx, "user")
+	if d, ok := ctx.Deadline(); ok {
+		reply.HasDeadline = true
+		reply.Remaining = time.Until(d)
+	}
+	return nil
+}
+
+func TestContextMetadataAndDeadline(t *testing.T) {
+	s := NewRpcServer()
+	if err := s.Register(ContextService{}); err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := run(t, s)
+	defer s.Stop()
+
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		multiplex   bool
+	}{
+		{"json", codec.ContentTypeJSON, false},
+		// 多路复用时json使用数据帧传输
+		{"json frame", codec.ContentTypeJSON, true},
+		{"msgpack frame", codec.ContentTypeMsgpack, false},
+	} {
+		c := client.NewClient(
+			client.SetServer("ctx", &client.Server{Address: addr}),
+			client.SetContentType(tc.contentType),
+			client.SetMultiplex(tc.multiplex),
+		)
+
+		const timeout = 5 * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		ctx = metadata.NewContext(ctx, metadata.Metadata{"user": "alice"})
+		var reply ContextReply
+		err := c.Call(ctx, c.NewRequest("ctx", "ContextService.Info", &ContextArgs{}), &reply)
+		cancel()
+		c.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		if reply.User != "alice" {
+			t.Errorf("%s: metadata user = %q, want alice", tc.name, reply.User)
+		}
+		// handler的ctx使用客户端剩余的超时时间
+		if !reply.HasDeadline || reply.Remaining <= timeout-time.Second || reply.Remaining > timeout {
+			t.Errorf("%s: remaining deadline = %v (set %v), want close to %v", tc.name, reply.Remaining, reply.HasDeadline, timeout)
+		}
+	}
+}
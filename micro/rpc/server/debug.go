@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"go-micro/core/errors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DebugServiceName 内置调试服务的服务名
+const DebugServiceName = "Debug"
+
+// Debug 内置的调试服务，提供已注册服务的方法、参数结构与调用次数，
+// 运维工具与通用客户端可以据此调用任意服务
+type Debug struct {
+	server *Server
+}
+
+type ServicesRequest struct{}
+
+type ServicesResponse struct {
+	Services []*ServiceInfo `json:"services"`
+}
+
+type DescribeRequest struct {
+	Service string `json:"service"`
+	// 为空时返回服务的所有方法
+	Method string `json:"method,omitempty"`
+}
+
+type DescribeResponse struct {
+	Service *ServiceInfo `json:"service"`
+}
+
+type ServiceInfo struct {
+	Name    string        `json:"name"`
+	Methods []*MethodInfo `json:"methods"`
+}
+
+type MethodInfo struct {
+	Name string `json:"name"`
+	// 流式方法，需要通过Stream调用
+	Stream bool `json:"stream,omitempty"`
+	Calls  uint `json:"calls"`
+	// 参数与响应的结构，只在Describe中返回
+	Args  *Schema `json:"args,omitempty"`
+	Reply *Schema `json:"reply,omitempty"`
+}
+
+// Schema 类似JSON Schema的类型描述
+type Schema struct {
+	// object, array, string, integer, number, boolean，为空表示任意类型
+	Type string `json:"type,omitempty"`
+	// 对type的补充，如int64、date-time、byte
+	Format string `json:"format,omitempty"`
+	// Go中的类型名
+	Title string `json:"title,omitempty"`
+	// 递归引用的类型，值为外层Schema的Title
+	Ref                  string             `json:"$ref,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Services 列出所有服务的方法与调用次数
+func (d *Debug) Services(ctx context.Context, req *ServicesRequest, rsp *ServicesResponse) error {
+	d.server.serviceMap.Range(func(_, svci interface{}) bool {
+		rsp.Services = append(rsp.Services, describeService(svci.(*service), "", false))
+		return true
+	})
+	sort.Slice(rsp.Services, func(i, j int) bool {
+		return rsp.Services[i].Name < rsp.Services[j].Name
+	})
+	return nil
+}
+
+// Describe 返回服务方法的参数与响应结构
+func (d *Debug) Describe(ctx context.Context, req *DescribeRequest, rsp *DescribeResponse) error {
+	svci, ok := d.server.serviceMap.Load(req.Service)
+	if !ok {
+		return errors.NotFound("go-micro/rpc/server/Debug.Describe", "service %s not found", req.Service)
+	}
+	svc := svci.(*service)
+	if req.Method != "" && svc.method[req.Method] == nil {
+		return errors.NotFound("go-micro/rpc/server/Debug.Describe", "method %s.%s not found", req.Service, req.Method)
+	}
+
+	rsp.Service = describeService(svc, req.Method, true)
+	return nil
+}
+
+func describeService(svc *service, method string, schema bool) *ServiceInfo {
+	info := &ServiceInfo{Name: svc.name}
+	for name, mtype := range svc.method {
+		if method != "" && name != method {
+			continue
+		}
+		m := &MethodInfo{
+			Name:   name,
+			Stream: mtype.stream,
+			Calls:  mtype.NumCalls(),
+		}
+		if schema {
+			m.Args = newSchema(mtype.ArgType)
+			if !mtype.stream {
+				m.Reply = newSchema(mtype.ReplyType)
+			}
+		}
+		info.Methods = append(info.Methods, m)
+	}
+	sort.Slice(info.Methods, func(i, j int) bool {
+		return info.Methods[i].Name < info.Methods[j].Name
+	})
+	return info
+}
+
+var (
+	typeOfTime       = reflect.TypeOf(time.Time{})
+	typeOfDuration   = reflect.TypeOf(time.Duration(0))
+	typeOfRawMessage = reflect.TypeOf(json.RawMessage{})
+)
+
+func newSchema(t reflect.Type) *Schema {
+	return schemaOf(t, map[reflect.Type]bool{})
+}
+
+// seen 记录正在描述的结构体，用于处理递归类型
+func schemaOf(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case typeOfTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	case typeOfDuration:
+		return &Schema{Type: "integer", Format: "duration"}
+	case typeOfRawMessage:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Format: t.Kind().String()}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: t.Kind().String()}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		// []byte按base64编码
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), seen)}
+	case reflect.Struct:
+		return structSchema(t, seen)
+	}
+	// interface等任意类型
+	return &Schema{}
+}
+
+func structSchema(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	if seen[t] {
+		return &Schema{Ref: t.Name()}
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	s := &Schema{
+		Type:       "object",
+		Title:      t.Name(),
+		Properties: map[string]*Schema{},
+	}
+	addFields(s, t, seen)
+	sort.Strings(s.Required)
+	return s
+}
+
+// 按encoding/json的规则展开字段，匿名结构体的字段合并到外层
+func addFields(s *Schema, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx:]
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			addFields(s, ft, seen)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = schemaOf(f.Type, seen)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"go-micro/core/errors"
+	"testing"
+	"time"
+)
+
+type DebugArgs struct {
+	Name    string         `json:"name"`
+	Tags    []string       `json:"tags,omitempty"`
+	Extra   map[string]int `json:"extra,omitempty"`
+	Created time.Time      `json:"created"`
+	Next    *DebugArgs     `json:"next,omitempty"`
+	Skip    string         `json:"-"`
+	private int
+	DebugEmbedded
+}
+
+type DebugEmbedded struct {
+	Id int64
+}
+
+type DebugArith struct{}
+
+func (DebugArith) Add(ctx context.Context, args *DebugArgs, reply *int) error {
+	return nil
+}
+
+func (DebugArith) Watch(ctx context.Context, args *DebugArgs, stream Stream) error {
+	return nil
+}
+
+func TestDebugDescribe(t *testing.T) {
+	s := NewRpcServer()
+	if err := s.Register(DebugArith{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var list ServicesResponse
+	if _, err := s.Call(context.Background(), &Request{ServiceMethod: "Debug.Services"}, func(argv interface{}) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	d := &Debug{server: s.svr}
+	if err := d.Services(context.Background(), &ServicesRequest{}, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Services) != 2 || list.Services[0].Name != DebugServiceName || list.Services[1].Name != "DebugArith" {
+		t.Fatalf("services = %+v", list.Services)
+	}
+	for _, m := range list.Services[0].Methods {
+		if m.Name == "Services" && m.Calls != 1 {
+			t.Fatalf("Debug.Services calls = %d", m.Calls)
+		}
+	}
+
+	var rsp DescribeResponse
+	if err := d.Describe(context.Background(), &DescribeRequest{Service: "DebugArith"}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	add, watch := rsp.Service.Methods[0], rsp.Service.Methods[1]
+	if add.Name != "Add" || add.Reply.Type != "integer" || add.Stream {
+		t.Fatalf("Add = %+v", add)
+	}
+	if watch.Name != "Watch" || !watch.Stream || watch.Reply != nil {
+		t.Fatalf("Watch = %+v", watch)
+	}
+
+	args := add.Args
+	if args.Type != "object" || args.Title != "DebugArgs" || len(args.Properties) != 6 {
+		t.Fatalf("args = %+v", args)
+	}
+	if p := args.Properties["tags"]; p.Type != "array" || p.Items.Type != "string" {
+		t.Fatalf("tags = %+v", p)
+	}
+	if p := args.Properties["extra"]; p.Type != "object" || p.AdditionalProperties.Type != "integer" {
+		t.Fatalf("extra = %+v", p)
+	}
+	if p := args.Properties["created"]; p.Format != "date-time" {
+		t.Fatalf("created = %+v", p)
+	}
+	if p := args.Properties["next"]; p.Ref != "DebugArgs" {
+		t.Fatalf("next = %+v", p)
+	}
+	if p := args.Properties["Id"]; p.Type != "integer" || p.Format != "int64" {
+		t.Fatalf("Id = %+v", p)
+	}
+	if len(args.Required) != 3 {
+		t.Fatalf("required = %v", args.Required)
+	}
+
+	if err := d.Describe(context.Background(), &DescribeRequest{Service: "DebugArith", Method: "Nope"}, &rsp); err == nil {
+		t.Fatal("expected not found")
+	}
+}
+
+func TestDebugDisabled(t *testing.T) {
+	s := NewRpcServer(WithDebug(false))
+	_, err := s.Call(context.Background(), &Request{ServiceMethod: DebugServiceName + ".Services"}, func(argv interface{}) error { return nil })
+	if e := errors.FromError(err); e.Id != IdMethodNotFound {
+		t.Fatalf("got %v, want method not found", err)
+	}
+}
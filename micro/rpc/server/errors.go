@@ -0,0 +1,49 @@
+package server
+
+import "go-micro/core/errors"
+
+// 框架产生的请求错误，codec可以根据Id转换为对应协议的错误码
+const (
+	IdInvalidRequest = "go-micro/rpc/server.InvalidRequest"
+	IdMethodNotFound = "go-micro/rpc/server.MethodNotFound"
+	IdInvalidParams  = "go-micro/rpc/server.InvalidParams"
+	IdPanic          = "go-micro/rpc/server.Panic"
+	IdTimeout        = "go-micro/rpc/server.Timeout"
+	// 服务正在关闭，请求没有执行，客户端可以安全地重试其他节点
+	IdShuttingDown = "go-micro/rpc/server.ShuttingDown"
+	// 流中未接收的消息超过上限，流已经被取消
+	IdStreamOverflow = "go-micro/rpc/server.StreamOverflow"
+)
+
+func errInvalidRequest(format string, a ...interface{}) error {
+	return errors.BadRequest(IdInvalidRequest, format, a...)
+}
+
+func errMethodNotFound(format string, a ...interface{}) error {
+	return errors.NotFound(IdMethodNotFound, format, a...)
+}
+
+func errInvalidParams(format string, a ...interface{}) error {
+	return errors.BadRequest(IdInvalidParams, format, a...)
+}
+
+func errPanic(format string, a ...interface{}) error {
+	return errors.InternalServerError(IdPanic, format, a...)
+}
+
+func errTimeout(format string, a ...interface{}) error {
+	return errors.Timeout(IdTimeout, format, a...)
+}
+
+func errStreamOverflow(format string, a ...interface{}) error {
+	return errors.TooManyRequests(IdStreamOverflow, format, a...)
+}
+
+func errShuttingDown(format string, a ...interface{}) error {
+	return errors.ServiceUnavailable(IdShuttingDown, format, a...)
+}
+
+// 参数解析失败，保留原始错误的详情
+func errInvalidParamsFrom(serviceMethod string, err error) error {
+	return errInvalidParams("rpc: invalid params for %s: %s", serviceMethod, errors.FromError(err).Detail)
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"go-micro/core/errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type HandleArgs struct {
+	Sleep time.Duration
+}
+
+type HandleService struct{}
+
+func (HandleService) Panic(ctx context.Context, args *HandleArgs, reply *int) error {
+	var m map[string]int
+	m["boom"]++
+	return nil
+}
+
+func (HandleService) Sleep(ctx context.Context, args *HandleArgs, reply *int) error {
+	select {
+	case <-time.After(args.Sleep):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ignore 不检查ctx，执行完才返回
+func (HandleService) Ignore(ctx context.Context, args *HandleArgs, reply *int) error {
+	time.Sleep(args.Sleep)
+	*reply = 1
+	return nil
+}
+
+func call(s *RpcServer, ctx context.Context, method string, args HandleArgs) error {
+	_, err := s.Call(ctx, &Request{ServiceMethod: method}, func(argv interface{}) error {
+		*argv.(*HandleArgs) = args
+		return nil
+	})
+	return err
+}
+
+func TestHandlePanic(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	var seen error
+	s := NewRpcServer(WithLogger(zap.New(core)), WithHandlerWrap(func(h HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *Request, argv, rsp interface{}) error {
+			seen = h(ctx, req, argv, rsp)
+			return seen
+		}
+	}))
+	if err := s.Register(HandleService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := call(s, context.Background(), "HandleService.Panic", HandleArgs{})
+	if e := errors.FromError(err); e.Code != 500 || e.Id != IdPanic {
+		t.Fatalf("got %v, want a 500 panic error", err)
+	}
+	if seen == nil {
+		t.Fatal("the wrapper did not see the panic error")
+	}
+
+	entries := logs.All()
+	if len(entries) != 1 || entries[0].ContextMap()["method"] != "HandleService.Panic" {
+		t.Fatalf("logs = %+v", entries)
+	}
+	if _, ok := entries[0].ContextMap()["stack"]; !ok {
+		t.Fatal("the stack trace was not logged")
+	}
+}
+
+func TestHandleWrapperPanic(t *testing.T) {
+	// 设置超时时handler在单独的协程中执行
+	for _, timeout := range []time.Duration{0, time.Hour} {
+		s := NewRpcServer(WithLogger(zap.NewNop()), WithHandlerTimeout(timeout), WithHandlerWrap(func(h HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, req *Request, argv, rsp interface{}) error {
+				panic("wrapper")
+			}
+		}))
+		if err := s.Register(HandleService{}); err != nil {
+			t.Fatal(err)
+		}
+
+		err := call(s, context.Background(), "HandleService.Sleep", HandleArgs{})
+		if e := errors.FromError(err); e.Code != 500 || e.Id != IdPanic {
+			t.Fatalf("timeout %v: got %v, want a 500 panic error", timeout, err)
+		}
+	}
+}
+
+func TestHandleTimeout(t *testing.T) {
+	s := NewRpcServer(
+		WithHandlerTimeout(time.Hour),
+		WithMethodTimeout("HandleService.Sleep", 20*time.Millisecond),
+	)
+	if err := s.Register(HandleService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := call(s, context.Background(), "HandleService.Sleep", HandleArgs{Sleep: time.Hour})
+	if e := errors.FromError(err); e.Code != 408 || e.Id != IdTimeout {
+		t.Fatalf("got %v, want a 408 timeout error", err)
+	}
+
+	if err := call(s, context.Background(), "HandleService.Sleep", HandleArgs{}); err != nil {
+		t.Fatalf("got %v within the timeout", err)
+	}
+
+	// 客户端的取消保持handler返回的错误
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := call(s, ctx, "HandleService.Sleep", HandleArgs{Sleep: time.Hour}); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestHandleTimeoutIgnoringContext(t *testing.T) {
+	s := NewRpcServer(WithHandlerTimeout(20 * time.Millisecond))
+	if err := s.Register(HandleService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不检查ctx的handler在截止时间就返回408，不等待handler执行完
+	start := time.Now()
+	err := call(s, context.Background(), "HandleService.Ignore", HandleArgs{Sleep: time.Second})
+	if e := errors.FromError(err); e.Code != 408 || e.Id != IdTimeout {
+		t.Fatalf("got %v, want a 408 timeout error", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("timeout returned after %v", d)
+	}
+
+	rsp, err := s.Call(context.Background(), &Request{ServiceMethod: "HandleService.Ignore"}, func(argv interface{}) error {
+		return nil
+	})
+	if err != nil || *rsp.(*int) != 1 {
+		t.Fatalf("got %v, %v within the timeout", rsp, err)
+	}
+}
+
+func TestShutdownWaitsForTimedOutHandler(t *testing.T) {
+	s := NewRpcServer(WithHandlerTimeout(20 * time.Millisecond))
+	if err := s.Register(HandleService{}); err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := run(t, s)
+	c := newTestClient(addr)
+	defer c.Close()
+
+	// 客户端收到408后handler仍在执行，Shutdown等待handler结束
+	var reply int
+	start := time.Now()
+	err := c.Call(context.Background(), c.NewRequest("block", "HandleService.Ignore", &HandleArgs{Sleep: 300 * time.Millisecond}), &reply)
+	if e := errors.FromError(err); e.Code != 408 {
+		t.Fatalf("got %v, want a 408 timeout error", err)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Fatalf("Shutdown returned after %v while the handler was running", d)
+	}
+
+	// ctx到期后不再等待
+	s = NewRpcServer(WithHandlerTimeout(20 * time.Millisecond))
+	if err := s.Register(HandleService{}); err != nil {
+		t.Fatal(err)
+	}
+	addr, _ = run(t, s)
+	c = newTestClient(addr)
+	defer c.Close()
+	err = c.Call(context.Background(), c.NewRequest("block", "HandleService.Ignore", &HandleArgs{Sleep: time.Second}), &reply)
+	if e := errors.FromError(err); e.Code != 408 {
+		t.Fatalf("got %v, want a 408 timeout error", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
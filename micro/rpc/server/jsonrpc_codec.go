@@ -1,8 +1,11 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"go-micro/core/errors"
+	"net/http"
+	"reflect"
 
 	"io"
 	"sync"
@@ -10,14 +13,36 @@ import (
 
 var errMissingParams = errors.New("go-micro/rpc/server", "jsonrpc: request body missing params", 500)
 
+const jsonrpcVersion = "2.0"
+
+// JSON-RPC 2.0 标准错误码
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeServerError    = -32000
+)
+
+// serverCodec 同时支持JSON-RPC 1.0与2.0：
+// 1.0 params为只有一个元素的数组，元素为Message{Header, Body}，错误为字符串；
+// 2.0 params为参数本身（命名或位置参数），header通过扩展字段header传递，支持通知与批量请求
 type serverCodec struct {
-	dec     *json.Decoder // for reading JSON values
-	enc     *json.Encoder // for writing JSON values
-	c       io.Closer
-	req     serverRequest
-	mutex   sync.Mutex // protects seq, pending
+	dec *json.Decoder // for reading JSON values
+	enc *json.Encoder // for writing JSON values
+	c   io.Closer
+
+	// 以下字段只在读取协程中使用
+	req   serverRequest
+	queue []json.RawMessage // 批量请求中尚未读取的请求
+	batch *batch            // 当前读取的批量请求
+
+	mutex   sync.Mutex // protects seq, pending, batch responses
 	seq     uint64
-	pending map[uint64]*json.RawMessage
+	pending map[uint64]*pendingRequest
+
+	encMutex sync.Mutex // protects enc
 }
 
 func NewServerCodec(conn io.ReadWriteCloser) ServerCodec {
@@ -25,20 +50,40 @@ func NewServerCodec(conn io.ReadWriteCloser) ServerCodec {
 		dec:     json.NewDecoder(conn),
 		enc:     json.NewEncoder(conn),
 		c:       conn,
-		pending: make(map[uint64]*json.RawMessage),
+		pending: make(map[uint64]*pendingRequest),
 	}
 }
 
 type serverRequest struct {
-	Method string           `json:"method"`
-	Params *json.RawMessage `json:"params"`
-	Id     *json.RawMessage `json:"id"`
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Id      json.RawMessage `json:"id"`
+	// 2.0的扩展字段，用于传递header
+	Header http.Header `json:"header"`
 }
 
 func (r *serverRequest) reset() {
+	r.Version = ""
 	r.Method = ""
 	r.Params = nil
 	r.Id = nil
+	r.Header = nil
+}
+
+// 等待响应的请求
+type pendingRequest struct {
+	id      json.RawMessage
+	version string
+	// 2.0中没有id的请求为通知，不需要响应
+	notification bool
+	batch        *batch
+}
+
+// 批量请求的响应在所有请求处理完成后一起返回
+type batch struct {
+	remaining int
+	responses []interface{}
 }
 
 type serverResponse struct {
@@ -47,16 +92,96 @@ type serverResponse struct {
 	Error  interface{}      `json:"error"`
 }
 
+type successResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result"`
+	Id      json.RawMessage `json:"id"`
+}
+
+type errorResponse struct {
+	Version string          `json:"jsonrpc"`
+	Error   *JsonRpcError   `json:"error"`
+	Id      json.RawMessage `json:"id"`
+}
+
+// JsonRpcError JSON-RPC 2.0 的错误对象
+type JsonRpcError struct {
+	Code    int32       `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// 根据core/errors.Error生成错误对象，框架产生的错误转换为标准错误码，业务错误使用Error.Code
+func newError(errmsg string) *JsonRpcError {
+	e := errors.Parse(errmsg)
+	switch e.Id {
+	case IdInvalidRequest:
+		return &JsonRpcError{Code: CodeInvalidRequest, Message: "Invalid Request", Data: e}
+	case IdMethodNotFound:
+		return &JsonRpcError{Code: CodeMethodNotFound, Message: "Method not found", Data: e}
+	case IdInvalidParams:
+		return &JsonRpcError{Code: CodeInvalidParams, Message: "Invalid params", Data: e}
+	}
+
+	if e.Code == 0 && e.Id == "" {
+		return &JsonRpcError{Code: CodeServerError, Message: e.Detail}
+	}
+	code := e.Code
+	if code == 0 {
+		code = CodeServerError
+	}
+	return &JsonRpcError{Code: code, Message: e.Detail, Data: e}
+}
+
 func (c *serverCodec) ReadRequestHeader(r *Request) error {
 	c.req.reset()
-	if err := c.dec.Decode(&c.req); err != nil {
-		return err
+
+	for len(c.queue) == 0 {
+		var raw json.RawMessage
+		if err := c.dec.Decode(&raw); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				c.writeError(nil, &JsonRpcError{Code: CodeParseError, Message: "Parse error"})
+			}
+			return err
+		}
+
+		c.batch = nil
+		if !isArray(raw) {
+			c.queue = append(c.queue, raw)
+			break
+		}
+
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil || len(elems) == 0 {
+			c.writeError(nil, &JsonRpcError{Code: CodeInvalidRequest, Message: "Invalid Request"})
+			continue
+		}
+		c.batch = &batch{remaining: len(elems)}
+		c.queue = elems
+	}
+
+	raw := c.queue[0]
+	c.queue = c.queue[1:]
+
+	p := &pendingRequest{batch: c.batch}
+	if err := json.Unmarshal(raw, &c.req); err != nil {
+		// 无法解析的请求，method为空，由Server返回Invalid Request
+		c.req.reset()
+		p.version = jsonrpcVersion
+	} else {
+		p.version = c.req.Version
+		p.id = c.req.Id
 	}
+	if c.batch != nil {
+		p.version = jsonrpcVersion
+	}
+	c.req.Version = p.version
+	p.notification = p.version == jsonrpcVersion && len(p.id) == 0 && c.req.Method != ""
+
 	r.ServiceMethod = c.req.Method
 	c.mutex.Lock()
 	c.seq++
-	c.pending[c.seq] = c.req.Id
-	c.req.Id = nil
+	c.pending[c.seq] = p
 	r.Seq = c.seq
 	c.mutex.Unlock()
 
@@ -67,12 +192,16 @@ func (c *serverCodec) ReadRequestBody(r *Request, x interface{}) error {
 	if x == nil {
 		return nil
 	}
+	if c.req.Version == jsonrpcVersion {
+		return c.readParams(r, x)
+	}
+
 	if c.req.Params == nil {
 		return errMissingParams
 	}
 	var params [1]Message
 
-	if e := json.Unmarshal(*c.req.Params, &params); e != nil {
+	if e := json.Unmarshal(c.req.Params, &params); e != nil {
 		return e
 	}
 	r.Header = params[0].Header
@@ -80,11 +209,71 @@ func (c *serverCodec) ReadRequestBody(r *Request, x interface{}) error {
 	return json.Unmarshal(params[0].Body, x)
 }
 
+// 读取2.0的参数，支持命名参数（对象）与位置参数（数组）
+func (c *serverCodec) readParams(r *Request, x interface{}) error {
+	r.Header = c.req.Header
+
+	params := bytes.TrimSpace(c.req.Params)
+	if len(params) == 0 || bytes.Equal(params, null) {
+		return nil
+	}
+
+	switch params[0] {
+	case '{':
+		return json.Unmarshal(params, x)
+	case '[':
+		return unmarshalPositional(params, x)
+	}
+	return errors.BadRequest("go-micro/rpc/server/serverCodec.ReadRequestBody", "jsonrpc: params must be an object or array")
+}
+
+// 位置参数：参数为数组或切片时整体解析；只有一个元素时解析为参数本身；
+// 否则按顺序依次赋值给结构体的导出字段
+func unmarshalPositional(params json.RawMessage, x interface{}) error {
+	v := reflect.ValueOf(x)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		return json.Unmarshal(params, x)
+	}
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal(params, &elems); err != nil {
+		return err
+	}
+	if len(elems) == 0 {
+		return nil
+	}
+	if len(elems) == 1 && (v.Kind() != reflect.Struct || isObject(elems[0])) {
+		return json.Unmarshal(elems[0], x)
+	}
+	if v.Kind() != reflect.Struct {
+		return errors.BadRequest("go-micro/rpc/server/serverCodec.ReadRequestBody", "jsonrpc: too many params")
+	}
+
+	var fields []reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).PkgPath == "" {
+			fields = append(fields, v.Field(i))
+		}
+	}
+	if len(elems) > len(fields) {
+		return errors.BadRequest("go-micro/rpc/server/serverCodec.ReadRequestBody", "jsonrpc: too many params")
+	}
+	for i, elem := range elems {
+		if err := json.Unmarshal(elem, fields[i].Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 var null = json.RawMessage([]byte("null"))
 
 func (c *serverCodec) WriteResponse(r *Response, x interface{}) error {
 	c.mutex.Lock()
-	b, ok := c.pending[r.Seq]
+	p, ok := c.pending[r.Seq]
 
 	if !ok {
 		c.mutex.Unlock()
@@ -94,22 +283,83 @@ func (c *serverCodec) WriteResponse(r *Response, x interface{}) error {
 	delete(c.pending, r.Seq)
 	c.mutex.Unlock()
 
-	if b == nil {
-		b = &null
-	}
-	resp := serverResponse{Id: b}
-	if r.Error == "" {
-		resp.Result = x
+	var resp interface{}
+	if p.version == jsonrpcVersion {
+		resp = newResponse(p.id, r, x)
 	} else {
-		resp.Error = r.Error
+		b := null
+		if len(p.id) > 0 {
+			b = p.id
+		}
+		legacy := serverResponse{Id: &b}
+		if r.Error == "" {
+			legacy.Result = x
+		} else {
+			legacy.Error = r.Error
+		}
+		resp = legacy
+	}
+
+	if p.batch == nil {
+		if p.notification {
+			return nil
+		}
+		return c.encode(resp)
 	}
-	return c.enc.Encode(resp)
+
+	c.mutex.Lock()
+	if !p.notification {
+		p.batch.responses = append(p.batch.responses, resp)
+	}
+	p.batch.remaining--
+	done := p.batch.remaining == 0
+	responses := p.batch.responses
+	c.mutex.Unlock()
+
+	// 全部是通知的批量请求不需要响应
+	if !done || len(responses) == 0 {
+		return nil
+	}
+	return c.encode(responses)
+}
+
+func newResponse(id json.RawMessage, r *Response, x interface{}) interface{} {
+	if len(id) == 0 {
+		id = null
+	}
+	if r.Error != "" {
+		return &errorResponse{Version: jsonrpcVersion, Error: newError(r.Error), Id: id}
+	}
+	return &successResponse{Version: jsonrpcVersion, Result: x, Id: id}
+}
+
+func (c *serverCodec) writeError(id json.RawMessage, e *JsonRpcError) error {
+	if len(id) == 0 {
+		id = null
+	}
+	return c.encode(&errorResponse{Version: jsonrpcVersion, Error: e, Id: id})
+}
+
+func (c *serverCodec) encode(v interface{}) error {
+	c.encMutex.Lock()
+	defer c.encMutex.Unlock()
+	return c.enc.Encode(v)
 }
 
 func (c *serverCodec) Close() error {
 	return c.c.Close()
 }
 
+func isArray(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) > 0 && raw[0] == '['
+}
+
+func isObject(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) > 0 && raw[0] == '{'
+}
+
 //func ServeConn(conn io.ReadWriteCloser) {
 //	ServeCodec(NewServerCodec(conn))
 //}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"go-micro/core/errors"
+	"net"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type ArithArgs struct {
+	A, B int
+}
+
+type ArithService struct{}
+
+func (ArithService) Add(ctx context.Context, args *ArithArgs, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+type jsonrpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *JsonRpcError   `json:"error"`
+	Id      json.RawMessage `json:"id"`
+}
+
+// jsonrpcConn 以换行分隔发送原始的JSON-RPC请求并读取响应
+type jsonrpcConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialJSONRPC(t *testing.T) *jsonrpcConn {
+	s := NewRpcServer()
+	if err := s.Register(ArithService{}); err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := run(t, s)
+	t.Cleanup(func() { s.Stop() })
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &jsonrpcConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *jsonrpcConn) send(req string) {
+	if _, err := c.conn.Write([]byte(req + "\n")); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *jsonrpcConn) read(v interface{}) {
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := c.r.ReadBytes('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := json.Unmarshal(line, v); err != nil {
+		c.t.Fatalf("%v: %s", err, line)
+	}
+}
+
+func (c *jsonrpcConn) call(req string) *jsonrpcResponse {
+	c.send(req)
+	rsp := new(jsonrpcResponse)
+	c.read(rsp)
+	return rsp
+}
+
+func TestJSONRPC2Params(t *testing.T) {
+	c := dialJSONRPC(t)
+	for _, tc := range []struct {
+		name, req, id string
+	}{
+		{"named", `{"jsonrpc":"2.0","method":"ArithService.Add","params":{"A":1,"B":2},"id":1}`, `1`},
+		{"positional", `{"jsonrpc":"2.0","method":"ArithService.Add","params":[1,2],"id":"p"}`, `"p"`},
+		{"positional object", `{"jsonrpc":"2.0","method":"ArithService.Add","params":[{"A":1,"B":2}],"id":3}`, `3`},
+	} {
+		rsp := c.call(tc.req)
+		if rsp.Version != "2.0" || rsp.Error != nil || string(rsp.Result) != "3" || string(rsp.Id) != tc.id {
+			t.Errorf("%s: got %+v", tc.name, rsp)
+		}
+	}
+}
+
+func TestJSONRPC2Errors(t *testing.T) {
+	c := dialJSONRPC(t)
+	for _, tc := range []struct {
+		name, req string
+		code      int32
+	}{
+		{"invalid request", `{"jsonrpc":"2.0","method":"Add","id":1}`, CodeInvalidRequest},
+		{"unknown service", `{"jsonrpc":"2.0","method":"Nope.Add","id":1}`, CodeMethodNotFound},
+		{"unknown method", `{"jsonrpc":"2.0","method":"ArithService.Nope","id":1}`, CodeMethodNotFound},
+		{"params not object or array", `{"jsonrpc":"2.0","method":"ArithService.Add","params":"x","id":1}`, CodeInvalidParams},
+		{"too many params", `{"jsonrpc":"2.0","method":"ArithService.Add","params":[1,2,3],"id":1}`, CodeInvalidParams},
+		{"wrong param type", `{"jsonrpc":"2.0","method":"ArithService.Add","params":{"A":"x"},"id":1}`, CodeInvalidParams},
+	} {
+		rsp := c.call(tc.req)
+		if rsp.Error == nil || rsp.Error.Code != tc.code || string(rsp.Id) != "1" {
+			t.Errorf("%s: got %+v, want code %d", tc.name, rsp, tc.code)
+		}
+	}
+}
+
+func TestJSONRPC2Notification(t *testing.T) {
+	c := dialJSONRPC(t)
+	// 通知没有响应，下一个响应属于之后的请求
+	c.send(`{"jsonrpc":"2.0","method":"ArithService.Add","params":[1,1]}`)
+	c.send(`{"jsonrpc":"2.0","method":"ArithService.Nope"}`)
+	rsp := c.call(`{"jsonrpc":"2.0","method":"ArithService.Add","params":[2,2],"id":"after"}`)
+	if string(rsp.Id) != `"after"` || string(rsp.Result) != "4" {
+		t.Fatalf("got %+v, want the response of the request after the notifications", rsp)
+	}
+}
+
+func TestJSONRPC2Batch(t *testing.T) {
+	c := dialJSONRPC(t)
+
+	c.send(`[
+		{"jsonrpc":"2.0","method":"ArithService.Add","params":[1,1],"id":1},
+		{"jsonrpc":"2.0","method":"ArithService.Add","params":[1,2]},
+		1,
+		{"jsonrpc":"2.0","method":"ArithService.Nope","id":2},
+		{"jsonrpc":"2.0","method":"ArithService.Add","params":[2,2],"id":3}
+	]`)
+	var responses []jsonrpcResponse
+	c.read(&responses)
+
+	// 批量请求的响应顺序不固定，按id比较，无法解析的元素id为null
+	got := make(map[string]string)
+	for _, rsp := range responses {
+		if rsp.Error != nil {
+			got[string(rsp.Id)] = strconv.Itoa(int(rsp.Error.Code))
+			continue
+		}
+		got[string(rsp.Id)] = string(rsp.Result)
+	}
+	want := map[string]string{"1": "2", "null": "-32600", "2": "-32601", "3": "4"}
+	if len(responses) != 4 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestJSONRPC2EmptyBatch(t *testing.T) {
+	c := dialJSONRPC(t)
+	rsp := c.call(`[]`)
+	if rsp.Error == nil || rsp.Error.Code != CodeInvalidRequest || string(rsp.Id) != "null" {
+		t.Fatalf("got %+v, want an invalid request error", rsp)
+	}
+
+	// 全部是通知的批量请求没有响应
+	c.send(`[{"jsonrpc":"2.0","method":"ArithService.Add","params":[1,1]}]`)
+	rsp = c.call(`{"jsonrpc":"2.0","method":"ArithService.Add","params":[1,2],"id":1}`)
+	if string(rsp.Id) != "1" || string(rsp.Result) != "3" {
+		t.Fatalf("got %+v, want the response of the request after the batch", rsp)
+	}
+}
+
+func TestPingSkipsHandlerWrappers(t *testing.T) {
+	var wrapped int32
+	s := NewRpcServer(WithHandlerWrap(func(h HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *Request, argv, rsp interface{}) error {
+			atomic.AddInt32(&wrapped, 1)
+			return errors.TooManyRequests("test", "rejected")
+		}
+	}))
+	addr, _ := run(t, s)
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &jsonrpcConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	rsp := c.call(`{"jsonrpc":"2.0","method":"rpc.ping","id":1}`)
+	if rsp.Error != nil || string(rsp.Result) != "{}" {
+		t.Fatalf("got %+v, want an empty result", rsp)
+	}
+	// 1.0的请求格式
+	var legacy struct {
+		Result json.RawMessage
+		Error  interface{}
+	}
+	c.send(`{"method":"rpc.ping","params":[{"Body":{}}],"id":2}`)
+	c.read(&legacy)
+	if legacy.Error != nil || string(legacy.Result) != "{}" {
+		t.Fatalf("got %+v, want an empty result", legacy)
+	}
+	if n := atomic.LoadInt32(&wrapped); n != 0 {
+		t.Fatalf("ping went through the handler wrappers %d times", n)
+	}
+}
@@ -1,13 +1,71 @@
 package server
 
-var defaultServerOptions = serverOptions{}
+import (
+	"crypto/tls"
+	"go-micro/core/cert"
+	"go-micro/rpc/registry"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	DefaultRegisterTTL      = 30 * time.Second
+	DefaultRegisterInterval = 10 * time.Second
+	//流的接收窗口，客户端最多发送该数量的handler未接收的消息
+	DefaultStreamBuffer = 128
+)
+
+var defaultServerOptions = serverOptions{
+	registerTTL:      DefaultRegisterTTL,
+	registerInterval: DefaultRegisterInterval,
+	streamBuffer:     DefaultStreamBuffer,
+	debug:            true,
+}
 
 type serverOptions struct {
 	openssl  bool
 	certFile string
 	keyFile  string
+	//验证客户端证书的CA，设置后开启双向认证
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+	//设置后代替certFile、keyFile与clientCAFile
+	certManager *cert.Manager
 
 	wraps []HandlerWrapper
+
+	//支持的序列化方式，key为content-type
+	codecs map[string]NewCodec
+
+	//服务注册中心，为nil时不注册
+	registry registry.Registry
+	//注册到注册中心的服务名
+	name    string
+	version string
+	//注册的节点id，默认根据服务名随机生成
+	id string
+	//注册的节点地址，默认使用监听地址
+	advertise string
+	metadata  map[string]string
+	//节点存活时间
+	registerTTL time.Duration
+	//重新注册的间隔，需小于registerTTL
+	registerInterval time.Duration
+
+	//是否注册内置的Debug服务
+	debug bool
+
+	//handler的默认超时时间，0表示只受客户端的超时限制
+	timeout time.Duration
+	//按Service.Method设置的超时时间，优先于timeout
+	methodTimeouts map[string]time.Duration
+
+	//流的接收窗口，客户端没有遵守窗口导致超过上限时取消流
+	streamBuffer int
+
+	//记录handler panic的日志，默认使用zap的全局logger
+	logger *zap.Logger
 }
 
 type ServerOption interface {
@@ -45,8 +103,137 @@ func SetRSAKey(cartfile, keyfile string) ServerOption {
 	})
 }
 
+// 双向认证，使用caFile验证客户端证书，需要同时设置SetRSAKey；
+// 没有通过WithClientAuth指定验证方式时要求客户端提供并通过验证的证书
+func WithClientCA(caFile string) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.clientCAFile = caFile
+		if caFile != "" && o.clientAuth == tls.NoClientCert {
+			o.clientAuth = tls.RequireAndVerifyClientCert
+		}
+	})
+}
+
+// 使用外部的证书管理器提供服务端证书与验证客户端的CA，由调用方负责关闭
+func WithCertManager(m *cert.Manager) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.certManager = m
+		o.openssl = m != nil
+	})
+}
+
+// 客户端证书的验证方式
+func WithClientAuth(auth tls.ClientAuthType) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.clientAuth = auth
+	})
+}
+
 func WithHandlerWrap(hw ...HandlerWrapper) ServerOption {
 	return newFuncServerOption(func(options *serverOptions) {
 		options.wraps = append(options.wraps, hw...)
 	})
 }
+
+// 注册content-type对应的序列化方式，客户端通过首帧协商使用
+func WithCodec(contentType string, nc NewCodec) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		if o.codecs == nil {
+			o.codecs = make(map[string]NewCodec, len(DefaultCodecs)+1)
+			for ct, c := range DefaultCodecs {
+				o.codecs[ct] = c
+			}
+		}
+		o.codecs[contentType] = nc
+	})
+}
+
+func WithRegistry(r registry.Registry) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.registry = r
+	})
+}
+
+func WithName(name string) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.name = name
+	})
+}
+
+func WithVersion(version string) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.version = version
+	})
+}
+
+func WithId(id string) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.id = id
+	})
+}
+
+func WithAdvertise(address string) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.advertise = address
+	})
+}
+
+func WithMetadata(md map[string]string) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.metadata = md
+	})
+}
+
+func WithRegisterTTL(ttl time.Duration) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.registerTTL = ttl
+	})
+}
+
+func WithRegisterInterval(interval time.Duration) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.registerInterval = interval
+	})
+}
+
+// 是否注册内置的Debug服务，默认注册；Debug服务会暴露所有方法的参数结构与调用次数，
+// 与其他服务一样经过HandlerWrapper，开启认证时可以通过Debug.*规则限制访问
+func WithDebug(enable bool) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.debug = enable
+	})
+}
+
+// handler的默认超时时间，超时后取消handler的context并立即返回408，不等待handler返回，流式方法不受限制；
+// 超时后继续执行的handler在Shutdown时仍会被等待
+func WithHandlerTimeout(timeout time.Duration) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.timeout = timeout
+	})
+}
+
+// 单个方法的超时时间，serviceMethod格式为 Service.Method
+func WithMethodTimeout(serviceMethod string, timeout time.Duration) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		m := make(map[string]time.Duration, len(o.methodTimeouts)+1)
+		for k, v := range o.methodTimeouts {
+			m[k] = v
+		}
+		m[serviceMethod] = timeout
+		o.methodTimeouts = m
+	})
+}
+
+// 流的接收窗口，handler未接收的客户端消息达到n条时客户端的Send等待，0表示不限制；
+// 客户端没有遵守窗口导致超过上限时取消流并返回429，连接上的其他调用不受影响
+func WithStreamBuffer(n int) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.streamBuffer = n
+	})
+}
+
+func WithLogger(logger *zap.Logger) ServerOption {
+	return newFuncServerOption(func(o *serverOptions) {
+		o.logger = logger
+	})
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/url"
+)
+
+// Peer 连接的对端，开启tls双向认证时包含通过验证的客户端证书中的身份
+type Peer struct {
+	Addr net.Addr
+
+	// 通过验证的客户端证书，没有时为nil
+	Certificate    *x509.Certificate
+	CommonName     string
+	DNSNames       []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	EmailAddresses []string
+}
+
+// Verified 客户端是否提供了通过验证的证书
+func (p *Peer) Verified() bool {
+	return p.Certificate != nil
+}
+
+type peerKey struct{}
+
+// PeerFromContext 获取handler的context中的对端信息
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+func newPeerContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// newPeer tls连接需要已经完成握手，只使用通过验证的证书链中的客户端证书
+func newPeer(conn net.Conn) *Peer {
+	p := &Peer{Addr: conn.RemoteAddr()}
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return p
+	}
+	chains := tc.ConnectionState().VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return p
+	}
+	cert := chains[0][0]
+	p.Certificate = cert
+	p.CommonName = cert.Subject.CommonName
+	p.DNSNames = cert.DNSNames
+	p.IPAddresses = cert.IPAddresses
+	p.URIs = cert.URIs
+	p.EmailAddresses = cert.EmailAddresses
+	return p
+}
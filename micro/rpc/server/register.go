@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"go-micro/core/debug"
+	"go-micro/rpc/registry"
+	"net"
+	"time"
+)
+
+var ErrServerNameEmpty = errors.New("rpc: server name is required to register with registry")
+
+func newNodeId(name string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return name + "-" + hex.EncodeToString(b)
+}
+
+// 构造注册到注册中心的服务信息
+func (s *RpcServer) service() *registry.Service {
+	return &registry.Service{
+		Name:     s.opts.name,
+		Version:  s.opts.version,
+		Metadata: s.opts.metadata,
+		Nodes: []*registry.Node{{
+			Id:      s.opts.id,
+			Address: s.address,
+		}},
+	}
+}
+
+// 注册服务，并按registerInterval定时重新注册以刷新存活时间
+func (s *RpcServer) register(lis net.Listener) error {
+	if s.opts.registry == nil {
+		return nil
+	}
+	if s.opts.name == "" {
+		return ErrServerNameEmpty
+	}
+
+	s.mu.Lock()
+	s.address = advertiseAddress(s.opts.advertise, lis)
+	s.mu.Unlock()
+	if err := s.opts.registry.Register(s.service(), registry.RegisterTTL(s.opts.registerTTL)); err != nil {
+		return err
+	}
+	debug.DD("register %s node %s on %s (%s)", s.opts.name, s.opts.id, s.address, s.opts.registry)
+
+	if s.opts.registerInterval > 0 {
+		done := make(chan struct{})
+		s.mu.Lock()
+		s.heartbeatDone = done
+		s.mu.Unlock()
+		go s.heartbeat(done)
+	}
+	return nil
+}
+
+func (s *RpcServer) heartbeat(done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.opts.registerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := s.opts.registry.Register(s.service(), registry.RegisterTTL(s.opts.registerTTL))
+			debug.DE(err)
+		case <-s.exit:
+			return
+		}
+	}
+}
+
+// 从注册中心注销，只会执行一次
+func (s *RpcServer) deregister() {
+	s.exitOnce.Do(func() {
+		close(s.exit)
+
+		s.mu.Lock()
+		registered := s.address != ""
+		heartbeatDone := s.heartbeatDone
+		s.mu.Unlock()
+		if s.opts.registry == nil || !registered {
+			return
+		}
+		// 等待正在执行的心跳注册返回，否则节点会在注销之后被重新注册
+		if heartbeatDone != nil {
+			<-heartbeatDone
+		}
+		debug.DE(s.opts.registry.Deregister(s.service()))
+	})
+}
+
+// 获取注册到注册中心的地址，监听在未指定的ip上时使用本机的内网ip
+func advertiseAddress(advertise string, lis net.Listener) string {
+	if advertise != "" {
+		return advertise
+	}
+
+	addr := lis.Addr().String()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return addr
+	}
+	return net.JoinHostPort(localIP(), port)
+}
+
+func localIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "127.0.0.1"
+	}
+
+	var fallback string
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() {
+			continue
+		}
+		ip := ipnet.IP.To4()
+		if ip == nil {
+			continue
+		}
+		if isPrivate(ip) {
+			return ip.String()
+		}
+		if fallback == "" {
+			fallback = ip.String()
+		}
+	}
+	if fallback == "" {
+		return "127.0.0.1"
+	}
+	return fallback
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip[0] == 10 ||
+		(ip[0] == 172 && ip[1]&0xf0 == 16) ||
+		(ip[0] == 192 && ip[1] == 168)
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"go-micro/rpc/registry"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowRegistry 心跳的注册在收到release之前不会返回，记录注册与注销的顺序
+type slowRegistry struct {
+	registry.Registry
+	heartbeat chan struct{}
+	release   chan struct{}
+
+	mu  sync.Mutex
+	ops []string
+}
+
+func (r *slowRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	r.mu.Lock()
+	first := len(r.ops) == 0
+	r.mu.Unlock()
+	if !first {
+		select {
+		case r.heartbeat <- struct{}{}:
+		default:
+		}
+		<-r.release
+	}
+	r.record("register")
+	return r.Registry.Register(s, opts...)
+}
+
+func (r *slowRegistry) Deregister(s *registry.Service) error {
+	r.record("deregister")
+	return r.Registry.Deregister(s)
+}
+
+func (r *slowRegistry) record(op string) {
+	r.mu.Lock()
+	r.ops = append(r.ops, op)
+	r.mu.Unlock()
+}
+
+func TestDeregisterWaitsForHeartbeat(t *testing.T) {
+	r := &slowRegistry{
+		Registry:  registry.NewMemoryRegistry(),
+		heartbeat: make(chan struct{}, 1),
+		release:   make(chan struct{}),
+	}
+	s := NewRpcServer(WithName("heartbeat"), WithRegistry(r), WithRegisterInterval(10*time.Millisecond))
+	_, done := run(t, s)
+
+	// 心跳的注册正在执行时关闭服务
+	<-r.heartbeat
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	close(r.release)
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	// 没有等待心跳时，心跳的注册会在注销之后返回
+	time.Sleep(20 * time.Millisecond)
+
+	r.mu.Lock()
+	last := r.ops[len(r.ops)-1]
+	r.mu.Unlock()
+	if last != "deregister" {
+		t.Fatalf("ops = %v, want deregister last", r.ops)
+	}
+	if services, _ := r.GetService("heartbeat"); len(services) > 0 && len(services[0].Nodes) > 0 {
+		t.Fatalf("node still registered after Shutdown: %+v", services[0].Nodes)
+	}
+}
@@ -3,24 +3,41 @@ package server
 import (
 	"context"
 	"errors"
+	"go-micro/rpc/codec"
+	"go-micro/rpc/metadata"
 	"go/token"
 	"io"
 	"log"
 	"net/http"
 	"reflect"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
 var debugLog = false
 
+// ErrServerClosed is returned by RpcServer.Run after a call to Shutdown or Stop.
+var ErrServerClosed = errors.New("rpc: Server closed")
+
+// shutdownPollInterval is how often Shutdown checks for idle connections.
+var shutdownPollInterval = 100 * time.Millisecond
+
 type methodType struct {
 	sync.Mutex // protects counters
 	method     reflect.Method
 	ArgType    reflect.Type
 	ReplyType  reflect.Type
 	numCalls   uint
+	// 流式方法的第三个参数为Stream，没有ReplyType
+	stream bool
 }
 
 func (m *methodType) NumCalls() (n uint) {
@@ -59,12 +76,52 @@ type Server struct {
 	respLock   sync.Mutex // protects freeResp
 	freeResp   *Response
 	wraps      []HandlerWrapper
+
+	timeout        time.Duration
+	methodTimeouts map[string]time.Duration
+	streamBuffer   int
+	logger         *zap.Logger
+
+	mu         sync.Mutex // protects conns
+	conns      map[*conn]struct{}
+	inShutdown int32 // accessed atomically
+}
+
+// conn tracks a codec being served by ServeCodec, so that Shutdown can
+// tell idle connections from the ones with calls still in flight.
+type conn struct {
+	codec    ServerCodec
+	wg       sync.WaitGroup
+	inflight int32 // accessed atomically
+	// 超时返回408之后继续执行的handler，连接在它们结束之前不会从Server中移除，
+	// Shutdown因此会等待它们直到ctx到期
+	handlers sync.WaitGroup
+	// closeIdleConns已经关闭该连接，之后读到的请求不再执行，protected by Server.mu
+	closing bool
+
+	// 连接断开时取消所有正在执行的handler
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex // protects streams, calls
+	streams map[uint64]*serverStream
+	// 正在执行的普通调用，客户端可以通过取消帧取消
+	calls map[uint64]context.CancelFunc
+}
+
+func (c *conn) isIdle() bool {
+	return atomic.LoadInt32(&c.inflight) == 0
 }
 
 // NewServer returns a new Server.
 func NewServer(opts serverOptions) *Server {
 	return &Server{
-		wraps: opts.wraps,
+		wraps:          opts.wraps,
+		timeout:        opts.timeout,
+		methodTimeouts: opts.methodTimeouts,
+		streamBuffer:   opts.streamBuffer,
+		logger:         opts.logger,
+		conns:          make(map[*conn]struct{}),
 	}
 }
 
@@ -157,6 +214,17 @@ func suitableMethods(typ reflect.Type, reportErr bool) map[string]*methodType {
 			}
 			continue
 		}
+		// 第三个参数为Stream的是流式方法
+		if mtype.In(3) == typeOfStream {
+			if mtype.NumOut() != 1 || mtype.Out(0) != typeOfError {
+				if reportErr {
+					log.Printf("rpc.Register: stream method %q must return exactly one error\n", mname)
+				}
+				continue
+			}
+			methods[mname] = &methodType{method: method, ArgType: argType, stream: true}
+			continue
+		}
 		// Second arg must be a pointer.
 		replyType := mtype.In(3)
 		if replyType.Kind() != reflect.Ptr {
@@ -214,15 +282,34 @@ func (server *Server) sendResponse(sending *sync.Mutex, req *Request, reply inte
 	server.freeResponse(resp)
 }
 
-func (s *service) call(server *Server, sending *sync.Mutex, wg *sync.WaitGroup, mtype *methodType, req *Request, argv, replyv reflect.Value, codec ServerCodec) {
+func (s *service) call(server *Server, sending *sync.Mutex, c *conn, ctx context.Context, cancel context.CancelFunc, mtype *methodType, req *Request, argv, replyv reflect.Value, codec ServerCodec) {
+	// 响应发送完毕后才算请求结束，Shutdown依赖这个计数判断连接是否空闲
+	seq := req.Seq
+	defer func() {
+		c.removeCall(seq)
+		cancel()
+		atomic.AddInt32(&c.inflight, -1)
+		c.wg.Done()
+	}()
 
-	ctx, cancel := context.WithCancel(context.TODO())
-	defer cancel()
+	errs := ""
+	err := s.handle(server, c, ctx, mtype, req, argv, replyv)
+	if err != nil {
+		errs = err.Error()
+	}
+
+	server.sendResponse(sending, req, replyv.Interface(), codec, errs)
+	server.freeRequest(req)
+}
+
+// handle 经过HandlerWrapper执行服务方法，handler与HandlerWrapper中的panic转换为500错误；
+// c为请求所在的连接，通过Server.Call执行时为nil
+func (s *service) handle(server *Server, c *conn, ctx context.Context, mtype *methodType, req *Request, argv, replyv reflect.Value) (err error) {
 	// 修改处
-	call := func(ctx context.Context, req *Request, argv, rsp interface{}) error {
-		if wg != nil {
-			defer wg.Done()
-		}
+	call := func(ctx context.Context, req *Request, argv, rsp interface{}) (err error) {
+		// 在最内层恢复，HandlerWrapper可以看到panic产生的错误
+		defer server.recoverPanic(req.ServiceMethod, &err)
+
 		mtype.Lock()
 		mtype.numCalls++
 		mtype.Unlock()
@@ -241,21 +328,158 @@ func (s *service) call(server *Server, sending *sync.Mutex, wg *sync.WaitGroup,
 		call = server.wraps[i-1](call)
 	}
 
-	errs := ""
-	err := call(ctx, req, argv.Interface(), replyv.Interface())
+	defer server.recoverPanic(req.ServiceMethod, &err)
+
+	timeout := server.handlerTimeout(req.ServiceMethod)
+	if timeout <= 0 || mtype.stream {
+		return call(ctx, req, argv.Interface(), replyv.Interface())
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// handler在单独的协程中执行，忽略ctx的handler也能在超时时返回408；
+	// 超时后handler可能继续执行，使用请求的副本，原请求在响应发送后会被复用；
+	// 继续执行的handler计入连接，Shutdown会等待它们结束
+	hreq := *req
+	hreq.next = nil
+	done := make(chan error, 1)
+	if c != nil {
+		c.handlers.Add(1)
+	}
+	go func() {
+		var err error
+		defer func() {
+			if c != nil {
+				c.handlers.Done()
+			}
+			done <- err
+		}()
+		defer server.recoverPanic(hreq.ServiceMethod, &err)
+		err = call(tctx, &hreq, argv.Interface(), replyv.Interface())
+	}()
+
+	select {
+	case err = <-done:
+	case <-tctx.Done():
+		select {
+		case err = <-done:
+		default:
+			// 客户端的超时与取消保持handler返回的错误
+			if ctx.Err() != nil {
+				err = <-done
+				break
+			}
+			return errTimeout("rpc: %s timed out after %s", req.ServiceMethod, timeout)
+		}
+	}
+	// 已经返回的成功结果保留，只转换服务端自己的超时
+	if err != nil && tctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return errTimeout("rpc: %s timed out after %s", req.ServiceMethod, timeout)
+	}
+	return err
+}
+
+func (server *Server) handlerTimeout(serviceMethod string) time.Duration {
+	if d, ok := server.methodTimeouts[serviceMethod]; ok {
+		return d
+	}
+	return server.timeout
+}
+
+// recoverPanic 将panic转换为500错误，堆栈只记录在日志中
+func (server *Server) recoverPanic(serviceMethod string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	logger := server.logger
+	if logger == nil {
+		logger = zap.L()
+	}
+	logger.Error("rpc: handler panic",
+		zap.String("method", serviceMethod),
+		zap.Any("panic", r),
+		zap.ByteString("stack", debug.Stack()),
+	)
+	*err = errPanic("rpc: %s panic: %v", serviceMethod, r)
+}
+
+// newContext 根据请求头重建handler的context，携带客户端的metadata与剩余的超时时间
+func newContext(parent context.Context, req *Request) (context.Context, context.CancelFunc) {
+	ctx := parent
+	if md := metadata.FromHeader(req.Header); len(md) > 0 {
+		ctx = metadata.MergeContext(ctx, md, true)
+	}
+	if d, ok := metadata.Timeout(req.Header); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Call invokes the named method in the calling goroutine, going through the
+// HandlerWrapper chain like requests read from a ServerCodec do. decode fills
+// in the freshly allocated argument. It is meant for transports that do not
+// speak a ServerCodec, such as the HTTP gateway.
+func (server *Server) Call(ctx context.Context, req *Request, decode func(argv interface{}) error) (interface{}, error) {
+	svc, mtype, err := server.lookup(req.ServiceMethod)
 	if err != nil {
-		errs = err.Error()
+		return nil, err
 	}
 
-	server.sendResponse(sending, req, replyv.Interface(), codec, errs)
-	server.freeRequest(req)
+	if mtype.stream {
+		return nil, errInvalidRequest("rpc: %s is a stream method", req.ServiceMethod)
+	}
+
+	argv, argIsValue := newArgv(mtype)
+	if err := decode(argv.Interface()); err != nil {
+		return nil, errInvalidParamsFrom(req.ServiceMethod, err)
+	}
+	if argIsValue {
+		argv = argv.Elem()
+	}
+
+	ctx, cancel := newContext(ctx, req)
+	defer cancel()
+
+	replyv := newReplyv(mtype)
+	if err := svc.handle(server, nil, ctx, mtype, req, argv, replyv); err != nil {
+		return nil, err
+	}
+	return replyv.Interface(), nil
+}
+
+// Methods returns the registered methods in "Service.Method" form.
+func (server *Server) Methods() []string {
+	var methods []string
+	server.serviceMap.Range(func(_, svci interface{}) bool {
+		svc := svci.(*service)
+		for name := range svc.method {
+			methods = append(methods, svc.name+"."+name)
+		}
+		return true
+	})
+	sort.Strings(methods)
+	return methods
+}
+
+// IsStream 是否为流式方法，方法不存在时返回false
+func (server *Server) IsStream(serviceMethod string) bool {
+	_, mtype, err := server.lookup(serviceMethod)
+	return err == nil && mtype.stream
 }
 
 func (server *Server) ServeCodec(codec ServerCodec) {
+	server.serveCodec(context.Background(), codec)
+}
+
+// serveCodec ctx为连接的context，携带对端信息等连接级别的数据，handler的context由它派生
+func (server *Server) serveCodec(ctx context.Context, codec ServerCodec) {
 	sending := new(sync.Mutex)
-	wg := new(sync.WaitGroup)
+	c := server.trackConn(ctx, codec)
+	defer server.untrackConn(c)
 	for {
-		service, mtype, req, argv, replyv, keepReading, err := server.readRequest(codec)
+		service, mtype, req, argv, replyv, keepReading, err := server.readRequest(c)
 		if err != nil {
 			if debugLog && err != io.EOF {
 				log.Println("rpc:", err)
@@ -270,12 +494,137 @@ func (server *Server) ServeCodec(codec ServerCodec) {
 			}
 			continue
 		}
-		wg.Add(1)
-		go service.call(server, sending, wg, mtype, req, argv, replyv, codec)
+		if req == nil {
+			// 流的后续消息，已经交给对应的stream
+			continue
+		}
+		if mtype == nil {
+			// 健康检查不经过HandlerWrapper，也不计入正在执行的请求
+			server.sendResponse(sending, req, &emptypb.Empty{}, codec, "")
+			server.freeRequest(req)
+			continue
+		}
+		if err := server.startCall(c); err != nil {
+			if err == errConnClosing {
+				server.freeRequest(req)
+				break
+			}
+			server.sendResponse(sending, req, invalidRequest, codec, err.Error())
+			server.freeRequest(req)
+			continue
+		}
+		if mtype.stream {
+			sc, _ := asStreamCodec(codec)
+			st := newServerStream(c.ctx, req, sc, sending, server.streamBuffer)
+			server.freeRequest(req)
+			c.addStream(st)
+			go service.stream(server, st, c, mtype, argv)
+			continue
+		}
+		// 在读取下一个请求之前登记，保证之后的取消帧能找到该调用
+		ctx, cancel := newContext(c.ctx, req)
+		c.addCall(req.Seq, cancel)
+		go service.call(server, sending, c, ctx, cancel, mtype, req, argv, replyv, codec)
 	}
 
-	wg.Wait()
+	// 读取失败说明连接已经断开
+	c.cancel()
+	c.wg.Wait()
 	codec.Close()
+	c.handlers.Wait()
+}
+
+func (server *Server) trackConn(ctx context.Context, codec ServerCodec) *conn {
+	c := &conn{codec: codec}
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	server.mu.Lock()
+	server.conns[c] = struct{}{}
+	server.mu.Unlock()
+	return c
+}
+
+// errConnClosing 连接在读到请求时已经被closeIdleConns关闭，请求没有执行
+var errConnClosing = errors.New("rpc: connection is closing")
+
+// startCall 在执行请求之前登记，与closeIdleConns的检查互斥，
+// 连接不会在读到请求之后、登记之前被当作空闲连接关闭；开始关闭服务后新的请求返回503
+func (server *Server) startCall(c *conn) error {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if c.closing {
+		return errConnClosing
+	}
+	if server.shuttingDown() {
+		return errShuttingDown("rpc: server is shutting down")
+	}
+	c.wg.Add(1)
+	atomic.AddInt32(&c.inflight, 1)
+	return nil
+}
+
+func (server *Server) untrackConn(c *conn) {
+	server.mu.Lock()
+	delete(server.conns, c)
+	server.mu.Unlock()
+}
+
+func (server *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&server.inShutdown) != 0
+}
+
+// Shutdown gracefully shuts down the server: calls already in flight are
+// allowed to finish and their responses written, after which the idle
+// codecs are closed. Handlers that keep running after their 408 timeout
+// are waited for as well. New requests read in the meantime are answered with a
+// 503 IdShuttingDown error without being executed. If ctx expires first, every remaining connection is
+// force-closed and ctx.Err() is returned.
+func (server *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&server.inShutdown, 1)
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if server.closeIdleConns() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			server.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close immediately closes every connection, without waiting for the calls
+// in flight to finish.
+func (server *Server) Close() error {
+	atomic.StoreInt32(&server.inShutdown, 1)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for c := range server.conns {
+		c.codec.Close()
+	}
+	return nil
+}
+
+// closeIdleConns closes the codecs that have no call in flight and reports
+// whether the server has no connections left.
+func (server *Server) closeIdleConns() bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	quiescent := true
+	for c := range server.conns {
+		quiescent = false
+		if c.closing || !c.isIdle() {
+			continue
+		}
+		// 关闭后ServeCodec的读取会失败并退出，连接随之从conns中移除
+		c.closing = true
+		c.codec.Close()
+	}
+	return quiescent
 }
 
 func (server *Server) getRequest() *Request {
@@ -318,8 +667,21 @@ func (server *Server) freeResponse(resp *Response) {
 	server.respLock.Unlock()
 }
 
-func (server *Server) readRequest(codec ServerCodec) (service *service, mtype *methodType, req *Request, argv, replyv reflect.Value, keepReading bool, err error) {
+func (server *Server) readRequest(c *conn) (service *service, mtype *methodType, req *Request, argv, replyv reflect.Value, keepReading bool, err error) {
+	codec := c.codec
 	service, mtype, req, keepReading, err = server.readRequestHeader(codec)
+	if req != nil && c.dispatch(req) {
+		server.freeRequest(req)
+		return nil, nil, nil, argv, replyv, true, nil
+	}
+	if err == nil && mtype == nil {
+		// 健康检查，丢弃请求体
+		codec.ReadRequestBody(req, nil)
+		return
+	}
+	if err == nil {
+		err = checkStream(codec, req, mtype)
+	}
 	if err != nil {
 		if !keepReading {
 			return
@@ -329,23 +691,48 @@ func (server *Server) readRequest(codec ServerCodec) (service *service, mtype *m
 		return
 	}
 
-	// Decode the argument value.
-	argIsValue := false // if true, need to indirect before calling.
-	if mtype.ArgType.Kind() == reflect.Ptr {
-		argv = reflect.New(mtype.ArgType.Elem())
-	} else {
-		argv = reflect.New(mtype.ArgType)
-		argIsValue = true
-	}
+	argv, argIsValue := newArgv(mtype)
 	// argv guaranteed to be a pointer now.
 	if err = codec.ReadRequestBody(req, argv.Interface()); err != nil {
+		err = errInvalidParamsFrom(req.ServiceMethod, err)
 		return
 	}
 	if argIsValue {
 		argv = argv.Elem()
 	}
 
-	replyv = reflect.New(mtype.ReplyType.Elem())
+	if !mtype.stream {
+		replyv = newReplyv(mtype)
+	}
+	return
+}
+
+// checkStream 流式方法只能通过支持流的codec以StreamOpen打开，普通方法不能以流的方式调用
+func checkStream(sc ServerCodec, req *Request, mtype *methodType) error {
+	open := streamOp(req) == codec.StreamOpen
+	if !mtype.stream {
+		if open {
+			return errInvalidRequest("rpc: %s is not a stream method", req.ServiceMethod)
+		}
+		return nil
+	}
+	if _, ok := asStreamCodec(sc); !ok || !open {
+		return errInvalidRequest("rpc: %s is a stream method, call it with Stream", req.ServiceMethod)
+	}
+	return nil
+}
+
+// newArgv allocates the argument value. argv is always a pointer; argIsValue
+// reports whether it needs to be indirected before calling the method.
+func newArgv(mtype *methodType) (argv reflect.Value, argIsValue bool) {
+	if mtype.ArgType.Kind() == reflect.Ptr {
+		return reflect.New(mtype.ArgType.Elem()), false
+	}
+	return reflect.New(mtype.ArgType), true
+}
+
+func newReplyv(mtype *methodType) reflect.Value {
+	replyv := reflect.New(mtype.ReplyType.Elem())
 
 	switch mtype.ReplyType.Elem().Kind() {
 	case reflect.Map:
@@ -353,7 +740,7 @@ func (server *Server) readRequest(codec ServerCodec) (service *service, mtype *m
 	case reflect.Slice:
 		replyv.Elem().Set(reflect.MakeSlice(mtype.ReplyType.Elem(), 0, 0))
 	}
-	return
+	return replyv
 }
 
 func (server *Server) readRequestHeader(codec ServerCodec) (svc *service, mtype *methodType, req *Request, keepReading bool, err error) {
@@ -370,24 +757,38 @@ func (server *Server) readRequestHeader(codec ServerCodec) (svc *service, mtype
 	}
 	keepReading = true
 
-	dot := strings.LastIndex(req.ServiceMethod, ".")
+	// 健康检查没有对应的服务，由serveCodec直接响应
+	if isPing(req) {
+		return
+	}
+	svc, mtype, err = server.lookup(req.ServiceMethod)
+	return
+}
+
+func isPing(req *Request) bool {
+	return req.ServiceMethod == codec.PingMethod
+}
+
+// lookup finds the service and method for a "Service.Method" name.
+func (server *Server) lookup(serviceMethod string) (svc *service, mtype *methodType, err error) {
+	dot := strings.LastIndex(serviceMethod, ".")
 	if dot < 0 {
-		err = errors.New("rpc: service/method request ill-formed: " + req.ServiceMethod)
+		err = errInvalidRequest("rpc: service/method request ill-formed: %s", serviceMethod)
 		return
 	}
-	serviceName := req.ServiceMethod[:dot]
-	methodName := req.ServiceMethod[dot+1:]
+	serviceName := serviceMethod[:dot]
+	methodName := serviceMethod[dot+1:]
 
 	// Look up the request.
 	svci, ok := server.serviceMap.Load(serviceName)
 	if !ok {
-		err = errors.New("rpc: can't find service " + req.ServiceMethod)
+		err = errMethodNotFound("rpc: can't find service %s", serviceMethod)
 		return
 	}
 	svc = svci.(*service)
 	mtype = svc.method[methodName]
 	if mtype == nil {
-		err = errors.New("rpc: can't find method " + req.ServiceMethod)
+		err = errMethodNotFound("rpc: can't find method %s", serviceMethod)
 	}
 	return
 }
@@ -1,19 +1,39 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"go-micro/core/cert"
 	"go-micro/core/debug"
 	"net"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var dir = "core/rpc/server/"
 
+// HandshakeTimeout tls握手的超时时间
+var HandshakeTimeout = 10 * time.Second
+
 type RpcServer struct {
 	opts  serverOptions
-	count int
+	count int64
 	svr   *Server
+
+	mu  sync.Mutex // protects lis, address, certs
+	lis net.Listener
+	//listen创建的证书管理器，关闭监听时一起关闭
+	certs *cert.Manager
+
+	//注册到注册中心的地址
+	address  string
+	exit     chan struct{}
+	exitOnce sync.Once
+	//心跳协程退出后关闭，没有心跳时为空
+	heartbeatDone chan struct{}
 }
 
 func NewRpcServer(opt ...ServerOption) *RpcServer {
@@ -22,10 +42,22 @@ func NewRpcServer(opt ...ServerOption) *RpcServer {
 		o.apply(&opts)
 	}
 
-	return &RpcServer{
+	if opts.codecs == nil {
+		opts.codecs = DefaultCodecs
+	}
+	if opts.id == "" {
+		opts.id = newNodeId(opts.name)
+	}
+
+	s := &RpcServer{
 		opts: opts,
 		svr:  NewServer(opts),
+		exit: make(chan struct{}),
+	}
+	if opts.debug {
+		s.svr.RegisterName(DebugServiceName, &Debug{server: s.svr})
 	}
+	return s
 }
 
 // 注册服务
@@ -37,6 +69,21 @@ func (s *RpcServer) RegisterName(name string, rcvr interface{}) error {
 	return s.svr.RegisterName(name, rcvr)
 }
 
+// 调用服务方法，供gateway等不使用ServerCodec的调用方使用
+func (s *RpcServer) Call(ctx context.Context, req *Request, decode func(argv interface{}) error) (interface{}, error) {
+	return s.svr.Call(ctx, req, decode)
+}
+
+// 已注册的服务方法，格式为 Service.Method
+func (s *RpcServer) Methods() []string {
+	return s.svr.Methods()
+}
+
+// 是否为流式方法
+func (s *RpcServer) IsStream(serviceMethod string) bool {
+	return s.svr.IsStream(serviceMethod)
+}
+
 // 启动服务
 func (s *RpcServer) Run(addr ...string) (err error) {
 	defer func() {
@@ -52,26 +99,108 @@ func (s *RpcServer) Run(addr ...string) (err error) {
 		return
 	}
 
+	if err = s.trackListener(lis); err != nil {
+		return
+	}
+
+	if err = s.register(lis); err != nil {
+		s.closeListener()
+		return
+	}
+
+	var tempDelay time.Duration // how long to sleep on accept failure
 	for {
-		conn, err := lis.Accept()
+		conn, e := lis.Accept()
 
-		if err != nil {
-			continue
+		if e != nil {
+			if s.svr.shuttingDown() {
+				return ErrServerClosed
+			}
+			if ne, ok := e.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if max := 1 * time.Second; tempDelay > max {
+					tempDelay = max
+				}
+				debug.DD("rpc: accept error: %v; retrying in %v", e, tempDelay)
+				time.Sleep(tempDelay)
+				continue
+			}
+			return e
 		}
+		tempDelay = 0
 
-		s.count++
-		debug.PrintDirExePos(dir+"server.go", "连接数 %d", s.count)
+		count := atomic.AddInt64(&s.count, 1)
+		debug.PrintDirExePos(dir+"server.go", "连接数 %d", count)
 		go func(conn net.Conn) {
-			debug.PrintDirExePos(dir+"server.go", "连接数 %d, %s", s.count, "进入请求")
-			s.svr.ServeCodec(NewServerCodec(conn))
-			debug.PrintDirExePos(dir+"server.go", "连接数 %d, %s", s.count, "完成请求")
-			s.count--
+			debug.PrintDirExePos(dir+"server.go", "连接数 %d, %s", atomic.LoadInt64(&s.count), "进入请求")
+			s.serveConn(conn)
+			debug.PrintDirExePos(dir+"server.go", "连接数 %d, %s", atomic.AddInt64(&s.count, -1), "完成请求")
 		}(conn)
 	}
+}
+
+// serveConn tls连接先完成握手，客户端证书中的身份通过PeerFromContext提供给handler
+func (s *RpcServer) serveConn(conn net.Conn) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		tc.SetDeadline(time.Now().Add(HandshakeTimeout))
+		if err := tc.Handshake(); err != nil {
+			debug.DD("rpc: tls handshake error from %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
+		tc.SetDeadline(time.Time{})
+	}
+	ctx := newPeerContext(context.Background(), newPeer(conn))
+	s.svr.serveCodec(ctx, newNegotiateCodec(conn, s.opts.codecs))
+}
+
+// Shutdown 平滑关闭服务：停止接收新连接，等待正在处理的请求以及超时后继续执行的handler完成后关闭空闲连接；
+// ctx 到期后仍未完成的连接会被强制关闭
+func (s *RpcServer) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.svr.inShutdown, 1)
+	// 先从注册中心注销，避免客户端继续发送请求
+	s.deregister()
+	s.closeListener()
+	return s.svr.Shutdown(ctx)
+}
+
+// Stop 立即关闭服务以及所有连接，不等待正在处理的请求
+func (s *RpcServer) Stop() error {
+	atomic.StoreInt32(&s.svr.inShutdown, 1)
+	s.deregister()
+	err := s.closeListener()
+	s.svr.Close()
+	return err
+}
 
+func (s *RpcServer) trackListener(lis net.Listener) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.svr.shuttingDown() {
+		lis.Close()
+		return ErrServerClosed
+	}
+	s.lis = lis
 	return nil
 }
 
+func (s *RpcServer) closeListener() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.certs != nil {
+		s.certs.Close()
+		s.certs = nil
+	}
+	if s.lis == nil {
+		return nil
+	}
+	return s.lis.Close()
+}
+
 func resolveAddress(addr []string) string {
 	switch len(addr) {
 	case 0:
@@ -98,12 +227,33 @@ func (s *RpcServer) listen(address string) (lis net.Listener, err error) {
 	//开启认证
 	debug.DD("开启tls认证")
 	fmt.Println(s.opts.certFile)
-	cert, err := tls.LoadX509KeyPair(s.opts.certFile, s.opts.keyFile)
-
+	m, err := s.certManager()
 	if err != nil {
 		return
 	}
-	return tls.Listen("tcp", address, &tls.Config{
-		Certificates: []tls.Certificate{cert},
-	})
+	//证书与验证客户端证书的CA在文件变化时自动重新加载
+	lis, err = tls.Listen("tcp", address, m.ServerConfig(s.opts.clientAuth))
+	if err != nil && s.opts.certManager == nil {
+		m.Close()
+	}
+	return
+}
+
+func (s *RpcServer) certManager() (*cert.Manager, error) {
+	if s.opts.certManager != nil {
+		return s.opts.certManager, nil
+	}
+	m, err := cert.NewManager(
+		cert.WithName(s.opts.name),
+		cert.WithCertificate(s.opts.certFile, s.opts.keyFile),
+		cert.WithCA(s.opts.clientCAFile),
+		cert.WithLogger(s.opts.logger),
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.certs = m
+	s.mu.Unlock()
+	return m, nil
 }
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"net"
+	"testing"
+	"time"
+)
+
+type BlockArgs struct{}
+
+// BlockService 的Wait在收到release之前不会返回，entered在handler开始执行时收到通知
+type BlockService struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockService() *BlockService {
+	return &BlockService{entered: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (b *BlockService) Wait(ctx context.Context, args *BlockArgs, reply *string) error {
+	b.entered <- struct{}{}
+	select {
+	case <-b.release:
+		*reply = "done"
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run 在随机端口上启动服务，返回监听地址与Run的返回值
+func run(t *testing.T, s *RpcServer) (string, <-chan error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run(addr) }()
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return addr, done
+		}
+		if i == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newTestClient(addr string, opts ...client.DialOption) client.RpcClient {
+	opts = append([]client.DialOption{client.SetServer("block", &client.Server{Address: addr})}, opts...)
+	return client.NewClient(opts...)
+}
+
+func callWait(c client.RpcClient) <-chan error {
+	res := make(chan error, 1)
+	go func() {
+		var reply string
+		res <- c.Call(context.Background(), c.NewRequest("block", "BlockService.Wait", &BlockArgs{}), &reply, client.WithRequestTimeout(5*time.Second))
+	}()
+	return res
+}
+
+func TestShutdownWaitsForInFlightCalls(t *testing.T) {
+	b := newBlockService()
+	s := NewRpcServer()
+	if err := s.Register(b); err != nil {
+		t.Fatal(err)
+	}
+	addr, done := run(t, s)
+
+	res := callWait(newTestClient(addr))
+	<-b.entered
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v with a call in flight", err)
+	case <-time.After(2 * shutdownPollInterval):
+	}
+
+	close(b.release)
+	if err := <-res; err != nil {
+		t.Fatalf("in-flight call failed: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != ErrServerClosed {
+		t.Fatalf("Run returned %v, want ErrServerClosed", err)
+	}
+}
+
+func TestShutdownRejectsNewRequests(t *testing.T) {
+	b := newBlockService()
+	s := NewRpcServer()
+	if err := s.Register(b); err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := run(t, s)
+
+	// 多路复用时两次调用使用同一个连接
+	c := newTestClient(addr, client.SetMultiplex(true))
+	first := callWait(c)
+	<-b.entered
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	for !s.svr.shuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+
+	err := <-callWait(c)
+	if e := errors.FromError(err); e.Code != 503 || e.Id != IdShuttingDown {
+		t.Fatalf("got %v, want a 503 shutting down error", err)
+	}
+	select {
+	case <-b.entered:
+		t.Fatal("a request read after Shutdown was executed")
+	default:
+	}
+
+	close(b.release)
+	if err := <-first; err != nil {
+		t.Fatalf("in-flight call failed: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	b := newBlockService()
+	s := NewRpcServer()
+	if err := s.Register(b); err != nil {
+		t.Fatal(err)
+	}
+	addr, done := run(t, s)
+
+	res := callWait(newTestClient(addr))
+	<-b.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	// 强制关闭连接后调用失败
+	if err := <-res; err == nil {
+		t.Fatal("the call succeeded after its connection was force-closed")
+	}
+	if err := <-done; err != ErrServerClosed {
+		t.Fatalf("Run returned %v, want ErrServerClosed", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	b := newBlockService()
+	s := NewRpcServer()
+	if err := s.Register(b); err != nil {
+		t.Fatal(err)
+	}
+	addr, done := run(t, s)
+
+	res := callWait(newTestClient(addr))
+	<-b.entered
+
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-res; err == nil {
+		t.Fatal("the call succeeded after Stop")
+	}
+	if err := <-done; err != ErrServerClosed {
+		t.Fatalf("Run returned %v, want ErrServerClosed", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatal("the listener is still open after Stop")
+	}
+}
+
+func TestStartCallAfterIdleClose(t *testing.T) {
+	svr := NewServer(defaultServerOptions)
+	c := svr.trackConn(context.Background(), nopCodec{})
+
+	// closeIdleConns在请求读出之后、登记之前关闭连接，请求不再执行
+	svr.closeIdleConns()
+	if err := svr.startCall(c); err != errConnClosing {
+		t.Fatalf("got %v, want errConnClosing", err)
+	}
+
+	// 已经登记的请求使连接不再空闲
+	c = svr.trackConn(context.Background(), nopCodec{})
+	if err := svr.startCall(c); err != nil {
+		t.Fatal(err)
+	}
+	svr.closeIdleConns()
+	if c.closing {
+		t.Fatal("a connection with a call in flight was closed")
+	}
+}
+
+type nopCodec struct{}
+
+func (nopCodec) ReadRequestHeader(*Request) error            { return nil }
+func (nopCodec) ReadRequestBody(*Request, interface{}) error { return nil }
+func (nopCodec) WriteResponse(*Response, interface{}) error  { return nil }
+func (nopCodec) Close() error                                { return nil }
@@ -0,0 +1,307 @@
+package server
+
+import (
+	"context"
+	"go-micro/rpc/codec"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Stream 流式调用中handler收发消息的接口，流式handler的签名为
+//
+//	func (t *T) MethodName(ctx context.Context, args *T1, stream server.Stream) error
+//
+// handler返回后流结束，返回的错误会发送给客户端
+type Stream interface {
+	Context() context.Context
+	Request() *Request
+	// 向客户端发送消息
+	Send(msg interface{}) error
+	// 接收客户端的消息，客户端调用CloseSend后返回io.EOF
+	Recv(msg interface{}) error
+}
+
+var typeOfStream = reflect.TypeOf((*Stream)(nil)).Elem()
+
+// streamCodec 支持流式调用的ServerCodec，目前只有数据帧协议支持
+type streamCodec interface {
+	ServerCodec
+	// 当前请求的原始消息体，由Recv按handler传入的类型解析
+	rawBody() []byte
+	marshaler() codec.Marshaler
+	writeFrame(f *codec.Frame) error
+}
+
+func asStreamCodec(sc ServerCodec) (streamCodec, bool) {
+	if nc, ok := sc.(*negotiateCodec); ok {
+		sc = nc.current()
+	}
+	c, ok := sc.(streamCodec)
+	return c, ok
+}
+
+func streamOp(req *Request) string {
+	if req == nil || req.Header == nil {
+		return ""
+	}
+	return req.Header.Get(codec.StreamHeader)
+}
+
+type serverStream struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	req     *Request
+	codec   streamCodec
+	sending *sync.Mutex
+
+	mu     sync.Mutex // protects queue, eof, err
+	queue  [][]byte
+	eof    bool
+	notify chan struct{}
+	// queue的长度上限，0表示不限制
+	limit int
+	// 客户端没有遵守窗口，消息超过上限后流的错误
+	err error
+
+	// 向客户端发送消息的额度
+	window *codec.SendWindow
+	// 接收客户端消息的窗口，大小为limit
+	recv *codec.RecvWindow
+}
+
+func newServerStream(ctx context.Context, req *Request, sc streamCodec, sending *sync.Mutex, limit int) *serverStream {
+	// Request会被Server复用，流中保留一份副本
+	r := &Request{
+		Header:        req.Header,
+		ServiceMethod: req.ServiceMethod,
+		Seq:           req.Seq,
+	}
+	ctx, cancel := newContext(ctx, r)
+	// 客户端的接收窗口，没有设置时不限制
+	window := codec.NewSendWindow()
+	n, _ := strconv.Atoi(req.Header.Get(codec.StreamWindowHeader))
+	window.Grant(n)
+	return &serverStream{
+		ctx:     ctx,
+		cancel:  cancel,
+		req:     r,
+		codec:   sc,
+		sending: sending,
+		notify:  make(chan struct{}, 1),
+		limit:   limit,
+		window:  window,
+		recv:    codec.NewRecvWindow(limit),
+	}
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) Request() *Request {
+	return s.req
+}
+
+// Send 客户端的接收窗口已满时等待客户端接收
+func (s *serverStream) Send(msg interface{}) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if !s.window.Acquire(s.ctx.Done()) {
+		return s.ctx.Err()
+	}
+	body, err := s.codec.marshaler().Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.write(&codec.Frame{
+		Seq:           s.req.Seq,
+		ServiceMethod: s.req.ServiceMethod,
+		Header:        http.Header{codec.StreamHeader: {codec.StreamSend}},
+		Body:          body,
+	})
+}
+
+func (s *serverStream) Recv(msg interface{}) error {
+	for {
+		s.mu.Lock()
+		if s.err != nil {
+			s.mu.Unlock()
+			return s.err
+		}
+		if len(s.queue) > 0 {
+			b := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			if n := s.recv.Consume(); n > 0 {
+				s.grant(n)
+			}
+			return s.codec.marshaler().Unmarshal(b, msg)
+		}
+		eof := s.eof
+		s.mu.Unlock()
+		if eof {
+			return io.EOF
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+}
+
+// 超过上限时的错误，代替handler返回的错误发送给客户端
+func (s *serverStream) overflow() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// grant 通知客户端可以再发送n条消息，n为0表示不限制
+func (s *serverStream) grant(n int) error {
+	return s.write(&codec.Frame{
+		Seq:           s.req.Seq,
+		ServiceMethod: s.req.ServiceMethod,
+		Header: http.Header{
+			codec.StreamHeader:       {codec.StreamWindow},
+			codec.StreamWindowHeader: {strconv.Itoa(n)},
+		},
+	})
+}
+
+func (s *serverStream) write(f *codec.Frame) error {
+	s.sending.Lock()
+	defer s.sending.Unlock()
+	return s.codec.writeFrame(f)
+}
+
+// 读取协程收到客户端的消息，读取协程不能等待handler接收，否则会阻塞连接上的其他调用；
+// 客户端按窗口发送时消息不会超过上限，没有遵守窗口导致超过上限时取消流
+func (s *serverStream) push(op string, header http.Header, body []byte) {
+	switch op {
+	case codec.StreamCancel:
+		s.cancel()
+		return
+	case codec.StreamWindow:
+		n, _ := strconv.Atoi(header.Get(codec.StreamWindowHeader))
+		s.window.Grant(n)
+		return
+	case codec.StreamSend:
+		s.mu.Lock()
+		if s.err != nil {
+			s.mu.Unlock()
+			return
+		}
+		if s.limit > 0 && len(s.queue) >= s.limit {
+			s.err = errStreamOverflow("rpc: stream %s has more than %d unreceived messages", s.req.ServiceMethod, s.limit)
+			s.queue = nil
+			s.mu.Unlock()
+			s.cancel()
+			return
+		}
+		s.queue = append(s.queue, body)
+		s.mu.Unlock()
+	case codec.StreamClose:
+		s.mu.Lock()
+		s.eof = true
+		s.mu.Unlock()
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 将流的后续消息交给对应的stream，取消帧也可以取消普通调用，
+// 返回false表示不是流的后续消息
+func (c *conn) dispatch(req *Request) bool {
+	op := streamOp(req)
+	if op == "" || op == codec.StreamOpen {
+		return false
+	}
+
+	c.mu.Lock()
+	s, ok := c.streams[req.Seq]
+	cancel := c.calls[req.Seq]
+	c.mu.Unlock()
+	if !ok {
+		if op == codec.StreamCancel && cancel != nil {
+			cancel()
+		}
+		// 流或者调用已经结束
+		return true
+	}
+
+	var body []byte
+	if sc, ok := asStreamCodec(c.codec); ok && op == codec.StreamSend {
+		body = sc.rawBody()
+	}
+	s.push(op, req.Header, body)
+	return true
+}
+
+func (c *conn) addStream(s *serverStream) {
+	c.mu.Lock()
+	if c.streams == nil {
+		c.streams = make(map[uint64]*serverStream)
+	}
+	c.streams[s.req.Seq] = s
+	c.mu.Unlock()
+}
+
+func (c *conn) removeStream(s *serverStream) {
+	c.mu.Lock()
+	delete(c.streams, s.req.Seq)
+	c.mu.Unlock()
+}
+
+func (c *conn) addCall(seq uint64, cancel context.CancelFunc) {
+	c.mu.Lock()
+	if c.calls == nil {
+		c.calls = make(map[uint64]context.CancelFunc)
+	}
+	c.calls[seq] = cancel
+	c.mu.Unlock()
+}
+
+func (c *conn) removeCall(seq uint64) {
+	c.mu.Lock()
+	delete(c.calls, seq)
+	c.mu.Unlock()
+}
+
+// stream 执行流式handler，handler返回后发送结束帧
+func (s *service) stream(server *Server, st *serverStream, c *conn, mtype *methodType, argv reflect.Value) {
+	defer func() {
+		c.removeStream(st)
+		st.cancel()
+		atomic.AddInt32(&c.inflight, -1)
+		c.wg.Done()
+	}()
+
+	// 告知客户端服务端的接收窗口，客户端收到后才开始发送消息
+	st.grant(st.limit)
+
+	errs := ""
+	err := s.handle(server, c, st.ctx, mtype, st.req, argv, reflect.ValueOf(st))
+	if e := st.overflow(); e != nil {
+		err = e
+	}
+	if err != nil {
+		errs = err.Error()
+	}
+
+	st.write(&codec.Frame{
+		Seq:           st.req.Seq,
+		ServiceMethod: st.req.ServiceMethod,
+		Error:         errs,
+		Header:        http.Header{codec.StreamHeader: {codec.StreamEnd}},
+	})
+}
@@ -0,0 +1,310 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/codec"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type StreamArgs struct {
+	N int
+}
+
+// StreamService 的流式方法，done在Block与Hold结束时收到handler的ctx错误
+type StreamService struct {
+	entered chan struct{}
+	done    chan error
+}
+
+func newStreamService() *StreamService {
+	return &StreamService{entered: make(chan struct{}, 1), done: make(chan error, 1)}
+}
+
+func (s *StreamService) Count(ctx context.Context, args *StreamArgs, stream Stream) error {
+	for i := 0; i < args.N; i++ {
+		if err := stream.Send(i); err != nil {
+			s.done <- err
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StreamService) Echo(ctx context.Context, args *StreamArgs, stream Stream) error {
+	for {
+		var msg string
+		err := stream.Recv(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(msg + "!"); err != nil {
+			return err
+		}
+	}
+}
+
+// Block 不接收消息，直到流被取消
+func (s *StreamService) Block(ctx context.Context, args *StreamArgs, stream Stream) error {
+	s.entered <- struct{}{}
+	<-ctx.Done()
+	s.done <- ctx.Err()
+	return ctx.Err()
+}
+
+func runStream(t *testing.T, opts ...ServerOption) (*StreamService, string) {
+	svc := newStreamService()
+	s := NewRpcServer(opts...)
+	if err := s.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := run(t, s)
+	t.Cleanup(func() { s.Stop() })
+	return svc, addr
+}
+
+func openStream(t *testing.T, c client.RpcClient, ctx context.Context, method string, args *StreamArgs) client.Stream {
+	st, err := c.Stream(ctx, c.NewRequest("block", "StreamService."+method, args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func waitDone(t *testing.T, svc *StreamService) error {
+	select {
+	case err := <-svc.done:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("the handler was not cancelled")
+		return nil
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	_, addr := runStream(t)
+	c := newTestClient(addr)
+	defer c.Close()
+
+	st := openStream(t, c, context.Background(), "Count", &StreamArgs{N: 5})
+	for i := 0; ; i++ {
+		var n int
+		err := st.Recv(&n)
+		if err == io.EOF {
+			if i != 5 {
+				t.Fatalf("got %d messages, want 5", i)
+			}
+			break
+		}
+		if err != nil || n != i {
+			t.Fatalf("got %d %v, want %d", n, err, i)
+		}
+	}
+}
+
+func TestBidiStream(t *testing.T) {
+	_, addr := runStream(t)
+	c := newTestClient(addr)
+	defer c.Close()
+
+	st := openStream(t, c, context.Background(), "Echo", &StreamArgs{})
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := st.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+		var reply string
+		if err := st.Recv(&reply); err != nil || reply != msg+"!" {
+			t.Fatalf("got %q %v, want %q", reply, err, msg+"!")
+		}
+	}
+	if err := st.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	var reply string
+	if err := st.Recv(&reply); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	svc, addr := runStream(t)
+	c := newTestClient(addr)
+	defer c.Close()
+
+	// 客户端关闭流
+	st := openStream(t, c, context.Background(), "Block", &StreamArgs{})
+	<-svc.entered
+	st.Close()
+	if err := waitDone(t, svc); err != context.Canceled {
+		t.Fatalf("handler ctx: got %v, want context.Canceled", err)
+	}
+
+	// 客户端超时
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	st = openStream(t, c, ctx, "Block", &StreamArgs{})
+	<-svc.entered
+	var n int
+	if err := st.Recv(&n); errors.FromError(err).Code != 408 {
+		t.Fatalf("got %v, want a 408 timeout", err)
+	}
+	if err := waitDone(t, svc); err == nil {
+		t.Fatal("the handler ctx was not cancelled")
+	}
+}
+
+func TestServerStreamWindow(t *testing.T) {
+	svc, addr := runStream(t, WithStreamBuffer(4))
+	c := newTestClient(addr)
+	defer c.Close()
+
+	// handler不接收消息，用完窗口后客户端的Send等待，流不会被取消
+	st := openStream(t, c, context.Background(), "Block", &StreamArgs{})
+	<-svc.entered
+	for i := 0; i < 4; i++ {
+		if err := st.Send("x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sent := make(chan error, 1)
+	go func() { sent <- st.Send("x") }()
+	select {
+	case err := <-sent:
+		t.Fatalf("Send returned %v with a full window", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	st.Close()
+	select {
+	case err := <-sent:
+		if err == nil {
+			t.Fatal("Send succeeded after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Send was not released by Close")
+	}
+	if err := waitDone(t, svc); err != context.Canceled {
+		t.Fatalf("handler ctx: got %v, want context.Canceled", err)
+	}
+}
+
+func TestBidiStreamWindow(t *testing.T) {
+	_, addr := runStream(t, WithStreamBuffer(4))
+	c := newTestClient(addr, client.SetStreamBuffer(4))
+	defer c.Close()
+
+	// 两端的窗口都远小于消息数，发送方等待额度，所有消息都能送达
+	const n = 500
+	st := openStream(t, c, context.Background(), "Echo", &StreamArgs{})
+	go func() {
+		for i := 0; i < n; i++ {
+			if err := st.Send("x"); err != nil {
+				return
+			}
+		}
+		st.CloseSend()
+	}()
+	for i := 0; ; i++ {
+		var reply string
+		err := st.Recv(&reply)
+		if err == io.EOF {
+			if i != n {
+				t.Fatalf("got %d replies, want %d", i, n)
+			}
+			break
+		}
+		if err != nil || reply != "x!" {
+			t.Fatalf("reply %d: got %q %v", i, reply, err)
+		}
+	}
+}
+
+func TestClientStreamWindow(t *testing.T) {
+	_, addr := runStream(t)
+	c := newTestClient(addr, client.SetStreamBuffer(4))
+	defer c.Close()
+
+	// 客户端接收较慢，服务端的Send等待客户端归还额度，不会返回429
+	const n = 1000
+	st := openStream(t, c, context.Background(), "Count", &StreamArgs{N: n})
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; ; i++ {
+		var got int
+		err := st.Recv(&got)
+		if err == io.EOF {
+			if i != n {
+				t.Fatalf("got %d messages, want %d", i, n)
+			}
+			break
+		}
+		if err != nil || got != i {
+			t.Fatalf("got %d %v, want %d", got, err, i)
+		}
+	}
+}
+
+func TestStreamOverflowIgnoringWindow(t *testing.T) {
+	svc, addr := runStream(t, WithStreamBuffer(4))
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := codec.WritePreamble(conn, codec.ContentTypeJSONFrame); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := codec.Get(codec.ContentTypeJSONFrame)
+	body, _ := m.Marshal(&StreamArgs{})
+	open := &codec.Frame{
+		Seq:           1,
+		ServiceMethod: "StreamService.Block",
+		Header:        http.Header{codec.StreamHeader: {codec.StreamOpen}},
+		Body:          body,
+	}
+	if err := codec.WriteFrame(conn, open); err != nil {
+		t.Fatal(err)
+	}
+	<-svc.entered
+
+	// 不等待服务端的window帧直接发送，超过上限后流被取消
+	msg, _ := m.Marshal("x")
+	for i := 0; i < 5; i++ {
+		f := &codec.Frame{
+			Seq:           1,
+			ServiceMethod: "StreamService.Block",
+			Header:        http.Header{codec.StreamHeader: {codec.StreamSend}},
+			Body:          msg,
+		}
+		if err := codec.WriteFrame(conn, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := waitDone(t, svc); err != context.Canceled {
+		t.Fatalf("handler ctx: got %v, want context.Canceled", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	r := bufio.NewReader(conn)
+	for {
+		var f codec.Frame
+		if err := codec.ReadFrame(r, &f); err != nil {
+			t.Fatal(err)
+		}
+		if f.Header.Get(codec.StreamHeader) != codec.StreamEnd {
+			continue
+		}
+		if errors.Parse(f.Error).Id != IdStreamOverflow {
+			t.Fatalf("got %q, want a stream overflow error", f.Error)
+		}
+		break
+	}
+}
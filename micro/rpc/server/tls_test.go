@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"go-micro/internal/certtest"
+	"go-micro/rpc/client"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func serverCert() *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "node6_03"},
+		DNSNames:    []string{"node6_03"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+}
+
+func clientCert(cn string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		DNSNames:    []string{cn + ".internal"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+}
+
+// serveTLS 在随机端口上启动服务，返回监听地址
+func serveTLS(t *testing.T, s *RpcServer) string {
+	lis, err := s.listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveConn(conn)
+		}
+	}()
+	return lis.Addr().String()
+}
+
+type PeerArgs struct{}
+
+type PeerService struct{}
+
+func (PeerService) Whoami(ctx context.Context, args *PeerArgs, reply *string) error {
+	if p, ok := PeerFromContext(ctx); ok && p.Verified() {
+		*reply = p.CommonName + " " + p.DNSNames[0]
+	}
+	return nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := certtest.NewCA(t, "www.star-linear.com")
+	caFile := filepath.Join(dir, "ca.crt")
+	ca.WriteCert(t, caFile)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	ca.Issue(t, serverCert(), certFile, keyFile)
+	clientCertFile, clientKeyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	ca.Issue(t, clientCert("pay"), clientCertFile, clientKeyFile)
+
+	s := NewRpcServer(SetRSAKey(certFile, keyFile), WithClientCA(caFile), WithDebug(false))
+	if err := s.Register(PeerService{}); err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, s)
+
+	call := func(svr *client.Server) (string, error) {
+		c := client.NewClient(client.SetServer("peer", svr), client.Retries(1))
+		var reply string
+		err := c.Call(context.Background(), c.NewRequest("peer", "PeerService.Whoami", &PeerArgs{}), &reply)
+		return reply, err
+	}
+
+	reply, err := call(&client.Server{
+		CertFile:       caFile,
+		TlsServerName:  "node6_03",
+		ClientCertFile: clientCertFile,
+		ClientKeyFile:  clientKeyFile,
+		Address:        addr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "pay pay.internal" {
+		t.Fatalf("peer = %q, want the client certificate identity", reply)
+	}
+
+	// 没有客户端证书的连接被拒绝
+	if _, err := call(&client.Server{CertFile: caFile, TlsServerName: "node6_03", Address: addr}); err == nil {
+		t.Fatal("a client without a certificate was accepted")
+	}
+}
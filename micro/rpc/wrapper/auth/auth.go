@@ -0,0 +1,306 @@
+// Package auth rpc的认证与鉴权：服务端校验请求头中的JWT（HS256/RS256）或api key，
+// 将调用方的身份放入handler的context，并按配置的Service.Method规则检查角色与scope；
+// 客户端将context中的token附加到请求头
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"go-micro/config"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/server"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrorId 认证失败返回401，权限不足返回403
+const ErrorId = "go-micro/rpc/wrapper/auth"
+
+const (
+	// AuthorizationHeader 携带JWT，格式为 Bearer <token>
+	AuthorizationHeader = "Authorization"
+	// APIKeyHeader 携带api key
+	APIKeyHeader = "X-Api-Key"
+)
+
+// Principal 通过认证的调用方
+type Principal struct {
+	Subject string
+	Roles   []string
+	Scopes  []string
+	// JWT的全部claims，api key认证时为nil
+	Claims map[string]interface{}
+	// 调用方的JWT，下游调用时由NewCallWrapper继续传递，api key不会传递
+	Token string
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+type tokenKey struct{}
+
+// FromContext 获取handler的context中的调用方
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// NewTokenContext 设置之后的rpc调用使用的JWT
+func NewTokenContext(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenFromContext 优先使用NewTokenContext设置的token，其次是调用方的token
+func TokenFromContext(ctx context.Context) (string, bool) {
+	if token, ok := ctx.Value(tokenKey{}).(string); ok && token != "" {
+		return token, true
+	}
+	if p, ok := FromContext(ctx); ok && p.Token != "" {
+		return p.Token, true
+	}
+	return "", false
+}
+
+type apiKey struct {
+	subject string
+	roles   []string
+	scopes  []string
+}
+
+// Authenticator 按配置认证与鉴权，配置变化时通过Update更新
+type Authenticator struct {
+	mu      sync.RWMutex
+	jwt     *jwtVerifier
+	apiKeys map[[sha256.Size]byte]apiKey
+	// key为Service.Method、Service.*或*
+	rules map[string]config.AuthRule
+}
+
+func NewAuthenticator(cfg config.Auth) (*Authenticator, error) {
+	a := &Authenticator{}
+	if err := a.Update(cfg); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Update 替换认证配置，配置有误时保留原来的配置
+func (a *Authenticator) Update(cfg config.Auth) error {
+	var verifier *jwtVerifier
+	if cfg.JWT.Algorithm != "" {
+		v, err := newJWTVerifier(cfg.JWT)
+		if err != nil {
+			return err
+		}
+		verifier = v
+	}
+
+	// 只保存api key的摘要
+	keys := make(map[[sha256.Size]byte]apiKey, len(cfg.APIKeys))
+	for _, k := range cfg.APIKeys {
+		keys[sha256.Sum256([]byte(k.Key))] = apiKey{subject: k.Subject, roles: k.Roles, scopes: k.Scopes}
+	}
+
+	rules := make(map[string]config.AuthRule, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		m := r.Method
+		if m == "" {
+			m = "*"
+		}
+		rules[m] = r
+	}
+
+	a.mu.Lock()
+	a.jwt, a.apiKeys, a.rules = verifier, keys, rules
+	a.mu.Unlock()
+	return nil
+}
+
+// Authenticate 根据请求头认证调用方，没有凭证时返回nil
+func (a *Authenticator) Authenticate(h http.Header) (*Principal, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if auth := header(h, AuthorizationHeader); auth != "" {
+		const prefix = "Bearer "
+		if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+			return nil, errors.Unauthorized(ErrorId, "unsupported authorization scheme")
+		}
+		if a.jwt == nil {
+			return nil, errors.Unauthorized(ErrorId, "jwt authentication is not enabled")
+		}
+		token := strings.TrimSpace(auth[len(prefix):])
+		claims, err := a.jwt.verify(token)
+		if err != nil {
+			return nil, errors.Unauthorized(ErrorId, "invalid token: %v", err)
+		}
+		sub, _ := claims["sub"].(string)
+		scopes := stringsClaim(claims["scope"])
+		if scopes == nil {
+			scopes = stringsClaim(claims["scopes"])
+		}
+		return &Principal{
+			Subject: sub,
+			Roles:   stringsClaim(claims["roles"]),
+			Scopes:  scopes,
+			Claims:  claims,
+			Token:   token,
+		}, nil
+	}
+
+	if key := header(h, APIKeyHeader); key != "" {
+		k, ok := a.apiKeys[sha256.Sum256([]byte(key))]
+		if !ok {
+			return nil, errors.Unauthorized(ErrorId, "invalid api key")
+		}
+		return &Principal{Subject: k.subject, Roles: k.roles, Scopes: k.scopes}, nil
+	}
+	return nil, nil
+}
+
+// rule 依次匹配Service.Method、Service.*、*
+func (a *Authenticator) rule(serviceMethod string) (config.AuthRule, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if r, ok := a.rules[serviceMethod]; ok {
+		return r, true
+	}
+	if i := strings.LastIndex(serviceMethod, "."); i >= 0 {
+		if r, ok := a.rules[serviceMethod[:i]+".*"]; ok {
+			return r, true
+		}
+	}
+	r, ok := a.rules["*"]
+	return r, ok
+}
+
+// Check 认证并鉴权，返回的Principal在公开方法没有凭证时为nil
+func (a *Authenticator) Check(req *server.Request) (*Principal, error) {
+	rule, _ := a.rule(req.ServiceMethod)
+	p, err := a.Authenticate(req.Header)
+	if err != nil {
+		// 公开方法忽略无效的凭证
+		if rule.Public {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if rule.Public {
+		return p, nil
+	}
+	if p == nil {
+		return nil, errors.Unauthorized(ErrorId, "%s: missing credentials", req.ServiceMethod)
+	}
+	if len(rule.Roles) > 0 && !containsAny(p.Roles, rule.Roles) {
+		return nil, errors.Forbidden(ErrorId, "%s: requires one of roles %v", req.ServiceMethod, rule.Roles)
+	}
+	for _, scope := range rule.Scopes {
+		if !p.HasScope(scope) {
+			return nil, errors.Forbidden(ErrorId, "%s: missing scope %s", req.ServiceMethod, scope)
+		}
+	}
+	return p, nil
+}
+
+// NewHandlerWrapper 通过认证与鉴权的调用方放入handler的context，可以通过FromContext获取
+func NewHandlerWrapper(a *Authenticator) server.HandlerWrapper {
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+			p, err := a.Check(req)
+			if err != nil {
+				return err
+			}
+			if p != nil {
+				ctx = NewContext(ctx, p)
+			}
+			return h(ctx, req, argv, rsp)
+		}
+	}
+}
+
+type callOptions struct {
+	token  string
+	apiKey string
+}
+
+type CallOption func(o *callOptions)
+
+// WithToken context中没有token时使用的JWT
+func WithToken(token string) CallOption {
+	return func(o *callOptions) {
+		o.token = token
+	}
+}
+
+// WithAPIKey context中没有token时使用的api key
+func WithAPIKey(key string) CallOption {
+	return func(o *callOptions) {
+		o.apiKey = key
+	}
+}
+
+// NewCallWrapper 将context中的token附加到请求头，没有时使用WithToken或WithAPIKey设置的凭证
+func NewCallWrapper(opts ...CallOption) client.CallWrapper {
+	o := &callOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(call client.CallFunc) client.CallFunc {
+		return func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+			h := req.Header()
+			if token, ok := TokenFromContext(ctx); ok {
+				h.Set(AuthorizationHeader, "Bearer "+token)
+			} else if o.token != "" {
+				h.Set(AuthorizationHeader, "Bearer "+o.token)
+			} else if o.apiKey != "" {
+				h.Set(APIKeyHeader, o.apiKey)
+			}
+			return call(ctx, req, rsp, opts)
+		}
+	}
+}
+
+// header json请求中的header不一定是规范格式
+func header(h http.Header, key string) string {
+	if v := h.Get(key); v != "" {
+		return v
+	}
+	for k, vs := range h {
+		if strings.EqualFold(k, key) && len(vs) > 0 {
+			return vs[0]
+		}
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list, want []string) bool {
+	for _, w := range want {
+		if contains(list, w) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"go-micro/config"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/server"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const secret = "www.jinmin.com"
+
+// sign 生成测试用的JWT，key为HS256的密钥或RS256的私钥
+func sign(t *testing.T, alg string, key interface{}, claims map[string]interface{}) string {
+	seg := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := seg(map[string]string{"alg": alg, "typ": "JWT"}) + "." + seg(claims)
+
+	var sig []byte
+	switch alg {
+	case HS256:
+		mac := hmac.New(sha256.New, []byte(key.(string)))
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case RS256:
+		sum := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func bearer(token string) http.Header {
+	return http.Header{AuthorizationHeader: {"Bearer " + token}}
+}
+
+func code(err error) int32 {
+	if err == nil {
+		return 0
+	}
+	return errors.FromError(err).Code
+}
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	a, err := NewAuthenticator(config.Auth{
+		JWT: config.JWT{Algorithm: HS256, Secret: secret, Issuer: "shop"},
+		APIKeys: []config.APIKey{
+			{Key: "sms-key", Subject: "sms", Roles: []string{"service"}},
+		},
+		Rules: []config.AuthRule{
+			{Method: "Debug.*", Public: true},
+			{Method: "Pay.*", Roles: []string{"admin", "service"}},
+			{Method: "Pay.Refund", Roles: []string{"admin"}, Scopes: []string{"pay:write"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestCheck(t *testing.T) {
+	a := newTestAuthenticator(t)
+	exp := time.Now().Add(time.Hour).Unix()
+	admin := sign(t, HS256, secret, map[string]interface{}{"sub": "jinmin", "iss": "shop", "exp": exp, "roles": []string{"admin"}, "scope": "pay:read pay:write"})
+	user := sign(t, HS256, secret, map[string]interface{}{"sub": "user", "iss": "shop", "exp": exp, "roles": []string{"user"}})
+
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		code   int32
+	}{
+		{"public", "Debug.Services", http.Header{}, 0},
+		{"missing credentials", "Sms.Send", http.Header{}, 401},
+		{"authenticated", "Sms.Send", bearer(user), 0},
+		{"api key", "Pay.Create", http.Header{APIKeyHeader: {"sms-key"}}, 0},
+		{"invalid api key", "Pay.Create", http.Header{APIKeyHeader: {"wrong"}}, 401},
+		{"missing role", "Pay.Create", bearer(user), 403},
+		{"role and scope", "Pay.Refund", bearer(admin), 0},
+		{"missing scope", "Pay.Refund", http.Header{APIKeyHeader: {"sms-key"}}, 403},
+		{"wrong secret", "Sms.Send", bearer(sign(t, HS256, "other", map[string]interface{}{"iss": "shop"})), 401},
+		{"expired", "Sms.Send", bearer(sign(t, HS256, secret, map[string]interface{}{"iss": "shop", "exp": time.Now().Add(-time.Minute).Unix()})), 401},
+		{"wrong issuer", "Sms.Send", bearer(sign(t, HS256, secret, map[string]interface{}{"iss": "other"})), 401},
+		{"alg none", "Sms.Send", bearer(sign(t, "none", nil, map[string]interface{}{"iss": "shop"})), 401},
+		{"lower case header", "Sms.Send", http.Header{"authorization": {"bearer " + user}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Check(&server.Request{ServiceMethod: tt.method, Header: tt.header})
+			if code(err) != tt.code {
+				t.Fatalf("got %v, want code %d", err, tt.code)
+			}
+			if err != nil && errors.FromError(err).Id != ErrorId {
+				t.Fatalf("id = %s", errors.FromError(err).Id)
+			}
+		})
+	}
+}
+
+func TestRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "jwt.pub")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewAuthenticator(config.Auth{JWT: config.JWT{Algorithm: RS256, PublicKeyFile: keyFile, Audience: "pay"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := sign(t, RS256, key, map[string]interface{}{"sub": "jinmin", "aud": []string{"sms", "pay"}})
+	p, err := a.Authenticate(bearer(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Subject != "jinmin" || p.Token != token {
+		t.Fatalf("principal = %+v", p)
+	}
+
+	// 使用公钥作为HS256的密钥伪造的token
+	forged := sign(t, HS256, string(der), map[string]interface{}{"sub": "jinmin", "aud": "pay"})
+	if _, err := a.Authenticate(bearer(forged)); code(err) != 401 {
+		t.Fatalf("forged token got %v", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	a := newTestAuthenticator(t)
+	req := &server.Request{ServiceMethod: "Pay.Create", Header: http.Header{APIKeyHeader: {"sms-key"}}}
+	if _, err := a.Check(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// 配置有误时保留原来的配置
+	if err := a.Update(config.Auth{JWT: config.JWT{Algorithm: "HS512"}}); err == nil {
+		t.Fatal("update with an unsupported algorithm should fail")
+	}
+	if _, err := a.Check(req); err != nil {
+		t.Fatalf("a failed update changed the config: %v", err)
+	}
+
+	if err := a.Update(config.Auth{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Check(req); code(err) != 401 {
+		t.Fatalf("got %v after removing the api key", err)
+	}
+}
+
+func TestWrappers(t *testing.T) {
+	a := newTestAuthenticator(t)
+	token := sign(t, HS256, secret, map[string]interface{}{"sub": "jinmin", "iss": "shop", "roles": []string{"admin"}})
+
+	// 服务端将调用方放入context，客户端继续传递调用方的token
+	var forwarded http.Header
+	call := NewCallWrapper(WithAPIKey("sms-key"))(func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+		forwarded = req.Header()
+		return nil
+	})
+	h := NewHandlerWrapper(a)(func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+		p, ok := FromContext(ctx)
+		if !ok || p.Subject != "jinmin" {
+			t.Fatalf("principal = %+v", p)
+		}
+		c := client.NewClient()
+		return call(ctx, c.NewRequest("sms", "Sms.Send", nil), nil, client.CallOptions{})
+	})
+
+	if err := h(context.Background(), &server.Request{ServiceMethod: "Pay.Create", Header: bearer(token)}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if forwarded.Get(AuthorizationHeader) != "Bearer "+token {
+		t.Fatalf("forwarded header = %v", forwarded)
+	}
+
+	// context中没有token时使用api key
+	c := client.NewClient()
+	if err := call(context.Background(), c.NewRequest("sms", "Sms.Send", nil), nil, client.CallOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if forwarded.Get(APIKeyHeader) != "sms-key" || forwarded.Get(AuthorizationHeader) != "" {
+		t.Fatalf("header = %v", forwarded)
+	}
+}
+
+func TestDebugServiceRules(t *testing.T) {
+	a, err := NewAuthenticator(config.Auth{
+		JWT:   config.JWT{Algorithm: HS256, Secret: secret, Issuer: "shop"},
+		Rules: []config.AuthRule{{Method: "Debug.*", Roles: []string{"ops"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 默认注册的Debug服务同样经过认证与鉴权
+	s := server.NewRpcServer(server.WithHandlerWrap(NewHandlerWrapper(a)))
+	exp := time.Now().Add(time.Hour).Unix()
+	ops := sign(t, HS256, secret, map[string]interface{}{"sub": "ops", "iss": "shop", "exp": exp, "roles": []string{"ops"}})
+	user := sign(t, HS256, secret, map[string]interface{}{"sub": "user", "iss": "shop", "exp": exp, "roles": []string{"user"}})
+
+	for _, tt := range []struct {
+		header http.Header
+		code   int32
+	}{
+		{http.Header{}, 401},
+		{bearer(user), 403},
+		{bearer(ops), 0},
+	} {
+		req := &server.Request{ServiceMethod: server.DebugServiceName + ".Services", Header: tt.header}
+		_, err := s.Call(context.Background(), req, func(argv interface{}) error { return nil })
+		if code(err) != tt.code {
+			t.Fatalf("%v: got %v, want code %d", tt.header, err, tt.code)
+		}
+	}
+}
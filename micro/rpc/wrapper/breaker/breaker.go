@@ -0,0 +1,253 @@
+// Package breaker 将core/breaker的熔断器接入rpc调用，客户端按方法或节点熔断，
+// 服务端按方法熔断以保护handler依赖的下游服务
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"go-micro/core/breaker"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/registry"
+	"go-micro/rpc/server"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// OpenErrorId 熔断器拒绝请求时返回的错误的Id，错误码为503，client.NotSent据此判断请求没有发出
+const OpenErrorId = client.IdBreakerOpen
+
+// IsOpen 判断错误是否为熔断器拒绝请求
+func IsOpen(err error) bool {
+	if err == nil {
+		return false
+	}
+	e := errors.FromError(err)
+	return e.Code == 503 && e.Id == OpenErrorId
+}
+
+// CallFallback 客户端的降级方法，err为熔断器返回的503错误，返回nil时rsp作为调用结果
+type CallFallback func(ctx context.Context, req client.Request, rsp interface{}, err error) error
+
+// HandlerFallback 服务端的降级方法
+type HandlerFallback func(ctx context.Context, req *server.Request, rsp interface{}, err error) error
+
+type options struct {
+	logger      *zap.Logger
+	breakerOpts []breaker.Option
+	acceptable  breaker.Acceptable
+	// key为Service.Method
+	callFallbacks    map[string]CallFallback
+	handlerFallbacks map[string]HandlerFallback
+}
+
+type Option func(o *options)
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		logger:           zap.L(),
+		acceptable:       Acceptable,
+		callFallbacks:    make(map[string]CallFallback),
+		handlerFallbacks: make(map[string]HandlerFallback),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// 熔断器状态变化的日志，默认使用zap的全局logger
+func WithLogger(logger *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// 创建熔断器的参数，如breaker.WithTimeout
+func WithBreakerOptions(opts ...breaker.Option) Option {
+	return func(o *options) {
+		o.breakerOpts = append(o.breakerOpts, opts...)
+	}
+}
+
+// 判断错误是否计入失败，默认为Acceptable
+func WithAcceptable(acceptable breaker.Acceptable) Option {
+	return func(o *options) {
+		o.acceptable = acceptable
+	}
+}
+
+// 客户端方法的降级，method格式为Service.Method
+func WithCallFallback(method string, fn CallFallback) Option {
+	return func(o *options) {
+		o.callFallbacks[method] = fn
+	}
+}
+
+// 服务端方法的降级，method格式为Service.Method
+func WithHandlerFallback(method string, fn HandlerFallback) Option {
+	return func(o *options) {
+		o.handlerFallbacks[method] = fn
+	}
+}
+
+// Acceptable 请求参数错误等4xx错误说明服务正常，不计入失败；
+// 408说明下游响应慢，仍然计入失败
+func Acceptable(err error) bool {
+	if err == nil {
+		return true
+	}
+	code := errors.FromError(err).Code
+	return code >= 400 && code < 500 && code != 408
+}
+
+// group 按名称创建并复用熔断器
+type group struct {
+	opts     *options
+	mu       sync.Mutex
+	breakers map[string]breaker.Breaker
+}
+
+var (
+	groupsLock sync.Mutex
+	groups     []*group
+)
+
+func newGroup(opts *options) *group {
+	g := &group{
+		opts:     opts,
+		breakers: make(map[string]breaker.Breaker),
+	}
+	groupsLock.Lock()
+	groups = append(groups, g)
+	groupsLock.Unlock()
+	return g
+}
+
+// Range 遍历所有wrapper创建的熔断器，用于导出熔断器的状态
+func Range(fn func(b breaker.Breaker) bool) {
+	groupsLock.Lock()
+	gs := groups
+	groupsLock.Unlock()
+
+	for _, g := range gs {
+		g.mu.Lock()
+		bs := make([]breaker.Breaker, 0, len(g.breakers))
+		for _, b := range g.breakers {
+			bs = append(bs, b)
+		}
+		g.mu.Unlock()
+
+		for _, b := range bs {
+			if !fn(b) {
+				return
+			}
+		}
+	}
+}
+
+func (g *group) get(name string) breaker.Breaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if b, ok := g.breakers[name]; ok {
+		return b
+	}
+
+	opts := append([]breaker.Option{}, g.opts.breakerOpts...)
+	opts = append(opts, breaker.WithName(name), breaker.WithOnStateChange(g.onStateChange))
+	b := breaker.NewBreaker(opts...)
+	g.breakers[name] = b
+	return b
+}
+
+func (g *group) onStateChange(name string, from, to breaker.State) {
+	log := g.opts.logger.Info
+	if to == breaker.StateOpen {
+		log = g.opts.logger.Warn
+	}
+	log("circuit breaker state changed",
+		zap.String("breaker", name),
+		zap.String("from", from.String()),
+		zap.String("to", to.String()),
+	)
+}
+
+// do 执行请求，熔断器拒绝时返回503或者执行降级方法
+func (g *group) do(name string, req func() error, fallback func(err error) error) error {
+	err := g.get(name).DoWithAcceptable(req, g.opts.acceptable)
+	if err != breaker.ErrOpenState && err != breaker.ErrTooManyRequest {
+		return err
+	}
+
+	err = errors.ServiceUnavailable(OpenErrorId, "circuit breaker %s is %s", name, stateOf(err))
+	if fallback != nil {
+		return fallback(err)
+	}
+	return err
+}
+
+func stateOf(err error) breaker.State {
+	if err == breaker.ErrTooManyRequest {
+		return breaker.StateHalfOpen
+	}
+	return breaker.StateOpen
+}
+
+// NewCallWrapper 客户端按服务的方法熔断，熔断器的名称为服务名.Service.Method
+func NewCallWrapper(opts ...Option) client.CallWrapper {
+	g := newGroup(newOptions(opts...))
+
+	return func(call client.CallFunc) client.CallFunc {
+		return func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+			name := fmt.Sprintf("%s.%s", req.Service(), req.Method())
+			return g.do(name, func() error {
+				return call(ctx, req, rsp, opts)
+			}, callFallback(g.opts, ctx, req, rsp))
+		}
+	}
+}
+
+// NewNodeWrapper 客户端按节点熔断，熔断器的名称为服务名@节点地址，
+// 节点熔断时请求没有发出，非幂等的方法也会重试，重试时优先选择其他节点
+func NewNodeWrapper(opts ...Option) client.NodeWrapper {
+	g := newGroup(newOptions(opts...))
+
+	return func(call client.NodeCallFunc) client.NodeCallFunc {
+		return func(ctx context.Context, node *registry.Node, req client.Request, rsp interface{}, opts client.CallOptions) error {
+			name := fmt.Sprintf("%s@%s", req.Service(), node.Address)
+			return g.do(name, func() error {
+				return call(ctx, node, req, rsp, opts)
+			}, callFallback(g.opts, ctx, req, rsp))
+		}
+	}
+}
+
+func callFallback(o *options, ctx context.Context, req client.Request, rsp interface{}) func(err error) error {
+	fn, ok := o.callFallbacks[req.Method()]
+	if !ok {
+		return nil
+	}
+	return func(err error) error {
+		return fn(ctx, req, rsp, err)
+	}
+}
+
+// NewHandlerWrapper 服务端按方法熔断，handler依赖的下游服务异常时快速失败
+func NewHandlerWrapper(opts ...Option) server.HandlerWrapper {
+	g := newGroup(newOptions(opts...))
+
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+			var fallback func(err error) error
+			if fn, ok := g.opts.handlerFallbacks[req.ServiceMethod]; ok {
+				fallback = func(err error) error {
+					return fn(ctx, req, rsp, err)
+				}
+			}
+			return g.do(req.ServiceMethod, func() error {
+				return h(ctx, req, argv, rsp)
+			}, fallback)
+		}
+	}
+}
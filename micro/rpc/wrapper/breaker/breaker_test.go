@@ -0,0 +1,214 @@
+package breaker
+
+import (
+	"context"
+	"go-micro/core/breaker"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/registry"
+	"go-micro/rpc/selector"
+	"go-micro/rpc/server"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func callWith(w client.CallWrapper, method string, err error) error {
+	call := w(func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+		return err
+	})
+	return call(context.Background(), client.NewRequest("pay", method, nil), nil, client.CallOptions{})
+}
+
+func TestCallWrapperTrips(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	w := NewCallWrapper(WithLogger(zap.New(core)), WithBreakerOptions(breaker.WithTimeout(time.Minute)))
+	failure := errors.InternalServerError("test", "down")
+
+	// 4xx说明请求有误，不触发熔断
+	for i := 0; i < 10; i++ {
+		if err := callWith(w, "Pay.Query", errors.BadRequest("test", "bad")); IsOpen(err) {
+			t.Fatalf("call %d: breaker opened on client errors", i)
+		}
+	}
+
+	for i := 0; i < 6; i++ {
+		if err := callWith(w, "Pay.Create", failure); err != failure {
+			t.Fatalf("call %d: got %v, want %v", i, err, failure)
+		}
+	}
+	err := callWith(w, "Pay.Create", nil)
+	if !IsOpen(err) {
+		t.Fatalf("got %v, want the breaker to be open", err)
+	}
+	if e := errors.FromError(err); e.Code != 503 {
+		t.Fatalf("got code %d, want 503", e.Code)
+	}
+
+	// 每个方法使用独立的熔断器
+	if err := callWith(w, "Pay.Query", nil); err != nil {
+		t.Fatalf("other method got %v", err)
+	}
+
+	entries := logs.FilterMessage("circuit breaker state changed").All()
+	if len(entries) != 1 || entries[0].Level != zapcore.WarnLevel {
+		t.Fatalf("state change logs = %v", entries)
+	}
+	fields := entries[0].ContextMap()
+	if fields["breaker"] != "pay.Pay.Create" || fields["from"] != "closed" || fields["to"] != "open" {
+		t.Fatalf("unexpected log fields %v", fields)
+	}
+}
+
+func TestCallWrapperFallback(t *testing.T) {
+	w := NewCallWrapper(
+		WithLogger(zap.NewNop()),
+		WithCallFallback("Pay.Create", func(ctx context.Context, req client.Request, rsp interface{}, err error) error {
+			if !IsOpen(err) {
+				t.Errorf("fallback got %v", err)
+			}
+			*rsp.(*string) = "fallback"
+			return nil
+		}),
+	)
+
+	call := w(func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+		return errors.Timeout("test", "slow")
+	})
+	req := client.NewRequest("pay", "Pay.Create", nil)
+	for i := 0; i < 6; i++ {
+		var rsp string
+		if err := call(context.Background(), req, &rsp, client.CallOptions{}); err == nil {
+			t.Fatalf("call %d: timeouts should fail", i)
+		}
+	}
+
+	var rsp string
+	if err := call(context.Background(), req, &rsp, client.CallOptions{}); err != nil || rsp != "fallback" {
+		t.Fatalf("got %q, %v, want the fallback", rsp, err)
+	}
+}
+
+func TestNodeWrapper(t *testing.T) {
+	w := NewNodeWrapper(WithLogger(zap.NewNop()))
+	call := w(func(ctx context.Context, node *registry.Node, req client.Request, rsp interface{}, opts client.CallOptions) error {
+		if node.Address == "bad:1" {
+			return errors.InternalServerError("test", "down")
+		}
+		return nil
+	})
+
+	req := client.NewRequest("pay", "Pay.Create", nil)
+	bad, good := &registry.Node{Address: "bad:1"}, &registry.Node{Address: "good:1"}
+	for i := 0; i < 6; i++ {
+		call(context.Background(), bad, req, nil, client.CallOptions{})
+	}
+	if err := call(context.Background(), bad, req, nil, client.CallOptions{}); !IsOpen(err) {
+		t.Fatalf("got %v, want the node breaker to be open", err)
+	}
+	// 熔断的503可以重试，重试时会选择其他节点
+	if err := call(context.Background(), bad, req, nil, client.CallOptions{}); !client.Retryable(err) {
+		t.Fatalf("open breaker error %v is not retryable", err)
+	}
+	if err := call(context.Background(), good, req, nil, client.CallOptions{}); err != nil {
+		t.Fatalf("healthy node got %v", err)
+	}
+}
+
+func TestNodeBreakerRetriesOtherNode(t *testing.T) {
+	w := NewNodeWrapper(WithLogger(zap.NewNop()))
+	// selected记录选中的节点，sent记录熔断器放行后实际发送的节点
+	var selected, sent []string
+	sel := func(call client.NodeCallFunc) client.NodeCallFunc {
+		return func(ctx context.Context, node *registry.Node, req client.Request, rsp interface{}, opts client.CallOptions) error {
+			selected = append(selected, node.Address)
+			return call(ctx, node, req, rsp, opts)
+		}
+	}
+	send := func(client.NodeCallFunc) client.NodeCallFunc {
+		return func(ctx context.Context, node *registry.Node, req client.Request, rsp interface{}, opts client.CallOptions) error {
+			sent = append(sent, node.Address)
+			if node.Address == "bad:1" {
+				return errors.InternalServerError("test", "down")
+			}
+			return nil
+		}
+	}
+
+	c := client.NewClient(client.SetRetryPolicy(client.RetryPolicy{MaxAttempts: 2}), client.SetSelector(selector.NewRoundRobin()))
+	req := c.NewRequest("pay", "Pay.Create", nil)
+	for i := 0; i < 6; i++ {
+		c.Call(context.Background(), req, nil, client.WithAddress("bad:1"), client.WrapNode(sel, w, send))
+	}
+
+	// Pay.Create不是幂等的方法，熔断的节点没有发出请求，重试另一个节点
+	selected, sent = nil, nil
+	for i := 0; i < 4; i++ {
+		if err := c.Call(context.Background(), req, nil, client.WithAddress("bad:1", "good:1"), client.WrapNode(sel, w, send)); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if !contains(selected, "bad:1") {
+		t.Fatalf("selected %v, want the open node to be tried", selected)
+	}
+	if contains(sent, "bad:1") || len(sent) != 4 {
+		t.Fatalf("sent to %v, want only good:1", sent)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHandlerWrapper(t *testing.T) {
+	fallback := false
+	w := NewHandlerWrapper(
+		WithLogger(zap.NewNop()),
+		WithHandlerFallback("Sms.Send", func(ctx context.Context, req *server.Request, rsp interface{}, err error) error {
+			fallback = true
+			return err
+		}),
+	)
+	h := w(func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+		return errors.InternalServerError("test", "downstream down")
+	})
+
+	for _, method := range []string{"Sms.Send", "Sms.Query"} {
+		req := &server.Request{ServiceMethod: method}
+		for i := 0; i < 6; i++ {
+			h(context.Background(), req, nil, nil)
+		}
+		if err := h(context.Background(), req, nil, nil); !IsOpen(err) {
+			t.Fatalf("%s: got %v, want the breaker to be open", method, err)
+		}
+	}
+	if !fallback {
+		t.Fatal("handler fallback was not called")
+	}
+}
+
+func TestAcceptable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, true},
+		{errors.BadRequest("test", "bad"), true},
+		{errors.NotFound("test", "missing"), true},
+		{errors.Timeout("test", "slow"), false},
+		{errors.InternalServerError("test", "down"), false},
+	}
+	for _, tt := range tests {
+		if got := Acceptable(tt.err); got != tt.want {
+			t.Errorf("Acceptable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Package bulkhead 将core/bulkhead的舱壁接入rpc调用，舱壁的参数通过bulkhead.Opt按名称设置，
+// 客户端的名称为服务名.Service.Method，服务端为Service.Method
+package bulkhead
+
+import (
+	"context"
+	"fmt"
+	"go-micro/core/bulkhead"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/server"
+)
+
+// FullErrorId 舱壁已满时返回的错误的Id，client.NotSent据此判断handler没有执行
+const FullErrorId = client.IdBulkheadFull
+
+// NewCallWrapper 限制客户端对每个方法的并发调用，舱壁已满时返回429，
+// 说明是本地的限制，重试也不会成功
+func NewCallWrapper() client.CallWrapper {
+	return func(call client.CallFunc) client.CallFunc {
+		return func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+			name := fmt.Sprintf("%s.%s", req.Service(), req.Method())
+			release, err := bulkhead.GetBulkhead(name).Acquire(ctx)
+			if err != nil {
+				return reject(name, err, errors.TooManyRequests)
+			}
+			defer release()
+			return call(ctx, req, rsp, opts)
+		}
+	}
+}
+
+// NewHandlerWrapper 限制服务端每个方法同时执行的handler数，舱壁已满时返回503，
+// handler没有执行，客户端对非幂等的方法也会重试其他节点
+func NewHandlerWrapper() server.HandlerWrapper {
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+			release, err := bulkhead.GetBulkhead(req.ServiceMethod).Acquire(ctx)
+			if err != nil {
+				return reject(req.ServiceMethod, err, errors.ServiceUnavailable)
+			}
+			defer release()
+			return h(ctx, req, argv, rsp)
+		}
+	}
+}
+
+func reject(name string, err error, full func(id, format string, a ...interface{}) error) error {
+	switch err {
+	case bulkhead.ErrFull, bulkhead.ErrQueueTimeout:
+		return full(FullErrorId, "bulkhead %s: %v", name, err)
+	}
+	return errors.Timeout(FullErrorId, "bulkhead %s: %v", name, err)
+}
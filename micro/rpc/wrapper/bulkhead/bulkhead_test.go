@@ -0,0 +1,76 @@
+package bulkhead
+
+import (
+	"context"
+	"go-micro/core/bulkhead"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/server"
+	"testing"
+)
+
+func TestCallWrapper(t *testing.T) {
+	bulkhead.Opt("pay.Pay.Create", bulkhead.WithMaxConcurrent(1))
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	call := NewCallWrapper()(func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+		close(entered)
+		<-release
+		return nil
+	})
+	req := client.NewRequest("pay", "Pay.Create", nil)
+
+	done := make(chan error)
+	go func() {
+		done <- call(context.Background(), req, nil, client.CallOptions{})
+	}()
+	<-entered
+
+	err := call(context.Background(), req, nil, client.CallOptions{})
+	if e := errors.FromError(err); e.Code != 429 || e.Id != FullErrorId {
+		t.Fatalf("got %v, want a 429 from the bulkhead", err)
+	}
+	if client.Retryable(err) {
+		t.Fatal("a full local bulkhead should not be retried")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlerWrapper(t *testing.T) {
+	bulkhead.Opt("Sms.Send", bulkhead.WithMaxConcurrent(1))
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	h := NewHandlerWrapper()(func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+		close(entered)
+		<-release
+		return nil
+	})
+	req := &server.Request{ServiceMethod: "Sms.Send"}
+
+	done := make(chan error)
+	go func() {
+		done <- h(context.Background(), req, nil, nil)
+	}()
+	<-entered
+
+	err := h(context.Background(), req, nil, nil)
+	if e := errors.FromError(err); e.Code != 503 || e.Id != FullErrorId {
+		t.Fatalf("got %v, want a 503 from the bulkhead", err)
+	}
+	// handler没有执行，客户端对非幂等的方法也可以重试其他节点
+	if !client.NotSent(err) {
+		t.Fatalf("%v is not treated as not sent", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if s := bulkhead.GetBulkhead("Sms.Send").Stats(); s.Active != 0 {
+		t.Fatalf("permit not released: %+v", s)
+	}
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"go-micro/core/router"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultPath Router注册的路径
+const DefaultPath = "/metrics"
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler 以Prometheus文本格式输出指标的http.Handler
+func Handler(opts ...Option) http.Handler {
+	r := newOptions(opts...).registry
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		r.WriteTo(w)
+	})
+}
+
+// Router 在core/router的gin引擎上注册GET /metrics，
+// 使用router.Register(metrics.Router())接入
+func Router(opts ...Option) router.Router {
+	h := gin.WrapH(Handler(opts...))
+	return func(g *gin.Engine) {
+		g.GET(DefaultPath, h)
+	}
+}
@@ -0,0 +1,173 @@
+// Package metrics 统计rpc客户端与服务端的请求数、按core/errors错误码区分的错误数、
+// 按Service.Method区分的耗时分布与正在处理的请求数，连同连接池、熔断器、舱壁与证书的状态
+// 以Prometheus的文本格式通过/metrics导出
+package metrics
+
+import (
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets 耗时分布的默认区间，单位为秒
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultRegistry 没有指定WithRegistry时wrapper与/metrics使用的Registry
+var DefaultRegistry = NewRegistry(nil)
+
+// series 一个方法的统计
+type series struct {
+	requests uint64 // atomic
+	inFlight int64  // atomic
+
+	mu     sync.Mutex
+	errors map[int32]uint64
+	counts []uint64 // 每个区间的请求数，最后一个为+Inf
+	sum    float64
+}
+
+func newSeries(buckets []float64) *series {
+	return &series{
+		errors: make(map[int32]uint64),
+		counts: make([]uint64, len(buckets)+1),
+	}
+}
+
+func (s *series) begin() {
+	atomic.AddUint64(&s.requests, 1)
+	atomic.AddInt64(&s.inFlight, 1)
+}
+
+func (s *series) end(buckets []float64, d time.Duration, err error) {
+	atomic.AddInt64(&s.inFlight, -1)
+
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(buckets, seconds)
+	s.mu.Lock()
+	s.counts[i]++
+	s.sum += seconds
+	if err != nil {
+		s.errors[errors.FromError(err).Code]++
+	}
+	s.mu.Unlock()
+}
+
+// snapshot 导出时的一致性快照
+type snapshot struct {
+	requests uint64
+	inFlight int64
+	errors   map[int32]uint64
+	counts   []uint64
+	sum      float64
+}
+
+func (s *series) snapshot() snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := snapshot{
+		requests: atomic.LoadUint64(&s.requests),
+		inFlight: atomic.LoadInt64(&s.inFlight),
+		errors:   make(map[int32]uint64, len(s.errors)),
+		counts:   append([]uint64(nil), s.counts...),
+		sum:      s.sum,
+	}
+	for code, n := range s.errors {
+		snap.errors[code] = n
+	}
+	return snap
+}
+
+type clientKey struct {
+	service string
+	method  string
+}
+
+// Registry 保存请求的统计，导出时再读取连接池、熔断器等的状态
+type Registry struct {
+	buckets []float64
+
+	mu      sync.RWMutex
+	server  map[string]*series
+	client  map[clientKey]*series
+	clients []client.RpcClient
+}
+
+// NewRegistry buckets为耗时分布的区间上限（秒），为空时使用DefaultBuckets
+func NewRegistry(buckets []float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Registry{
+		buckets: buckets,
+		server:  make(map[string]*series),
+		client:  make(map[clientKey]*series),
+	}
+}
+
+// AddClient 导出c的连接池状态
+func (r *Registry) AddClient(c client.RpcClient) {
+	r.mu.Lock()
+	r.clients = append(r.clients, c)
+	r.mu.Unlock()
+}
+
+func (r *Registry) serverSeries(method string) *series {
+	r.mu.RLock()
+	s, ok := r.server[method]
+	r.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok = r.server[method]; !ok {
+		s = newSeries(r.buckets)
+		r.server[method] = s
+	}
+	return s
+}
+
+func (r *Registry) clientSeries(service, method string) *series {
+	key := clientKey{service: service, method: method}
+	r.mu.RLock()
+	s, ok := r.client[key]
+	r.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok = r.client[key]; !ok {
+		s = newSeries(r.buckets)
+		r.client[key] = s
+	}
+	return s
+}
+
+type options struct {
+	registry *Registry
+}
+
+type Option func(o *options)
+
+func newOptions(opts ...Option) *options {
+	o := &options{registry: DefaultRegistry}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithRegistry 使用r记录与导出，默认为DefaultRegistry
+func WithRegistry(r *Registry) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go-micro/core/breaker"
+	"go-micro/core/cert"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/server"
+	wbreaker "go-micro/rpc/wrapper/breaker"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type fakeClient struct {
+	client.RpcClient
+	stats []client.NodePoolStats
+}
+
+func (c *fakeClient) PoolStats() []client.NodePoolStats { return c.stats }
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func contains(t *testing.T, out string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, out)
+		}
+	}
+}
+
+func TestHandlerWrapper(t *testing.T) {
+	r := NewRegistry([]float64{0.1, 1})
+	wrap := NewHandlerWrapper(WithRegistry(r))
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	block := wrap(func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+		close(entered)
+		<-release
+		return nil
+	})
+	done := make(chan error)
+	go func() {
+		done <- block(context.Background(), &server.Request{ServiceMethod: "User.Get"}, nil, nil)
+	}()
+	<-entered
+	contains(t, scrape(t, r), `rpc_server_in_flight_requests{method="User.Get"} 1`)
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	notFound := wrap(func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+		return errors.NotFound("test", "no user")
+	})
+	notFound(context.Background(), &server.Request{ServiceMethod: "User.Get"}, nil, nil)
+
+	panics := wrap(func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+		panic("boom")
+	})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic should be propagated to the server")
+			}
+		}()
+		panics(context.Background(), &server.Request{ServiceMethod: "User.Get"}, nil, nil)
+	}()
+
+	contains(t, scrape(t, r),
+		`# TYPE rpc_server_requests_total counter`,
+		`rpc_server_requests_total{method="User.Get"} 3`,
+		`rpc_server_errors_total{method="User.Get",code="404"} 1`,
+		`rpc_server_errors_total{method="User.Get",code="500"} 1`,
+		`rpc_server_in_flight_requests{method="User.Get"} 0`,
+		`# TYPE rpc_server_request_duration_seconds histogram`,
+		`rpc_server_request_duration_seconds_bucket{method="User.Get",le="+Inf"} 3`,
+		`rpc_server_request_duration_seconds_count{method="User.Get"} 3`,
+	)
+}
+
+func TestCallWrapper(t *testing.T) {
+	// 桶的边界与实际耗时相差较大，避免-race下耗时波动
+	r := NewRegistry([]float64{0.01, 10})
+	call := NewCallWrapper(WithRegistry(r))(func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+		time.Sleep(20 * time.Millisecond)
+		return errors.ServiceUnavailable("test", "down")
+	})
+	call(context.Background(), client.NewRequest("pay", "Pay.Create", nil), nil, client.CallOptions{})
+
+	contains(t, scrape(t, r),
+		`rpc_client_requests_total{service="pay",method="Pay.Create"} 1`,
+		`rpc_client_errors_total{service="pay",method="Pay.Create",code="503"} 1`,
+		`rpc_client_request_duration_seconds_bucket{service="pay",method="Pay.Create",le="0.01"} 0`,
+		`rpc_client_request_duration_seconds_bucket{service="pay",method="Pay.Create",le="10"} 1`,
+	)
+}
+
+func TestGauges(t *testing.T) {
+	r := NewRegistry(nil)
+	r.AddClient(&fakeClient{stats: []client.NodePoolStats{{
+		Address:     "127.0.0.1:8000",
+		ContentType: "application/json",
+		PoolStats:   client.PoolStats{Active: 2, Idle: 3, Waits: 4, WaitTime: 1500 * time.Millisecond},
+	}}})
+
+	// 熔断器是全局的，每次运行使用不同的名称
+	name := fmt.Sprintf("metrics-test-%d", time.Now().UnixNano())
+	breaker.GetBreaker(name).Do(func() error { return nil })
+
+	contains(t, scrape(t, r),
+		`rpc_client_pool_active_connections{address="127.0.0.1:8000",content_type="application/json"} 2`,
+		`rpc_client_pool_idle_connections{address="127.0.0.1:8000",content_type="application/json"} 3`,
+		`rpc_client_pool_wait_seconds_total{address="127.0.0.1:8000",content_type="application/json"} 1.5`,
+		`rpc_breaker_state{name="`+name+`",state="closed"} 1`,
+		`rpc_breaker_state{name="`+name+`",state="open"} 0`,
+		`rpc_breaker_requests{name="`+name+`"} 1`,
+	)
+}
+
+// uniqueSeries 检查每个序列只输出一次，重复的序列会导致Prometheus拒绝整个结果
+func uniqueSeries(t *testing.T, out string) {
+	t.Helper()
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		key := line
+		if !strings.HasPrefix(line, "# ") {
+			key = line[:strings.LastIndex(line, " ")]
+		}
+		if seen[key] {
+			t.Errorf("duplicate %q in:\n%s", key, out)
+		}
+		seen[key] = true
+	}
+}
+
+func TestDuplicateSeries(t *testing.T) {
+	// 两个breaker wrapper分别创建同名的熔断器
+	service := fmt.Sprintf("metrics-dup-%d", time.Now().UnixNano())
+	for i := 0; i < 2; i++ {
+		call := wbreaker.NewCallWrapper()(func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+			return nil
+		})
+		call(context.Background(), client.NewRequest(service, "Pay.Create", nil), nil, client.CallOptions{})
+	}
+
+	// 服务端与客户端使用同一个CA文件
+	caFile := filepath.Join("..", "..", "..", "cert", "ca.crt")
+	for i := 0; i < 2; i++ {
+		m, err := cert.NewManager(cert.WithCA(caFile), cert.WithLogger(zap.NewNop()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Close()
+	}
+
+	out := scrape(t, NewRegistry(nil))
+	uniqueSeries(t, out)
+	contains(t, out,
+		`rpc_breaker_requests{name="`+service+`.Pay.Create"} 2`,
+		`rpc_breaker_state{name="`+service+`.Pay.Create",state="closed"} 1`,
+	)
+	if n := strings.Count(out, `cert_expiry_timestamp_seconds{file="`+caFile+`"`); n != 1 {
+		t.Fatalf("got %d series for the shared ca file in:\n%s", n, out)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := NewRegistry(nil)
+	NewHandlerWrapper(WithRegistry(r))(func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+		return nil
+	})(context.Background(), &server.Request{ServiceMethod: `Echo."Say"`}, nil, nil)
+
+	g := gin.New()
+	Router(WithRegistry(r))(g)
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, DefaultPath, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != contentType {
+		t.Fatalf("got content type %q", ct)
+	}
+	contains(t, w.Body.String(), `rpc_server_requests_total{method="Echo.\"Say\""} 1`)
+}
@@ -0,0 +1,378 @@
+package metrics
+
+import (
+	"bufio"
+	"go-micro/core/breaker"
+	"go-micro/core/bulkhead"
+	"go-micro/core/cert"
+	wbreaker "go-micro/rpc/wrapper/breaker"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+// writer 按Prometheus文本格式（0.0.4）输出
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *writer) header(name, typ, help string) {
+	w.printf("# HELP ", name, " ", help, "\n# TYPE ", name, " ", typ, "\n")
+}
+
+func (w *writer) sample(name string, labels []label, value float64) {
+	w.printf(name)
+	if len(labels) > 0 {
+		w.printf("{")
+		for i, l := range labels {
+			if i > 0 {
+				w.printf(",")
+			}
+			w.printf(l.name, `="`, escape(l.value), `"`)
+		}
+		w.printf("}")
+	}
+	w.printf(" ", formatFloat(value), "\n")
+}
+
+func (w *writer) printf(s ...string) {
+	for _, v := range s {
+		if w.err != nil {
+			return
+		}
+		_, w.err = w.w.WriteString(v)
+	}
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func with(labels []label, l ...label) []label {
+	return append(append(make([]label, 0, len(labels)+len(l)), labels...), l...)
+}
+
+type namedSnapshot struct {
+	labels []label
+	snapshot
+}
+
+// WriteTo 以Prometheus文本格式输出所有指标
+func (r *Registry) WriteTo(out io.Writer) (int64, error) {
+	cw := &countWriter{w: out}
+	w := &writer{w: bufio.NewWriter(cw)}
+
+	r.writeSeries(w, "rpc_server", r.serverSnapshots())
+	r.writeSeries(w, "rpc_client", r.clientSnapshots())
+	r.writePools(w)
+	writeBreakers(w)
+	writeBulkheads(w)
+	writeCerts(w)
+
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return cw.n, w.err
+}
+
+func (r *Registry) serverSnapshots() []namedSnapshot {
+	r.mu.RLock()
+	methods := make([]string, 0, len(r.server))
+	for method := range r.server {
+		methods = append(methods, method)
+	}
+	r.mu.RUnlock()
+	sort.Strings(methods)
+
+	snaps := make([]namedSnapshot, 0, len(methods))
+	for _, method := range methods {
+		snaps = append(snaps, namedSnapshot{
+			labels:   []label{{"method", method}},
+			snapshot: r.serverSeries(method).snapshot(),
+		})
+	}
+	return snaps
+}
+
+func (r *Registry) clientSnapshots() []namedSnapshot {
+	r.mu.RLock()
+	keys := make([]clientKey, 0, len(r.client))
+	for key := range r.client {
+		keys = append(keys, key)
+	}
+	r.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].service != keys[j].service {
+			return keys[i].service < keys[j].service
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	snaps := make([]namedSnapshot, 0, len(keys))
+	for _, key := range keys {
+		snaps = append(snaps, namedSnapshot{
+			labels:   []label{{"service", key.service}, {"method", key.method}},
+			snapshot: r.clientSeries(key.service, key.method).snapshot(),
+		})
+	}
+	return snaps
+}
+
+func (r *Registry) writeSeries(w *writer, prefix string, snaps []namedSnapshot) {
+	if len(snaps) == 0 {
+		return
+	}
+
+	name := prefix + "_requests_total"
+	w.header(name, "counter", "Total number of rpc requests.")
+	for _, s := range snaps {
+		w.sample(name, s.labels, float64(s.requests))
+	}
+
+	name = prefix + "_errors_total"
+	w.header(name, "counter", "Total number of failed rpc requests by error code.")
+	for _, s := range snaps {
+		codes := make([]int, 0, len(s.errors))
+		for code := range s.errors {
+			codes = append(codes, int(code))
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			w.sample(name, with(s.labels, label{"code", strconv.Itoa(code)}), float64(s.errors[int32(code)]))
+		}
+	}
+
+	name = prefix + "_in_flight_requests"
+	w.header(name, "gauge", "Number of rpc requests in flight.")
+	for _, s := range snaps {
+		w.sample(name, s.labels, float64(s.inFlight))
+	}
+
+	name = prefix + "_request_duration_seconds"
+	w.header(name, "histogram", "Latency of rpc requests in seconds.")
+	for _, s := range snaps {
+		var cumulative uint64
+		for i, bound := range r.buckets {
+			cumulative += s.counts[i]
+			w.sample(name+"_bucket", with(s.labels, label{"le", formatFloat(bound)}), float64(cumulative))
+		}
+		cumulative += s.counts[len(r.buckets)]
+		w.sample(name+"_bucket", with(s.labels, label{"le", "+Inf"}), float64(cumulative))
+		w.sample(name+"_sum", s.labels, s.sum)
+		w.sample(name+"_count", s.labels, float64(cumulative))
+	}
+}
+
+func (r *Registry) writePools(w *writer) {
+	r.mu.RLock()
+	clients := r.clients
+	r.mu.RUnlock()
+
+	var labels [][]label
+	var stats []poolStats
+	for _, c := range clients {
+		for _, s := range c.PoolStats() {
+			labels = append(labels, []label{{"address", s.Address}, {"content_type", s.ContentType}})
+			stats = append(stats, poolStats{
+				active:   float64(s.Active),
+				idle:     float64(s.Idle),
+				waits:    float64(s.Waits),
+				waitTime: s.WaitTime.Seconds(),
+				timeouts: float64(s.Timeouts),
+			})
+		}
+	}
+	if len(stats) == 0 {
+		return
+	}
+
+	gauges := []struct {
+		name, typ, help string
+		value           func(s poolStats) float64
+	}{
+		{"rpc_client_pool_active_connections", "gauge", "Number of connections in use.", func(s poolStats) float64 { return s.active }},
+		{"rpc_client_pool_idle_connections", "gauge", "Number of idle connections.", func(s poolStats) float64 { return s.idle }},
+		{"rpc_client_pool_waits_total", "counter", "Total number of waits for a connection.", func(s poolStats) float64 { return s.waits }},
+		{"rpc_client_pool_wait_seconds_total", "counter", "Total time spent waiting for a connection.", func(s poolStats) float64 { return s.waitTime }},
+		{"rpc_client_pool_timeouts_total", "counter", "Total number of timeouts waiting for a connection.", func(s poolStats) float64 { return s.timeouts }},
+	}
+	for _, g := range gauges {
+		w.header(g.name, g.typ, g.help)
+		for i, s := range stats {
+			w.sample(g.name, labels[i], g.value(s))
+		}
+	}
+}
+
+type poolStats struct {
+	active, idle, waits, waitTime, timeouts float64
+}
+
+var breakerStates = []breaker.State{breaker.StateClosed, breaker.StateHalfOpen, breaker.StateOpen}
+
+type breakerStats struct {
+	name     string
+	state    breaker.State
+	requests uint32
+	failures uint32
+}
+
+// severity 状态的严重程度，按breakerStates的顺序
+func severity(state breaker.State) int {
+	for i, s := range breakerStates {
+		if s == state {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeBreakers 导出core/breaker与breaker wrapper创建的熔断器，
+// 不同的wrapper可能创建同名的熔断器，同名的合并为一个序列，状态取最严重的，计数相加
+func writeBreakers(w *writer) {
+	byName := make(map[string]*breakerStats)
+	collect := func(b breaker.Breaker) bool {
+		counts := b.Counts()
+		st, ok := byName[b.Name()]
+		if !ok {
+			st = &breakerStats{name: b.Name(), state: b.State()}
+			byName[b.Name()] = st
+		} else if state := b.State(); severity(state) > severity(st.state) {
+			st.state = state
+		}
+		st.requests += counts.Request
+		st.failures += counts.TotalFailures
+		return true
+	}
+	breaker.Range(collect)
+	wbreaker.Range(collect)
+	if len(byName) == 0 {
+		return
+	}
+	bs := make([]*breakerStats, 0, len(byName))
+	for _, st := range byName {
+		bs = append(bs, st)
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i].name < bs[j].name })
+
+	w.header("rpc_breaker_state", "gauge", "Circuit breaker state, 1 for the current state.")
+	for _, b := range bs {
+		for _, s := range breakerStates {
+			v := 0.0
+			if s == b.state {
+				v = 1
+			}
+			w.sample("rpc_breaker_state", []label{{"name", b.name}, {"state", s.String()}}, v)
+		}
+	}
+	w.header("rpc_breaker_requests", "gauge", "Requests counted by the circuit breaker in the current window.")
+	for _, b := range bs {
+		w.sample("rpc_breaker_requests", []label{{"name", b.name}}, float64(b.requests))
+	}
+	w.header("rpc_breaker_failures", "gauge", "Failures counted by the circuit breaker in the current window.")
+	for _, b := range bs {
+		w.sample("rpc_breaker_failures", []label{{"name", b.name}}, float64(b.failures))
+	}
+}
+
+func writeBulkheads(w *writer) {
+	var bs []bulkhead.Bulkhead
+	bulkhead.Range(func(b bulkhead.Bulkhead) bool {
+		bs = append(bs, b)
+		return true
+	})
+	if len(bs) == 0 {
+		return
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i].Name() < bs[j].Name() })
+
+	stats := make([]bulkhead.Stats, len(bs))
+	for i, b := range bs {
+		stats[i] = b.Stats()
+	}
+	w.header("rpc_bulkhead_active", "gauge", "Number of requests executing in the bulkhead.")
+	for i, b := range bs {
+		w.sample("rpc_bulkhead_active", []label{{"name", b.Name()}}, float64(stats[i].Active))
+	}
+	w.header("rpc_bulkhead_waiting", "gauge", "Number of requests waiting for the bulkhead.")
+	for i, b := range bs {
+		w.sample("rpc_bulkhead_waiting", []label{{"name", b.Name()}}, float64(stats[i].Waiting))
+	}
+}
+
+// writeCerts 服务端与客户端可能加载同一个证书文件，CA文件中也可能有同名的证书，
+// 相同的文件、名称与类型只输出一个序列，取最早的过期时间
+func writeCerts(w *writer) {
+	type certKey struct {
+		file, commonName string
+		ca               bool
+	}
+	earliest := make(map[certKey]cert.Expiry)
+	cert.Range(func(m *cert.Manager) bool {
+		for _, e := range m.Expiries() {
+			k := certKey{e.File, e.CommonName, e.IsCA}
+			if old, ok := earliest[k]; !ok || e.NotAfter.Before(old.NotAfter) {
+				earliest[k] = e
+			}
+		}
+		return true
+	})
+	if len(earliest) == 0 {
+		return
+	}
+	expiries := make([]cert.Expiry, 0, len(earliest))
+	for _, e := range earliest {
+		expiries = append(expiries, e)
+	}
+	sort.Slice(expiries, func(i, j int) bool {
+		if expiries[i].File != expiries[j].File {
+			return expiries[i].File < expiries[j].File
+		}
+		if expiries[i].CommonName != expiries[j].CommonName {
+			return expiries[i].CommonName < expiries[j].CommonName
+		}
+		return !expiries[i].IsCA && expiries[j].IsCA
+	})
+
+	w.header("cert_expiry_timestamp_seconds", "gauge", "Unix time when the certificate expires.")
+	for _, e := range expiries {
+		w.sample("cert_expiry_timestamp_seconds", []label{
+			{"file", e.File},
+			{"common_name", e.CommonName},
+			{"ca", strconv.FormatBool(e.IsCA)},
+		}, float64(e.NotAfter.Unix()))
+	}
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
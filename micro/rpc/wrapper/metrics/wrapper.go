@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/server"
+	"time"
+)
+
+var errPanic = errors.InternalServerError(server.IdPanic, "handler panic")
+
+// NewCallWrapper 客户端按服务名与Service.Method统计，CallWrapper在每次尝试时执行，重试的每次尝试分别计数
+func NewCallWrapper(opts ...Option) client.CallWrapper {
+	r := newOptions(opts...).registry
+	return func(callFunc client.CallFunc) client.CallFunc {
+		return func(ctx context.Context, req client.Request, resp interface{}, callOption client.CallOptions) error {
+			s := r.clientSeries(req.Service(), req.Method())
+			s.begin()
+			start := time.Now()
+			err := callFunc(ctx, req, resp, callOption)
+			s.end(r.buckets, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// NewHandlerWrapper 服务端按Service.Method统计，放在最外层时被限流、鉴权拒绝的请求也会计入
+func NewHandlerWrapper(opts ...Option) server.HandlerWrapper {
+	r := newOptions(opts...).registry
+	return func(handlerFunc server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+			s := r.serverSeries(req.ServiceMethod)
+			s.begin()
+			start := time.Now()
+			// handler panic时由server恢复并返回500，这里按500计入后继续panic
+			defer func() {
+				if p := recover(); p != nil {
+					s.end(r.buckets, time.Since(start), errPanic)
+					panic(p)
+				}
+			}()
+			err := handlerFunc(ctx, req, argv, rsp)
+			s.end(r.buckets, time.Since(start), err)
+			return err
+		}
+	}
+}
@@ -72,7 +72,6 @@ func NewHandlerWrapper(ot opentracing.Tracer) server.HandlerWrapper {
 func StartSpanFromContext(ctx context.Context, tracer opentracing.Tracer, name string, opts ...opentracing.StartSpanOption) (context.Context, opentracing.Span, error) {
 	// 先判断header是不是存在信息
 	carrier := HeaderFromContext(ctx)
-	fmt.Println("carrier", carrier)
 	// 解析；解析是不是存在父节点，第二个是不是存在下级
 	if parentSpan := opentracing.SpanFromContext(ctx); parentSpan != nil {
 		opts = append(opts, opentracing.ChildOf(parentSpan.Context()))
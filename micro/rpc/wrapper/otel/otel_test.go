@@ -0,0 +1,216 @@
+package otel
+
+import (
+	"context"
+	"encoding/json"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/server"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+func (e *memoryExporter) ExportSpans(ctx context.Context, serviceName string, spans []*SpanData) error {
+	e.mu.Lock()
+	e.spans = append(e.spans, spans...)
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *memoryExporter) Shutdown(ctx context.Context) error { return nil }
+
+func TestParseTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(tp)
+	if !ok || !sc.IsSampled() || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("got %+v, %v", sc, ok)
+	}
+	if sc.Traceparent() != tp {
+		t.Fatalf("got %s, want %s", sc.Traceparent(), tp)
+	}
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Fatal("a higher version with extra fields should be accepted")
+	}
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := ParseTraceparent(s); ok {
+			t.Errorf("%q should be rejected", s)
+		}
+	}
+}
+
+func TestSamplers(t *testing.T) {
+	tracer := NewTracer()
+	var traceIDs []TraceID
+	for i := 0; i < 10000; i++ {
+		var id TraceID
+		tracer.newIDs(&id, &SpanID{})
+		traceIDs = append(traceIDs, id)
+	}
+	count := func(s Sampler, parent SpanContext) int {
+		n := 0
+		for _, id := range traceIDs {
+			if s.ShouldSample(parent, id, "") {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := count(TraceIDRatioBased(0), SpanContext{}); n != 0 {
+		t.Errorf("ratio 0 sampled %d", n)
+	}
+	if n := count(TraceIDRatioBased(1), SpanContext{}); n != len(traceIDs) {
+		t.Errorf("ratio 1 sampled %d", n)
+	}
+	if n := count(TraceIDRatioBased(0.25), SpanContext{}); n < 2200 || n > 2800 {
+		t.Errorf("ratio 0.25 sampled %d of %d", n, len(traceIDs))
+	}
+
+	sampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	notSampled, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	s := ParentBased(TraceIDRatioBased(0))
+	if n := count(s, sampled); n != len(traceIDs) {
+		t.Errorf("parent based should follow a sampled parent, sampled %d", n)
+	}
+	if n := count(ParentBased(AlwaysSample()), notSampled); n != 0 {
+		t.Errorf("parent based should follow a parent that is not sampled, sampled %d", n)
+	}
+	if n := count(s, SpanContext{}); n != 0 {
+		t.Errorf("root spans should use the root sampler, sampled %d", n)
+	}
+
+	if _, err := ParseSampler("sometimes", 0); err == nil {
+		t.Error("unknown sampler should be rejected")
+	}
+}
+
+func TestWrappers(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer(WithExporter(exporter), WithServiceName("user"))
+
+	var got SpanContext
+	handler := NewHandlerWrapper(WithTracer(tracer))(func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+		got = SpanContextFromContext(ctx)
+		return errors.NotFound("test", "no user")
+	})
+	call := NewCallWrapper(WithTracer(tracer))(func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+		return handler(ctx, &server.Request{ServiceMethod: req.Method(), Header: req.Header()}, nil, nil)
+	})
+
+	req := client.NewRequest("user", "User.Get", nil)
+	req.Header().Set(TracestateHeader, "vendor=1")
+	err := call(context.Background(), req, nil, client.CallOptions{})
+	if errors.FromError(err).Code != 404 {
+		t.Fatalf("got %v", err)
+	}
+	if err := tracer.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var clientSpan, serverSpan *SpanData
+	exporter.mu.Lock()
+	if len(exporter.spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(exporter.spans))
+	}
+	for _, s := range exporter.spans {
+		if s.Kind == SpanKindServer {
+			serverSpan = s
+		} else {
+			clientSpan = s
+		}
+	}
+	exporter.mu.Unlock()
+
+	if clientSpan.Kind != SpanKindClient || clientSpan.Parent.IsValid() {
+		t.Fatalf("client span %+v", clientSpan)
+	}
+	if serverSpan.SpanContext.TraceID != clientSpan.SpanContext.TraceID || serverSpan.Parent != clientSpan.SpanContext.SpanID {
+		t.Fatalf("server span %+v should be a child of client span %+v", serverSpan, clientSpan)
+	}
+	if got.SpanID != serverSpan.SpanContext.SpanID {
+		t.Fatal("the handler should see the server span in ctx")
+	}
+	if serverSpan.StatusCode != StatusError || clientSpan.StatusCode != StatusError {
+		t.Fatal("failed calls should be marked as errors")
+	}
+	if tp := req.Header().Get(TraceparentHeader); tp != clientSpan.SpanContext.Traceparent() {
+		t.Fatalf("got traceparent %q", tp)
+	}
+	if req.Header().Get(TracestateHeader) != "" {
+		t.Fatal("a root span should not forward a stale tracestate")
+	}
+}
+
+func TestNotSampledParent(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer(WithExporter(exporter))
+
+	var forwarded string
+	handler := NewHandlerWrapper(WithTracer(tracer))(func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+		h := http.Header{}
+		Inject(ctx, h)
+		forwarded = h.Get(TraceparentHeader)
+		return nil
+	})
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	h.Set(TracestateHeader, "vendor=1")
+	if err := handler(context.Background(), &server.Request{ServiceMethod: "User.Get", Header: h}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	tracer.Close()
+
+	if len(exporter.spans) != 0 {
+		t.Fatalf("spans that are not sampled should not be exported, got %d", len(exporter.spans))
+	}
+	sc, ok := ParseTraceparent(forwarded)
+	if !ok || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.IsSampled() {
+		t.Fatalf("got traceparent %q", forwarded)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("got content type %q", ct)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		close(done)
+	}))
+	defer srv.Close()
+
+	tracer := NewTracer(WithExporter(NewOTLPExporter(srv.URL)), WithServiceName("user"), WithBatch(1, time.Hour))
+	_, span := tracer.Start(context.Background(), "User.Get", SpanKindServer, String("rpc.system", "go-micro"))
+	span.End()
+	<-done
+	tracer.Close()
+
+	rs := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	service := rs["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if service["key"] != "service.name" || service["value"].(map[string]interface{})["stringValue"] != "user" {
+		t.Fatalf("got resource %v", rs["resource"])
+	}
+	s := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+	if s["name"] != "User.Get" || s["kind"] != float64(SpanKindServer) || s["traceId"] != span.SpanContext().TraceID.String() {
+		t.Fatalf("got span %v", s)
+	}
+}
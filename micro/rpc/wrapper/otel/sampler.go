@@ -0,0 +1,92 @@
+package otel
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Sampler 决定新的span是否采样，不采样的span仍然会传递trace id，但不会导出
+type Sampler interface {
+	ShouldSample(parent SpanContext, traceID TraceID, name string) bool
+	Description() string
+}
+
+type alwaysSample struct{}
+
+func (alwaysSample) ShouldSample(SpanContext, TraceID, string) bool { return true }
+func (alwaysSample) Description() string                            { return "AlwaysOnSampler" }
+
+type neverSample struct{}
+
+func (neverSample) ShouldSample(SpanContext, TraceID, string) bool { return false }
+func (neverSample) Description() string                            { return "AlwaysOffSampler" }
+
+func AlwaysSample() Sampler { return alwaysSample{} }
+
+func NeverSample() Sampler { return neverSample{} }
+
+type ratioSample struct {
+	bound       uint64
+	description string
+}
+
+func (s ratioSample) ShouldSample(_ SpanContext, traceID TraceID, _ string) bool {
+	// 与OpenTelemetry的实现一致，用trace id的后8字节判断，同一个trace在各个服务的结果相同
+	return binary.BigEndian.Uint64(traceID[8:16])>>1 < s.bound
+}
+
+func (s ratioSample) Description() string { return s.description }
+
+// TraceIDRatioBased 按trace id采样ratio比例的trace，ratio>=1时全部采样，<=0时都不采样
+func TraceIDRatioBased(ratio float64) Sampler {
+	if ratio >= 1 {
+		return AlwaysSample()
+	}
+	if ratio <= 0 {
+		ratio = 0
+	}
+	return ratioSample{
+		bound:       uint64(ratio * (1 << 63)),
+		description: fmt.Sprintf("TraceIDRatioBased{%g}", ratio),
+	}
+}
+
+type parentBased struct {
+	root Sampler
+}
+
+func (s parentBased) ShouldSample(parent SpanContext, traceID TraceID, name string) bool {
+	if parent.IsValid() {
+		return parent.IsSampled()
+	}
+	return s.root.ShouldSample(parent, traceID, name)
+}
+
+func (s parentBased) Description() string {
+	return "ParentBased{root:" + s.root.Description() + "}"
+}
+
+// ParentBased 有父span时跟随父span的采样结果，没有时由root决定
+func ParentBased(root Sampler) Sampler {
+	return parentBased{root: root}
+}
+
+// ParseSampler 按OTEL_TRACES_SAMPLER的取值创建Sampler，ratio为traceidratio的采样比例，name为空时为parentbased_always_on
+func ParseSampler(name string, ratio float64) (Sampler, error) {
+	switch name {
+	case "always_on":
+		return AlwaysSample(), nil
+	case "always_off":
+		return NeverSample(), nil
+	case "traceidratio":
+		return TraceIDRatioBased(ratio), nil
+	case "", "parentbased_always_on":
+		return ParentBased(AlwaysSample()), nil
+	case "parentbased_always_off":
+		return ParentBased(NeverSample()), nil
+	case "parentbased_traceidratio":
+		return ParentBased(TraceIDRatioBased(ratio)), nil
+	}
+	return nil, fmt.Errorf("sampler unknown: %s (available sampler: always_on always_off traceidratio "+
+		"parentbased_always_on parentbased_always_off parentbased_traceidratio)", name)
+}
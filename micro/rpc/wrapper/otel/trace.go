@@ -0,0 +1,138 @@
+// Package otel 按OpenTelemetry的模型记录rpc调用的span，通过W3C traceparent/tracestate在Request.Header中传递，
+// 支持按比例与按上游决定的采样，span通过OTLP/HTTP(JSON)或标准输出导出。
+// 只依赖标准库，导出的数据可以直接发送给OpenTelemetry Collector或Jaeger的OTLP端口
+package otel
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	TraceparentHeader = "Traceparent"
+	TracestateHeader  = "Tracestate"
+)
+
+type TraceID [16]byte
+
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+type SpanID [8]byte
+
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// FlagsSampled traceparent中表示已采样的标志位
+const FlagsSampled = byte(0x01)
+
+// SpanContext 需要在服务之间传递的span信息
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	// 是否从上游的请求头中解析得到
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagsSampled != 0
+}
+
+// Traceparent 格式为 00-{trace-id}-{parent-id}-{flags}
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent 解析traceparent，更高版本的traceparent只解析前四段
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 {
+		return sc, false
+	}
+	version, ok := decode(parts[0], 1)
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return sc, false
+	}
+	traceID, ok := decode(parts[1], 16)
+	if !ok {
+		return sc, false
+	}
+	spanID, ok := decode(parts[2], 8)
+	if !ok {
+		return sc, false
+	}
+	flags, ok := decode(parts[3], 1)
+	if !ok {
+		return sc, false
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	return sc, sc.IsValid()
+}
+
+// decode 只接受小写的十六进制
+func decode(s string, n int) ([]byte, bool) {
+	if len(s) != n*2 || strings.ToLower(s) != s {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// ContextWithSpan 在ctx中保存当前的span，之后创建的span以它为父节点
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SpanContextFromContext 当前span的SpanContext，没有span时返回Extract得到的上游SpanContext
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Inject 将ctx中的SpanContext写入请求头
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// Extract 解析请求头中的traceparent，解析失败时返回原来的ctx
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, ok := ParseTraceparent(h.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	sc.TraceState = strings.Join(h.Values(TracestateHeader), ",")
+	sc.Remote = true
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
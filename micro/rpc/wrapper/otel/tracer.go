@@ -0,0 +1,367 @@
+package otel
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultBatchSize     = 512
+	DefaultQueueSize     = 2048
+	DefaultFlushInterval = 5 * time.Second
+)
+
+type SpanKind int
+
+// 与OTLP中的取值一致
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute 值为string、int64、float64或bool
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SpanData 结束后交给Exporter的span
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	Parent        SpanID
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	StatusCode    StatusCode
+	StatusMessage string
+}
+
+// Exporter 批量导出span
+type Exporter interface {
+	ExportSpans(ctx context.Context, serviceName string, spans []*SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+type option struct {
+	serviceName   string
+	sampler       Sampler
+	exporter      Exporter
+	batchSize     int
+	queueSize     int
+	flushInterval time.Duration
+	logger        *zap.Logger
+}
+
+type Option func(o *option)
+
+func NewOption() *option {
+	return &option{
+		sampler:       ParentBased(AlwaysSample()),
+		batchSize:     DefaultBatchSize,
+		queueSize:     DefaultQueueSize,
+		flushInterval: DefaultFlushInterval,
+		logger:        zap.L(),
+	}
+}
+
+// WithServiceName 导出时的service.name
+func WithServiceName(name string) Option {
+	return func(o *option) {
+		o.serviceName = name
+	}
+}
+
+// WithSampler 默认为ParentBased(AlwaysSample())
+func WithSampler(s Sampler) Option {
+	return func(o *option) {
+		o.sampler = s
+	}
+}
+
+// WithExporter 没有设置时只传递trace id，不导出span
+func WithExporter(e Exporter) Option {
+	return func(o *option) {
+		o.exporter = e
+	}
+}
+
+// WithBatch 每批最多导出size个span，不满一批时每隔interval导出一次
+func WithBatch(size int, interval time.Duration) Option {
+	return func(o *option) {
+		o.batchSize = size
+		o.flushInterval = interval
+	}
+}
+
+// WithQueueSize 等待导出的span的上限，超过时丢弃新的span
+func WithQueueSize(size int) Option {
+	return func(o *option) {
+		o.queueSize = size
+	}
+}
+
+func WithLogger(logger *zap.Logger) Option {
+	return func(o *option) {
+		o.logger = logger
+	}
+}
+
+// Tracer 创建span并在后台批量导出
+type Tracer struct {
+	opt *option
+
+	randLock sync.Mutex
+	rand     *rand.Rand
+
+	queue     chan *SpanData
+	flush     chan chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewTracer(opts ...Option) *Tracer {
+	opt := NewOption()
+	for _, o := range opts {
+		o(opt)
+	}
+
+	var seed int64
+	binary.Read(crand.Reader, binary.LittleEndian, &seed)
+	t := &Tracer{
+		opt:  opt,
+		rand: rand.New(rand.NewSource(seed)),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if opt.exporter == nil {
+		close(t.done)
+		return t
+	}
+
+	t.queue = make(chan *SpanData, opt.queueSize)
+	t.flush = make(chan chan struct{})
+	go t.run()
+	return t
+}
+
+var (
+	globalLock   sync.RWMutex
+	globalTracer = NewTracer()
+)
+
+// SetTracer 设置wrapper默认使用的Tracer
+func SetTracer(t *Tracer) {
+	globalLock.Lock()
+	globalTracer = t
+	globalLock.Unlock()
+}
+
+func GetTracer() *Tracer {
+	globalLock.RLock()
+	defer globalLock.RUnlock()
+	return globalTracer
+}
+
+func (t *Tracer) newIDs(traceID *TraceID, spanID *SpanID) {
+	t.randLock.Lock()
+	defer t.randLock.Unlock()
+	if traceID != nil {
+		t.rand.Read(traceID[:])
+	}
+	t.rand.Read(spanID[:])
+}
+
+// Start 以ctx中的span或上游的SpanContext为父节点创建span，返回的ctx中保存新的span
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+
+	sc := SpanContext{TraceState: parent.TraceState}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		t.newIDs(nil, &sc.SpanID)
+	} else {
+		t.newIDs(&sc.TraceID, &sc.SpanID)
+	}
+	if t.opt.sampler.ShouldSample(parent, sc.TraceID, name) {
+		sc.Flags |= FlagsSampled
+	}
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: sc,
+			Parent:      parent.SpanID,
+			Start:       time.Now(),
+			Attributes:  attrs,
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) export(d *SpanData) {
+	if t.queue == nil || !d.SpanContext.IsSampled() {
+		return
+	}
+	select {
+	case <-t.stop:
+	case t.queue <- d:
+	default:
+		t.opt.logger.Warn("span queue is full, dropping span", zap.String("span", d.Name))
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.opt.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, t.opt.batchSize)
+	exportBatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := t.opt.exporter.ExportSpans(ctx, t.opt.serviceName, batch); err != nil {
+			t.opt.logger.Error("export spans", zap.Int("spans", len(batch)), zap.Error(err))
+		}
+		cancel()
+		batch = make([]*SpanData, 0, t.opt.batchSize)
+	}
+	drain := func() {
+		for {
+			select {
+			case d := <-t.queue:
+				batch = append(batch, d)
+				if len(batch) >= t.opt.batchSize {
+					exportBatch()
+				}
+			default:
+				exportBatch()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case d := <-t.queue:
+			batch = append(batch, d)
+			if len(batch) >= t.opt.batchSize {
+				exportBatch()
+			}
+		case <-ticker.C:
+			exportBatch()
+		case ch := <-t.flush:
+			drain()
+			close(ch)
+		case <-t.stop:
+			drain()
+			return
+		}
+	}
+}
+
+// ForceFlush 导出已经结束的span
+func (t *Tracer) ForceFlush(ctx context.Context) error {
+	if t.queue == nil {
+		return nil
+	}
+	ch := make(chan struct{})
+	select {
+	case t.flush <- ch:
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close 导出剩余的span并关闭Exporter
+func (t *Tracer) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.stop)
+		<-t.done
+		if t.opt.exporter != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err = t.opt.exporter.Shutdown(ctx)
+			cancel()
+		}
+	})
+	return err
+}
+
+// Span 一次调用，结束时调用End
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+	s.mu.Unlock()
+}
+
+func (s *Span) SetStatus(code StatusCode, message string) {
+	s.mu.Lock()
+	s.data.StatusCode = code
+	s.data.StatusMessage = message
+	s.mu.Unlock()
+}
+
+// End 重复调用时只有第一次有效
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	d := s.data
+	d.Attributes = append([]Attribute(nil), s.data.Attributes...)
+	s.mu.Unlock()
+
+	s.tracer.export(&d)
+}
+
+func String(key, value string) Attribute { return Attribute{Key: key, Value: value} }
+
+func Int64(key string, value int64) Attribute { return Attribute{Key: key, Value: value} }
+
+func Bool(key string, value bool) Attribute { return Attribute{Key: key, Value: value} }
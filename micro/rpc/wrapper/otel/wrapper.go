@@ -0,0 +1,88 @@
+package otel
+
+import (
+	"context"
+	"go-micro/core/errors"
+	"go-micro/rpc/client"
+	"go-micro/rpc/server"
+	"strings"
+)
+
+type wrapperOptions struct {
+	tracer *Tracer
+}
+
+type WrapperOption func(o *wrapperOptions)
+
+// WithTracer wrapper使用的Tracer，默认为GetTracer()
+func WithTracer(t *Tracer) WrapperOption {
+	return func(o *wrapperOptions) {
+		o.tracer = t
+	}
+}
+
+func newWrapperOptions(opts ...WrapperOption) *wrapperOptions {
+	o := &wrapperOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *wrapperOptions) getTracer() *Tracer {
+	if o.tracer != nil {
+		return o.tracer
+	}
+	return GetTracer()
+}
+
+// methodAttributes 按OpenTelemetry的rpc语义约定，serviceMethod格式为Service.Method
+func methodAttributes(serviceMethod string) []Attribute {
+	attrs := []Attribute{String("rpc.system", "go-micro")}
+	if i := strings.LastIndex(serviceMethod, "."); i >= 0 {
+		return append(attrs, String("rpc.service", serviceMethod[:i]), String("rpc.method", serviceMethod[i+1:]))
+	}
+	return append(attrs, String("rpc.method", serviceMethod))
+}
+
+func finish(span *Span, err error) {
+	if err != nil {
+		e := errors.FromError(err)
+		span.SetAttributes(Int64("rpc.go_micro.error_code", int64(e.Code)))
+		span.SetStatus(StatusError, err.Error())
+	}
+	span.End()
+}
+
+// NewCallWrapper 客户端为每次调用创建client span，并通过traceparent传递给服务端
+func NewCallWrapper(opts ...WrapperOption) client.CallWrapper {
+	o := newWrapperOptions(opts...)
+	return func(call client.CallFunc) client.CallFunc {
+		return func(ctx context.Context, req client.Request, rsp interface{}, opts client.CallOptions) error {
+			attrs := append(methodAttributes(req.Method()), String("peer.service", req.Service()))
+			ctx, span := o.getTracer().Start(ctx, req.Method(), SpanKindClient, attrs...)
+			Inject(ctx, req.Header())
+
+			err := call(ctx, req, rsp, opts)
+			finish(span, err)
+			return err
+		}
+	}
+}
+
+// NewHandlerWrapper 服务端解析traceparent并创建server span，handler中的调用以它为父节点
+func NewHandlerWrapper(opts ...WrapperOption) server.HandlerWrapper {
+	o := newWrapperOptions(opts...)
+	return func(call server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+			if req.Header != nil {
+				ctx = Extract(ctx, req.Header)
+			}
+			ctx, span := o.getTracer().Start(ctx, req.ServiceMethod, SpanKindServer, methodAttributes(req.ServiceMethod)...)
+
+			err := call(ctx, req, argv, rsp)
+			finish(span, err)
+			return err
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package ratelimit 将core/ratelimit的限流器接入rpc服务端，规则来自配置文件的rpc_server.rate_limit，
+// 可以整体限流、按Service.Method限流或按header的值（调用方服务名、用户id等）分别限流，
+// distributed规则通过redis等共享缓存在多个副本之间共享限额
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"go-micro/config"
+	"go-micro/core/cache"
+	"go-micro/core/errors"
+	"go-micro/core/ratelimit"
+	"go-micro/rpc/server"
+	"strings"
+	"sync"
+)
+
+// LimitErrorId 请求被限流时返回的错误的Id，错误码为429
+const LimitErrorId = "go-micro/rpc/wrapper/ratelimit"
+
+const (
+	KeyGlobal = "global"
+	KeyMethod = "method"
+	KeyHeader = "header"
+)
+
+type rule struct {
+	cfg     config.RateLimitRule
+	limiter ratelimit.Limiter
+}
+
+type options struct {
+	cache cache.CacheInterface
+}
+
+type Option func(o *options)
+
+// WithCache distributed规则使用的缓存，需要在多个副本之间共享，否则distributed规则会被拒绝
+func WithCache(c cache.CacheInterface) Option {
+	return func(o *options) {
+		o.cache = c
+	}
+}
+
+func newRule(cfg config.RateLimitRule, o *options) (*rule, error) {
+	window := cfg.Window
+	if window <= 0 {
+		window = ratelimit.DefaultWindow
+	}
+	opts := []ratelimit.Option{ratelimit.WithRate(cfg.Rate, window)}
+	if cfg.Algorithm != "" {
+		opts = append(opts, ratelimit.WithAlgorithm(ratelimit.Algorithm(cfg.Algorithm)))
+	}
+	if cfg.Burst > 0 {
+		opts = append(opts, ratelimit.WithBurst(cfg.Burst))
+	}
+	if cfg.Distributed {
+		// 进程内缓存的计数不能在副本之间共享，每个副本都会放行全部限额
+		if o.cache == nil || !cache.IsShared(o.cache) {
+			return nil, fmt.Errorf("rate limit rule %q: distributed requires a cache shared between replicas", cfg.Method)
+		}
+		// 同一条规则在各个副本上的前缀相同
+		prefix := fmt.Sprintf("ratelimit:%s:%s:%s:%d/%s:", cfg.Method, cfg.Key, cfg.Header, cfg.Rate, window)
+		opts = append(opts, ratelimit.WithPrefix(prefix))
+		return &rule{cfg: cfg, limiter: ratelimit.NewCacheLimiter(o.cache, opts...)}, nil
+	}
+	return &rule{cfg: cfg, limiter: ratelimit.NewLimiter(opts...)}, nil
+}
+
+func (r *rule) match(serviceMethod string) bool {
+	m := r.cfg.Method
+	switch {
+	case m == "" || m == "*":
+		return true
+	case strings.HasSuffix(m, ".*"):
+		return strings.HasPrefix(serviceMethod, m[:len(m)-1])
+	}
+	return m == serviceMethod
+}
+
+func (r *rule) key(req *server.Request) string {
+	switch r.cfg.Key {
+	case KeyMethod:
+		return req.ServiceMethod
+	case KeyHeader:
+		// 没有该header的请求共用一个计数
+		return req.Header.Get(r.cfg.Header)
+	}
+	return ""
+}
+
+// Limiter 按规则限流，配置变化时通过Update更新规则
+type Limiter struct {
+	opts  *options
+	mu    sync.RWMutex
+	rules []*rule
+}
+
+func NewLimiter(cfg config.RateLimit, opts ...Option) (*Limiter, error) {
+	l := &Limiter{opts: &options{}}
+	for _, o := range opts {
+		o(l.opts)
+	}
+	if err := l.Update(cfg); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Update 替换限流规则，没有变化的规则保留原来的计数，配置有误时保留原来的规则
+func (l *Limiter) Update(cfg config.RateLimit) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	old := make(map[config.RateLimitRule][]*rule, len(l.rules))
+	for _, r := range l.rules {
+		old[r.cfg] = append(old[r.cfg], r)
+	}
+
+	rules := make([]*rule, 0, len(cfg.Rules))
+	for _, c := range cfg.Rules {
+		if rs := old[c]; len(rs) > 0 {
+			rules = append(rules, rs[0])
+			old[c] = rs[1:]
+			continue
+		}
+		r, err := newRule(c, l.opts)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, r)
+	}
+	l.rules = rules
+	return nil
+}
+
+// Allow 请求需要通过所有匹配的规则，被限流时返回429
+func (l *Limiter) Allow(req *server.Request) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, r := range l.rules {
+		if r.match(req.ServiceMethod) && !r.limiter.Allow(r.key(req)) {
+			return errors.TooManyRequests(LimitErrorId, "%s: rate limit exceeded", req.ServiceMethod)
+		}
+	}
+	return nil
+}
+
+// NewHandlerWrapper 被限流的请求不会执行handler
+func NewHandlerWrapper(l *Limiter) server.HandlerWrapper {
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+			if err := l.Allow(req); err != nil {
+				return err
+			}
+			return h(ctx, req, argv, rsp)
+		}
+	}
+}
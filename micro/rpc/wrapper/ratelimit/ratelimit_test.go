@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"go-micro/config"
+	"go-micro/core/cache"
+	"go-micro/core/errors"
+	"go-micro/rpc/server"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func call(h server.HandlerFunc, method, caller string) error {
+	req := &server.Request{ServiceMethod: method, Header: http.Header{}}
+	if caller != "" {
+		req.Header.Set("X-Caller", caller)
+	}
+	return h(context.Background(), req, nil, nil)
+}
+
+func newLimiter(t *testing.T, cfg config.RateLimit, opts ...Option) *Limiter {
+	l, err := NewLimiter(cfg, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// sharedCache 模拟redis等在多个副本之间共享的缓存
+type sharedCache struct {
+	*cache.FreeCache
+}
+
+func (sharedCache) Shared() bool {
+	return true
+}
+
+func TestHandlerWrapper(t *testing.T) {
+	l := newLimiter(t, config.RateLimit{Rules: []config.RateLimitRule{
+		{Method: "Sms.*", Key: KeyHeader, Header: "X-Caller", Rate: 2, Window: time.Hour},
+	}})
+
+	called := 0
+	h := NewHandlerWrapper(l)(func(ctx context.Context, req *server.Request, argv, rsp interface{}) error {
+		called++
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := call(h, "Sms.Send", "user"); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	err := call(h, "Sms.Send", "user")
+	if e := errors.FromError(err); e.Code != 429 || e.Id != LimitErrorId {
+		t.Fatalf("got %v, want a 429 from the rate limiter", err)
+	}
+	if called != 2 {
+		t.Fatalf("handler called %d times, want 2", called)
+	}
+
+	// 其他调用方与不匹配的方法不受影响
+	if err := call(h, "Sms.Send", "pay"); err != nil {
+		t.Fatalf("another caller got %v", err)
+	}
+	if err := call(h, "Pay.Create", "user"); err != nil {
+		t.Fatalf("unmatched method got %v", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	kept := config.RateLimitRule{Key: KeyMethod, Rate: 1, Window: time.Hour}
+	l := newLimiter(t, config.RateLimit{Rules: []config.RateLimitRule{kept}})
+
+	req := &server.Request{ServiceMethod: "Sms.Send"}
+	if err := l.Allow(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有变化的规则保留计数
+	if err := l.Update(config.RateLimit{Rules: []config.RateLimitRule{
+		kept,
+		{Method: "Pay.Create", Algorithm: "sliding_window", Rate: 1, Window: time.Hour},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Allow(req); err == nil {
+		t.Fatal("the unchanged rule lost its count after Update")
+	}
+
+	// 删除规则后不再限流
+	if err := l.Update(config.RateLimit{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Allow(req); err != nil {
+		t.Fatalf("got %v with no rules", err)
+	}
+}
+
+func TestDistributed(t *testing.T) {
+	c := sharedCache{cache.NewFreeCache(&cache.Config{})}
+	cfg := config.RateLimit{Rules: []config.RateLimitRule{
+		{Method: "Sms.Send", Key: KeyHeader, Header: "X-Phone", Rate: 3, Window: time.Hour, Distributed: true},
+	}}
+	// 两个副本共享同一个缓存
+	a, b := newLimiter(t, cfg, WithCache(c)), newLimiter(t, cfg, WithCache(c))
+
+	req := &server.Request{ServiceMethod: "Sms.Send", Header: http.Header{"X-Phone": {"13800000000"}}}
+	allowed := 0
+	for _, l := range []*Limiter{a, b, a, b, a, b} {
+		if l.Allow(req) == nil {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Fatalf("replicas allowed %d in total, want 3", allowed)
+	}
+}
+
+func TestDistributedRequiresSharedCache(t *testing.T) {
+	cfg := config.RateLimit{Rules: []config.RateLimitRule{
+		{Method: "Sms.Send", Rate: 3, Window: time.Hour, Distributed: true},
+	}}
+	// 没有缓存或者缓存只在进程内有效时，每个副本都会放行全部限额
+	if _, err := NewLimiter(cfg); err == nil {
+		t.Fatal("distributed rule accepted without a cache")
+	}
+	if _, err := NewLimiter(cfg, WithCache(cache.NewFreeCache(&cache.Config{}))); err == nil {
+		t.Fatal("distributed rule accepted with a process-local cache")
+	}
+
+	// 更新失败时保留原来的规则
+	l := newLimiter(t, config.RateLimit{Rules: []config.RateLimitRule{{Rate: 1, Window: time.Hour}}})
+	if err := l.Update(cfg); err == nil {
+		t.Fatal("Update accepted a distributed rule with a process-local cache")
+	}
+	req := &server.Request{ServiceMethod: "Sms.Send"}
+	if err := l.Allow(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Allow(req); err == nil {
+		t.Fatal("the previous rules were dropped by a failed Update")
+	}
+}